@@ -2,23 +2,9 @@ package syncx
 
 import (
 	"context"
-	"fmt"
 	"time"
 )
 
-var handlePanicErr func(context.Context, error) = func(ctx context.Context, err error) {
-	panic(err)
-}
-
-// RegisterPanicHandler sets a custom handler function for panics that occur in
-// goroutines started by Go(). The handler receives the context and the error
-// that caused the panic.
-//
-// If no handler is registered, panics will be propagated normally.
-func RegisterPanicHandler(f func(context.Context, error)) {
-	handlePanicErr = f
-}
-
 // GoOption represents a configuration option for the Go function.
 // It receives a context and returns a modified context along with
 // a cleanup function.
@@ -26,7 +12,8 @@ type GoOption func(ctx context.Context) (context.Context, func())
 
 // Go launches a goroutine with panic recovery and optional context modifications.
 // The provided function f is executed in a new goroutine with the given context.
-// Any panics in the goroutine will be caught and handled by the registered panic handler.
+// Any panics in the goroutine will be caught and handled, as a *PanicError, by the
+// panic handler of the context, see WithPanicHandler, or else the registered one.
 //
 // Example usage:
 //
@@ -34,31 +21,35 @@ type GoOption func(ctx context.Context) (context.Context, func())
 //	    // Your goroutine logic here
 //	}, WithTimeout(5*time.Second))
 func Go(ctx context.Context, f func(ctx context.Context), opts ...GoOption) {
-	cancels := make([]func(), 0, len(opts))
-	var cancel func()
-	for _, opt := range opts {
-		ctx, cancel = opt(ctx)
-		cancels = append(cancels, cancel)
-	}
+	ctx, cleanup := applyGoOptions(ctx, opts)
 	go func(ctx context.Context) {
 		defer func() {
 			if r := recover(); r != nil {
-				err, ok := r.(error)
-				if !ok {
-					err = fmt.Errorf("%v", r)
-				}
-				handlePanicErr(ctx, err)
-			}
-
-			for _, cancel := range cancels {
-				cancel()
+				panicHandlerFrom(ctx)(ctx, NewPanicError(r))
 			}
+			cleanup()
 		}()
 
 		f(ctx)
 	}(ctx)
 }
 
+// applyGoOptions applies the options to ctx in order, and returns the function
+// running all their cleanups.
+func applyGoOptions(ctx context.Context, opts []GoOption) (context.Context, func()) {
+	cancels := make([]func(), 0, len(opts))
+	var cancel func()
+	for _, opt := range opts {
+		ctx, cancel = opt(ctx)
+		cancels = append(cancels, cancel)
+	}
+	return ctx, func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+}
+
 // WithTimeout returns a GoOption that adds a timeout to the context.
 // The goroutine will be cancelled after the specified duration.
 func WithTimeout(d time.Duration) GoOption {
@@ -40,16 +40,19 @@ func TestGo(t *testing.T) {
 
 	t.Run("test panic handling", func(t *testing.T) {
 		t.Parallel()
-		var panicErr error
-		RegisterPanicHandler(func(ctx context.Context, err error) {
-			panicErr = err
-		})
+		panicErrs := make(chan error, 1)
 		Go(context.Background(), func(ctx context.Context) {
 			panic("test panic")
-		})
-		time.Sleep(1000 * time.Microsecond) // give some time for the goroutine to panic
-		if panicErr == nil || panicErr.Error() != "test panic" {
-			t.Fatalf("expected panic error, got %v", panicErr)
+		}, WithPanicHandler(func(ctx context.Context, err error) {
+			panicErrs <- err
+		}))
+		select {
+		case panicErr := <-panicErrs:
+			if panicErr.Error() != "test panic" {
+				t.Fatalf("expected panic error, got %v", panicErr)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("panic not handled in time")
 		}
 	})
 
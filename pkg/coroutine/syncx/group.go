@@ -0,0 +1,117 @@
+package syncx
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// GroupOption configures a Group.
+type GroupOption func(g *Group)
+
+// WithLimit limits the goroutines of the group running at the same time.
+// Go blocks until one of them returns. n <= 0 means no limit, the default.
+func WithLimit(n int) GroupOption {
+	return func(g *Group) {
+		if n > 0 {
+			g.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+// Group runs goroutines returning errors, like errgroup. The first error cancels the
+// context of the group, and Wait returns all the errors joined. A panic in a goroutine
+// is recovered and returned as a *PanicError, instead of being handed to the panic
+// handler of Go.
+//
+// Example usage:
+//
+//	g := NewGroup(ctx, WithLimit(4))
+//	for _, url := range urls {
+//	    g.Go(func(ctx context.Context) error {
+//	        return fetch(ctx, url)
+//	    }, WithTimeout(10*time.Second))
+//	}
+//	if err := g.Wait(); err != nil {
+//	    // the first error canceled the other fetches
+//	}
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	sem    chan struct{}
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewGroup creates a group whose context is derived from ctx.
+func NewGroup(ctx context.Context, opts ...GroupOption) *Group {
+	ctx, cancel := context.WithCancelCause(ctx)
+	g := &Group{ctx: ctx, cancel: cancel}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// Context returns the context of the group, canceled by the first error, Cancel or Wait.
+// context.Cause of it returns the first error.
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs f in a new goroutine with the context of the group, modified by opts as Go does.
+// If the group has a limit, Go blocks until a running goroutine returns.
+func (g *Group) Go(f func(ctx context.Context) error, opts ...GoOption) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.wg.Add(1)
+	ctx, cleanup := applyGoOptions(g.ctx, opts)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+		defer cleanup()
+		g.add(g.run(ctx, f))
+	}()
+}
+
+// run runs f, recovering a panic as a *PanicError.
+func (g *Group) run(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = NewPanicError(r)
+		}
+	}()
+	return f(ctx)
+}
+
+func (g *Group) add(err error) {
+	if err == nil {
+		return
+	}
+	g.mu.Lock()
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+	g.cancel(err)
+}
+
+// Wait waits for all the goroutines to return, cancels the context of the group, and
+// returns their errors joined in the order they returned, or nil if none failed.
+// The errors include those returned by the goroutines canceled, e.g. context.Canceled.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return errors.Join(g.errs...)
+}
+
+// Cancel cancels the context of the group. Note that this does not wait for the
+// goroutines to return - use Wait() for that.
+func (g *Group) Cancel() {
+	g.cancel(nil)
+}
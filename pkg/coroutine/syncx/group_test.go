@@ -0,0 +1,96 @@
+package syncx
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	t.Run("no error", func(t *testing.T) {
+		g := NewGroup(context.Background())
+		var n atomic.Int32
+		for i := 0; i < 10; i++ {
+			g.Go(func(ctx context.Context) error {
+				n.Add(1)
+				return nil
+			})
+		}
+		require.NoError(t, g.Wait())
+		require.EqualValues(t, 10, n.Load())
+		require.Error(t, g.Context().Err(), "canceled by Wait")
+	})
+
+	t.Run("first error cancels", func(t *testing.T) {
+		errBoom := errors.New("boom")
+		g := NewGroup(context.Background())
+		g.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		g.Go(func(ctx context.Context) error {
+			return errBoom
+		})
+		err := g.Wait()
+		require.ErrorIs(t, err, errBoom)
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, context.Cause(g.Context()), errBoom)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		g := NewGroup(context.Background())
+		g.Go(func(ctx context.Context) error {
+			panic("test panic")
+		})
+		err := g.Wait()
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		require.Equal(t, "test panic", panicErr.Value)
+		require.Equal(t, "test panic", err.Error())
+		require.Contains(t, string(panicErr.Stack), "group_test.go")
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		g := NewGroup(context.Background(), WithLimit(2))
+		var running, maxRunning atomic.Int32
+		for i := 0; i < 6; i++ {
+			g.Go(func(ctx context.Context) error {
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					max := maxRunning.Load()
+					if n <= max || maxRunning.CompareAndSwap(max, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			})
+		}
+		require.NoError(t, g.Wait())
+		require.EqualValues(t, 2, maxRunning.Load())
+	})
+
+	t.Run("go options", func(t *testing.T) {
+		g := NewGroup(context.Background())
+		g.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, WithTimeout(time.Millisecond))
+		require.ErrorIs(t, g.Wait(), context.DeadlineExceeded)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		g := NewGroup(context.Background())
+		g.Go(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+		g.Cancel()
+		require.NoError(t, g.Wait())
+	})
+}
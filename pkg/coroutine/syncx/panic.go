@@ -0,0 +1,118 @@
+package syncx
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// PanicHandler handles a panic recovered in a goroutine started by Go or WG.
+// err is a *PanicError.
+type PanicHandler func(ctx context.Context, err error)
+
+// globalPanicHandler is the fallback of the contexts without a handler,
+// nil until RegisterPanicHandler.
+var globalPanicHandler atomic.Pointer[PanicHandler]
+
+// RegisterPanicHandler sets the handler of panics in goroutines started by Go() whose
+// context has no handler, see WithPanicHandler. The handler receives the context and
+// the *PanicError of the panic.
+//
+// If no handler is registered, panics will be propagated normally.
+//
+// The handler is global, prefer WithPanicHandler or ContextWithPanicHandler in libraries and tests.
+func RegisterPanicHandler(f func(context.Context, error)) {
+	h := PanicHandler(f)
+	globalPanicHandler.Store(&h)
+}
+
+// WithPanicHandler returns a GoOption that handles the panics of the goroutine by f,
+// instead of the registered handler. Goroutines started with its context inherit it,
+// see ContextWithPanicHandler.
+//
+// Example usage:
+//
+//	Go(ctx, func(ctx context.Context) {
+//	    // Your goroutine logic here
+//	}, WithPanicHandler(func(ctx context.Context, err error) {
+//	    var panicErr *PanicError
+//	    errors.As(err, &panicErr)
+//	    log.Printf("recovered: %v\n%s", panicErr.Value, panicErr.Stack)
+//	}))
+func WithPanicHandler(f func(context.Context, error)) GoOption {
+	return func(ctx context.Context) (context.Context, func()) {
+		return ContextWithPanicHandler(ctx, f), func() {}
+	}
+}
+
+type panicHandlerKey struct{}
+
+// ContextWithPanicHandler returns a context whose goroutines started by Go or WG
+// handle their panics by f, instead of the registered handler.
+func ContextWithPanicHandler(ctx context.Context, f func(context.Context, error)) context.Context {
+	return context.WithValue(ctx, panicHandlerKey{}, PanicHandler(f))
+}
+
+// panicHandlerFrom returns the handler of ctx, or else the registered one,
+// or else rePanic.
+func panicHandlerFrom(ctx context.Context) PanicHandler {
+	if h, ok := ctx.Value(panicHandlerKey{}).(PanicHandler); ok && h != nil {
+		return h
+	}
+	if h := globalPanicHandler.Load(); h != nil && *h != nil {
+		return *h
+	}
+	return rePanic
+}
+
+// rePanic propagates the panic, crashing the program.
+func rePanic(ctx context.Context, err error) {
+	panic(err)
+}
+
+// PanicError is the error of a panic recovered in a goroutine, with the stack
+// of the goroutine where it panicked.
+//
+// Example:
+//
+//	err := g.Wait()
+//	var panicErr *PanicError
+//	if errors.As(err, &panicErr) {
+//	    log.Printf("panic: %v\n%s", panicErr.Value, panicErr.Stack)
+//	}
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the panicking goroutine, as formatted by debug.Stack.
+	Stack []byte
+}
+
+// NewPanicError returns the *PanicError of r, recovered outside of Go, WG and Group.
+// It must be called in the deferred function recovering r,
+// so that the stack is the one of the panic.
+//
+// Example:
+//
+//	defer func() {
+//	    if r := recover(); r != nil {
+//	        err = NewPanicError(r)
+//	    }
+//	}()
+func NewPanicError(r any) *PanicError {
+	return &PanicError{Value: r, Stack: debug.Stack()}
+}
+
+// Error returns the panic value, without the stack.
+func (e *PanicError) Error() string {
+	if err, ok := e.Value.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprintf("%v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
@@ -0,0 +1,92 @@
+package syncx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recvErr receives an error from errs, failing the test if none in time.
+func recvErr(t *testing.T, errs <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("panic not handled in time")
+		return nil
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	t.Run("panic error", func(t *testing.T) {
+		t.Parallel()
+		errs := make(chan error, 1)
+		errCause := errors.New("cause")
+		Go(context.Background(), func(ctx context.Context) {
+			panic(errCause)
+		}, WithPanicHandler(func(ctx context.Context, err error) {
+			errs <- err
+		}))
+		err := recvErr(t, errs)
+		require.ErrorIs(t, err, errCause)
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		require.Equal(t, errCause, panicErr.Value)
+		require.Contains(t, string(panicErr.Stack), "panic_test.go")
+	})
+
+	t.Run("context scoped", func(t *testing.T) {
+		t.Parallel()
+		errs := make(chan error, 2)
+		ctx := ContextWithPanicHandler(context.Background(), func(ctx context.Context, err error) {
+			errs <- err
+		})
+		wg := WG(ctx)
+		wg.Go(func(ctx context.Context) {
+			// inherited by the nested goroutines
+			Go(ctx, func(ctx context.Context) {
+				panic("nested")
+			})
+			panic("outer")
+		})
+		wg.Wait()
+		got := []string{recvErr(t, errs).Error(), recvErr(t, errs).Error()}
+		require.ElementsMatch(t, []string{"outer", "nested"}, got)
+	})
+
+	t.Run("option overrides context", func(t *testing.T) {
+		t.Parallel()
+		ctxErrs := make(chan error, 1)
+		optErrs := make(chan error, 1)
+		ctx := ContextWithPanicHandler(context.Background(), func(ctx context.Context, err error) {
+			ctxErrs <- err
+		})
+		Go(ctx, func(ctx context.Context) {
+			panic("test panic")
+		}, WithPanicHandler(func(ctx context.Context, err error) {
+			optErrs <- err
+		}))
+		require.EqualError(t, recvErr(t, optErrs), "test panic")
+		require.Empty(t, ctxErrs)
+	})
+}
+
+// TestRegisterPanicHandler must not run in parallel, as it sets the global handler.
+func TestRegisterPanicHandler(t *testing.T) {
+	errs := make(chan error, 1)
+	RegisterPanicHandler(func(ctx context.Context, err error) {
+		errs <- err
+	})
+	defer RegisterPanicHandler(nil)
+
+	Go(context.Background(), func(ctx context.Context) {
+		panic("test panic")
+	})
+	var panicErr *PanicError
+	require.ErrorAs(t, recvErr(t, errs), &panicErr)
+	require.Equal(t, "test panic", panicErr.Value)
+}
@@ -2,10 +2,12 @@ package cachex
 
 import (
 	"context"
+	"sync"
 	"time"
 )
 
 type memoryCacher struct {
+	mu     sync.RWMutex
 	memory []byte
 }
 
@@ -16,10 +18,14 @@ func NewMemoryCacher() Cacher {
 }
 
 func (c *memoryCacher) Get(ctx context.Context) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.memory, nil
 }
 
 func (c *memoryCacher) Set(ctx context.Context, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.memory = value
 	return nil
 }
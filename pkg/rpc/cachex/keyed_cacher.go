@@ -0,0 +1,99 @@
+package cachex
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyedCacher is a group of Cachers, one per key,
+// e.g. redis keys sharing a prefix.
+type KeyedCacher interface {
+	Cacher(key string) Cacher
+}
+
+// KeyedCacherFunc adapts a function to a KeyedCacher.
+//
+// Example:
+//
+//	keyed := cachex.KeyedCacherFunc(func(key string) cachex.Cacher {
+//	    return newRedisCacher(rdb, "introspection:"+key)
+//	})
+type KeyedCacherFunc func(key string) Cacher
+
+func (f KeyedCacherFunc) Cacher(key string) Cacher {
+	return f(key)
+}
+
+type memoryEntry struct {
+	value  []byte
+	expiry time.Time // zero means never expires
+}
+
+type memoryKeyedCacher struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextSweep int
+}
+
+// NewMemoryKeyedCacher returns an in-memory KeyedCacher, whose entries
+// expire after the ttl they are set with. A zero ttl never expires.
+func NewMemoryKeyedCacher() KeyedCacher {
+	return &memoryKeyedCacher{
+		entries:   map[string]memoryEntry{},
+		nextSweep: 64,
+	}
+}
+
+func (c *memoryKeyedCacher) Cacher(key string) Cacher {
+	return &memoryKeyedEntry{parent: c, key: key}
+}
+
+func (c *memoryKeyedCacher) get(key string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return []byte("")
+	}
+	if !entry.expiry.IsZero() && !time.Now().Before(entry.expiry) {
+		delete(c.entries, key)
+		return []byte("")
+	}
+	return entry.value
+}
+
+func (c *memoryKeyedCacher) set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiry = time.Now().Add(ttl)
+	}
+	c.entries[key] = entry
+
+	// sweep expired entries once the map doubles, so it does not grow forever
+	if len(c.entries) >= c.nextSweep {
+		now := time.Now()
+		for k, e := range c.entries {
+			if !e.expiry.IsZero() && !now.Before(e.expiry) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = 2*len(c.entries) + 64
+	}
+}
+
+type memoryKeyedEntry struct {
+	parent *memoryKeyedCacher
+	key    string
+}
+
+func (e *memoryKeyedEntry) Get(ctx context.Context) ([]byte, error) {
+	return e.parent.get(e.key), nil
+}
+
+func (e *memoryKeyedEntry) Set(ctx context.Context, value []byte, ttl time.Duration) error {
+	e.parent.set(e.key, value, ttl)
+	return nil
+}
@@ -0,0 +1,60 @@
+package graphqlx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Location is the position in the query that an Error refers to.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is one entry of the errors array in a GraphQL response.
+type Error struct {
+	Message    string         `json:"message"`
+	Locations  []Location     `json:"locations,omitempty"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprint(p)
+	}
+	return strings.Join(path, ".") + ": " + e.Message
+}
+
+// ResponseError is returned when a GraphQL response contains errors.
+// Data holds the raw partial data returned alongside the errors, if any.
+//
+// Example:
+//
+//	resp, err := graphqlx.Query[Vars, Resp](ctx, gqlCli, query, vars)
+//	var respErr *graphqlx.ResponseError
+//	if errors.As(err, &respErr) && respErr.HasData() {
+//	    // resp holds the partial data
+//	}
+type ResponseError struct {
+	Errors []Error
+	Data   json.RawMessage
+}
+
+func (e *ResponseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+// HasData reports whether partial data was returned alongside the errors.
+func (e *ResponseError) HasData() bool {
+	return len(e.Data) > 0
+}
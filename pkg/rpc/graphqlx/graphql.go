@@ -0,0 +1,204 @@
+package graphqlx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+)
+
+// Request is a GraphQL request.
+type Request struct {
+	Query         string
+	OperationName string
+	Variables     any
+}
+
+// payload is the JSON body posted to the GraphQL endpoint.
+type payload struct {
+	Query         string      `json:"query,omitempty"`
+	OperationName string      `json:"operationName,omitempty"`
+	Variables     any         `json:"variables,omitempty"`
+	Extensions    *extensions `json:"extensions,omitempty"`
+}
+
+type extensions struct {
+	PersistedQuery *persistedQuery `json:"persistedQuery,omitempty"`
+}
+
+type persistedQuery struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+// response is the JSON body returned by the GraphQL endpoint.
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []Error         `json:"errors"`
+}
+
+// Client is a GraphQL client over httpx.XClient.
+// It is safe for concurrent use.
+type Client struct {
+	endpoint       string
+	cli            *httpx.XClient
+	persistedQuery bool
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithPersistedQuery enables automatic persisted queries.
+// The client first sends only the SHA-256 hash of the query, and falls back to
+// sending the full query if the server does not know the hash yet.
+func WithPersistedQuery() Option {
+	return func(c *Client) {
+		c.persistedQuery = true
+	}
+}
+
+// NewClient creates a GraphQL client that posts requests to endpoint through cli.
+//
+// Example:
+//
+//	gqlCli := graphqlx.NewClient("https://api.example.com/graphql",
+//	    httpx.NewXClient(httpx.WithBearerAuth("token")))
+func NewClient(endpoint string, cli *httpx.XClient, opts ...Option) *Client {
+	c := &Client{
+		endpoint: endpoint,
+		cli:      cli,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Query sends a query (or mutation) with typed variables and decodes data into Resp.
+//
+// If the server returns errors, the returned error is *ResponseError, and any
+// partial data returned along with the errors is still decoded into Resp.
+//
+// Example:
+//
+//	type Vars struct {
+//	    ID string `json:"id"`
+//	}
+//	type Resp struct {
+//	    User struct {
+//	        Name string `json:"name"`
+//	    } `json:"user"`
+//	}
+//	resp, err := graphqlx.Query[Vars, Resp](ctx, gqlCli,
+//	    `query($id: ID!) { user(id: $id) { name } }`, Vars{ID: "1"})
+func Query[Vars any, Resp any](ctx context.Context, c *Client, query string, vars Vars, opts ...httpx.XRequestOption) (Resp, error) {
+	return Do[Resp](ctx, c, Request{Query: query, Variables: vars}, opts...)
+}
+
+// Do sends the request and decodes data into Resp.
+// See Query for how errors are returned.
+func Do[Resp any](ctx context.Context, c *Client, req Request, opts ...httpx.XRequestOption) (Resp, error) {
+	var result Resp
+
+	resp, err := c.do(ctx, req, opts...)
+	if err != nil {
+		return result, err
+	}
+
+	hasData := len(resp.Data) > 0 && string(resp.Data) != "null"
+	if hasData {
+		if err := json.Unmarshal(resp.Data, &result); err != nil {
+			return result, fmt.Errorf("graphql: decode data: %w", err)
+		}
+	}
+	if len(resp.Errors) > 0 {
+		respErr := &ResponseError{Errors: resp.Errors}
+		if hasData {
+			respErr.Data = resp.Data
+		}
+		return result, respErr
+	}
+	return result, nil
+}
+
+func (c *Client) do(ctx context.Context, req Request, opts ...httpx.XRequestOption) (*response, error) {
+	body := payload{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+	}
+	if !c.persistedQuery {
+		return c.post(ctx, body, opts...)
+	}
+
+	body.Extensions = &extensions{PersistedQuery: &persistedQuery{
+		Version:    1,
+		Sha256Hash: QueryHash(req.Query),
+	}}
+
+	// try the hash only, and fall back to the full query if not found
+	hashOnly := body
+	hashOnly.Query = ""
+	resp, err := c.post(ctx, hashOnly, opts...)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isPersistedQueryNotFound(resp.Errors):
+		return c.post(ctx, body, opts...)
+	case isPersistedQueryNotSupported(resp.Errors):
+		body.Extensions = nil
+		return c.post(ctx, body, opts...)
+	}
+	return resp, nil
+}
+
+// post sends the payload. Servers may reply errors with a non-2xx status,
+// in which case the GraphQL response is recovered from *httpx.XError.
+func (c *Client) post(ctx context.Context, body payload, opts ...httpx.XRequestOption) (*response, error) {
+	resp := &response{}
+	err := c.cli.PostJSON(ctx, c.endpoint, body, resp, opts...)
+	if err != nil {
+		var xerr *httpx.XError
+		if errors.As(err, &xerr) {
+			errResp := &response{}
+			if json.Unmarshal(xerr.Body, errResp) == nil && len(errResp.Errors) > 0 {
+				return errResp, nil
+			}
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// QueryHash returns the hex encoded SHA-256 hash of the query,
+// as used by automatic persisted queries.
+func QueryHash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+func isPersistedQueryNotFound(errs []Error) bool {
+	return hasErrorCode(errs, "PERSISTED_QUERY_NOT_FOUND", "PersistedQueryNotFound")
+}
+
+func isPersistedQueryNotSupported(errs []Error) bool {
+	return hasErrorCode(errs, "PERSISTED_QUERY_NOT_SUPPORTED", "PersistedQueryNotSupported")
+}
+
+func hasErrorCode(errs []Error, code string, message string) bool {
+	for _, e := range errs {
+		if e.Message == message {
+			return true
+		}
+		if c, _ := e.Extensions["code"].(string); strings.EqualFold(c, code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package graphqlx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/require"
+)
+
+type rawPayload struct {
+	Query      string          `json:"query"`
+	Variables  json.RawMessage `json:"variables"`
+	Extensions *extensions     `json:"extensions"`
+}
+
+func newMockServer(t *testing.T, handler func(p rawPayload) (int, string)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p rawPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		code, body := handler(p)
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+}
+
+type userVars struct {
+	ID string `json:"id"`
+}
+
+type userResp struct {
+	User *struct {
+		Name string `json:"name"`
+	} `json:"user"`
+	Posts []string `json:"posts"`
+}
+
+func TestQuery(t *testing.T) {
+	server := newMockServer(t, func(p rawPayload) (int, string) {
+		require.Equal(t, `query($id: ID!) { user(id: $id) { name } }`, p.Query)
+		require.JSONEq(t, `{"id":"1"}`, string(p.Variables))
+		return 200, `{"data":{"user":{"name":"John"}}}`
+	})
+	defer server.Close()
+	cli := NewClient(server.URL, httpx.NewXClient())
+
+	resp, err := Query[userVars, userResp](context.Background(), cli,
+		`query($id: ID!) { user(id: $id) { name } }`, userVars{ID: "1"})
+	require.NoError(t, err)
+	require.Equal(t, "John", resp.User.Name)
+}
+
+func TestQueryPartialData(t *testing.T) {
+	server := newMockServer(t, func(p rawPayload) (int, string) {
+		return 200, `{
+			"data": {"user": {"name": "John"}, "posts": null},
+			"errors": [{"message": "not allowed", "path": ["posts", 0], "locations": [{"line": 1, "column": 2}]}]
+		}`
+	})
+	defer server.Close()
+	cli := NewClient(server.URL, httpx.NewXClient())
+
+	resp, err := Query[userVars, userResp](context.Background(), cli, `{ user { name } posts }`, userVars{})
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	require.True(t, respErr.HasData())
+	require.Len(t, respErr.Errors, 1)
+	require.Equal(t, "posts.0: not allowed", respErr.Errors[0].Error())
+	require.Equal(t, []Location{{Line: 1, Column: 2}}, respErr.Errors[0].Locations)
+	require.Equal(t, "John", resp.User.Name)
+}
+
+func TestQueryErrorWithNon2xx(t *testing.T) {
+	server := newMockServer(t, func(p rawPayload) (int, string) {
+		return 400, `{"errors": [{"message": "syntax error"}]}`
+	})
+	defer server.Close()
+	cli := NewClient(server.URL, httpx.NewXClient())
+
+	_, err := Query[any, userResp](context.Background(), cli, `{`, nil)
+	var respErr *ResponseError
+	require.ErrorAs(t, err, &respErr)
+	require.False(t, respErr.HasData())
+	require.Equal(t, "graphql: syntax error", respErr.Error())
+}
+
+func TestPersistedQuery(t *testing.T) {
+	const query = `{ user { name } }`
+	var (
+		mu    sync.Mutex
+		known = map[string]bool{}
+		calls = 0
+	)
+	server := newMockServer(t, func(p rawPayload) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+
+		require.NotNil(t, p.Extensions)
+		hash := p.Extensions.PersistedQuery.Sha256Hash
+		require.Equal(t, QueryHash(query), hash)
+		if p.Query == "" && !known[hash] {
+			return 200, `{"errors": [{"message": "PersistedQueryNotFound", "extensions": {"code": "PERSISTED_QUERY_NOT_FOUND"}}]}`
+		}
+		known[hash] = true
+		return 200, `{"data":{"user":{"name":"John"}}}`
+	})
+	defer server.Close()
+	cli := NewClient(server.URL, httpx.NewXClient(), WithPersistedQuery())
+
+	for i := 0; i < 2; i++ {
+		resp, err := Query[any, userResp](context.Background(), cli, query, nil)
+		require.NoError(t, err)
+		require.Equal(t, "John", resp.User.Name)
+	}
+	require.Equal(t, 3, calls) // hash miss + full query, then hash hit
+}
+
+type repoVars struct {
+	After string `json:"after,omitempty"`
+}
+
+type repoResp struct {
+	Repos Connection[string] `json:"repos"`
+}
+
+func TestPaginate(t *testing.T) {
+	pages := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+	server := newMockServer(t, func(p rawPayload) (int, string) {
+		var vars repoVars
+		require.NoError(t, json.Unmarshal(p.Variables, &vars))
+		page := 0
+		if vars.After != "" {
+			page, _ = strconv.Atoi(vars.After)
+		}
+
+		conn := Connection[string]{PageInfo: PageInfo{
+			HasNextPage: page+1 < len(pages),
+			EndCursor:   strconv.Itoa(page + 1),
+		}}
+		for _, node := range pages[page] {
+			conn.Edges = append(conn.Edges, Edge[string]{Cursor: node, Node: node})
+		}
+		raw, _ := json.Marshal(map[string]any{"data": repoResp{Repos: conn}})
+		return 200, string(raw)
+	})
+	defer server.Close()
+	cli := NewClient(server.URL, httpx.NewXClient())
+
+	pager := Pager[repoVars, repoResp, string]{
+		Variables:  func(after string) repoVars { return repoVars{After: after} },
+		Connection: func(resp repoResp) Connection[string] { return resp.Repos },
+	}
+	nodes, err := Paginate(context.Background(), cli, `query($after: String) { repos }`, pager)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c", "d", "e"}, nodes)
+
+	pager.MaxPages = 2
+	nodes, err = Paginate(context.Background(), cli, `query($after: String) { repos }`, pager)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c", "d"}, nodes)
+}
+
+func TestPaginateRepeatedCursor(t *testing.T) {
+	server := newMockServer(t, func(p rawPayload) (int, string) {
+		conn := Connection[string]{
+			Nodes:    []string{"a"},
+			PageInfo: PageInfo{HasNextPage: true, EndCursor: "same"},
+		}
+		raw, _ := json.Marshal(map[string]any{"data": repoResp{Repos: conn}})
+		return 200, string(raw)
+	})
+	defer server.Close()
+	cli := NewClient(server.URL, httpx.NewXClient())
+
+	pager := Pager[repoVars, repoResp, string]{
+		Variables:  func(after string) repoVars { return repoVars{After: after} },
+		Connection: func(resp repoResp) Connection[string] { return resp.Repos },
+	}
+	nodes, err := Paginate(context.Background(), cli, `query($after: String) { repos }`, pager)
+	require.ErrorIs(t, err, ErrRepeatedCursor)
+	require.Equal(t, []string{"a", "a"}, nodes)
+}
@@ -0,0 +1,123 @@
+package graphqlx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+)
+
+// ErrRepeatedCursor is returned by EachPage when the server returns an end cursor it returned
+// before, which would loop forever. The nodes already passed to fn are a partial listing.
+var ErrRepeatedCursor = errors.New("graphqlx: repeated page cursor")
+
+// PageInfo is the pageInfo of a cursor-based connection.
+type PageInfo struct {
+	HasNextPage bool   `json:"hasNextPage"`
+	EndCursor   string `json:"endCursor"`
+}
+
+// Edge is an edge of a cursor-based connection.
+type Edge[Node any] struct {
+	Cursor string `json:"cursor"`
+	Node   Node   `json:"node"`
+}
+
+// Connection is a cursor-based connection, as described by the Relay specification.
+// Either Edges or Nodes may be queried.
+type Connection[Node any] struct {
+	Edges    []Edge[Node] `json:"edges"`
+	Nodes    []Node       `json:"nodes"`
+	PageInfo PageInfo     `json:"pageInfo"`
+}
+
+// AllNodes returns the nodes of the connection, from Nodes or Edges.
+func (c Connection[Node]) AllNodes() []Node {
+	if len(c.Nodes) > 0 {
+		return c.Nodes
+	}
+	nodes := make([]Node, len(c.Edges))
+	for i, edge := range c.Edges {
+		nodes[i] = edge.Node
+	}
+	return nodes
+}
+
+// Pager describes how to follow a connection across pages.
+type Pager[Vars any, Resp any, Node any] struct {
+	// Variables returns the variables of a page.
+	// after is the end cursor of the previous page, or "" for the first page.
+	Variables func(after string) Vars
+
+	// Connection extracts the connection from a page.
+	Connection func(resp Resp) Connection[Node]
+
+	// MaxPages limits the number of pages fetched. 0 means no limit.
+	MaxPages int
+}
+
+// EachPage queries the pages of a connection one by one, and calls fn with the nodes of each page.
+// It stops when there is no next page, when fn returns an error, or when MaxPages is reached.
+// It returns ErrRepeatedCursor if the server repeats an end cursor.
+//
+// Example:
+//
+//	err := graphqlx.EachPage(ctx, gqlCli, `query($after: String) {
+//	    repos(first: 100, after: $after) { nodes { name } pageInfo { hasNextPage endCursor } }
+//	}`, graphqlx.Pager[Vars, Resp, Repo]{
+//	    Variables:  func(after string) Vars { return Vars{After: after} },
+//	    Connection: func(resp Resp) graphqlx.Connection[Repo] { return resp.Repos },
+//	}, func(repos []Repo) error {
+//	    return save(repos)
+//	})
+func EachPage[Vars any, Resp any, Node any](
+	ctx context.Context,
+	c *Client,
+	query string,
+	pager Pager[Vars, Resp, Node],
+	fn func(nodes []Node) error,
+	opts ...httpx.XRequestOption,
+) error {
+	after := ""
+	seen := map[string]bool{}
+	for page := 0; pager.MaxPages == 0 || page < pager.MaxPages; page++ {
+		resp, err := Query[Vars, Resp](ctx, c, query, pager.Variables(after), opts...)
+		if err != nil {
+			return err
+		}
+
+		conn := pager.Connection(resp)
+		if err := fn(conn.AllNodes()); err != nil {
+			return err
+		}
+
+		next := conn.PageInfo.EndCursor
+		if !conn.PageInfo.HasNextPage || next == "" {
+			return nil
+		}
+		if seen[next] {
+			return fmt.Errorf("%w: %q", ErrRepeatedCursor, next)
+		}
+		seen[next] = true
+		after = next
+	}
+	return nil
+}
+
+// Paginate queries all the pages of a connection and returns all the nodes.
+// See EachPage for details.
+func Paginate[Vars any, Resp any, Node any](
+	ctx context.Context,
+	c *Client,
+	query string,
+	pager Pager[Vars, Resp, Node],
+	opts ...httpx.XRequestOption,
+) ([]Node, error) {
+	var all []Node
+	err := EachPage(ctx, c, query, pager, func(nodes []Node) error {
+		all = append(all, nodes...)
+		return nil
+	}, opts...)
+	return all, err
+}
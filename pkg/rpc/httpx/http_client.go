@@ -1,6 +1,11 @@
 package httpx
 
-import "net/http"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
 
 // Client interface abstracts the complexity of http.Client,
 // limiting XClient to only use the Do method when calling http.Client.
@@ -41,3 +46,43 @@ func NewClient(opts ...ClientOption) *http.Client {
 	}
 	return cli
 }
+
+// NewRoundTripper adapts a Client to an http.RoundTripper, so that a Client with
+// decorators can be used by third-party SDKs that only accept *http.Client.
+// c must not send requests through the returned RoundTripper itself, or requests loop.
+//
+// A RoundTripper must not return an error for a response it received, so the non-2xx
+// responses turned into *XError by WithReturnErrorIfNot2xx are passed through as
+// responses, with the body read by the decorator. Errors of other decorators, e.g. the
+// authentication errors of oauth2x.WithOAuth2Http, are still returned as errors;
+// build c without them if the SDK must see every response.
+//
+// Example:
+//
+//	httpCli := &http.Client{Transport: httpx.NewRoundTripper(decoratedClient)}
+//	sdk := thirdparty.NewClient(httpCli)
+func NewRoundTripper(c Client) http.RoundTripper {
+	return clientRoundTripper{c}
+}
+
+type clientRoundTripper struct {
+	c Client
+}
+
+func (t clientRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.c.Do(req)
+	if err != nil {
+		var xErr *XError
+		if errors.As(err, &xErr) && xErr.Response != nil {
+			// the body is already read and closed by WithReturnErrorIfNot2xx
+			resp := xErr.Response
+			resp.Body = io.NopCloser(bytes.NewReader(xErr.Body))
+			resp.ContentLength = int64(len(xErr.Body))
+			return resp, nil
+		}
+		// a RoundTripper returns either a response or an error,
+		// and the response body is already closed by the convention of Do
+		return nil, err
+	}
+	return resp, nil
+}
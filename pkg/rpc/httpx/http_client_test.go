@@ -0,0 +1,48 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestXClientHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+			return
+		}
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	httpCli := NewXClient(WithBearerAuth("token")).HTTPClient()
+
+	resp, err := httpCli.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "Bearer token", string(body))
+
+	// non-2xx responses are passed through, as a RoundTripper must
+	resp, err = httpCli.Get(server.URL + "/missing")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "not found", string(body))
+
+	// the XClient itself still returns them as errors
+	_, err = NewXClient().Get(context.Background(), server.URL+"/missing")
+	var xErr *XError
+	require.True(t, errors.As(err, &xErr))
+	require.Equal(t, http.StatusNotFound, xErr.Code)
+}
@@ -9,16 +9,6 @@ import (
 
 var defaultCli = NewXClient()
 
-// // MustNewJsonRpcCliWithHTTP 返回 HTTP transport 的 client，不需要 close
-// func MustNewJsonRpcCliWithHTTP(endpoint string) *rpc.Client {
-// 	cli, err := rpc.DialHTTPWithClient(endpoint, NewHttpClient())
-// 	if err != nil {
-// 		panic(err)
-// 	}
-
-// 	return cli
-// }
-
 func PostJSON(ctx context.Context, url string, request any, response any) error {
 	return defaultCli.PostJSON(ctx, url, request, response)
 }
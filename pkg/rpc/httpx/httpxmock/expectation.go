@@ -0,0 +1,257 @@
+package httpxmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// anyTimes is the max calls of an expectation that can be called any times.
+const anyTimes = -1
+
+// Expectation describes an expected request and the response to reply with.
+// It is created by Server.Expect and configured by chaining its methods.
+//
+// By default an expectation must be called exactly once.
+type Expectation struct {
+	method   string
+	path     string
+	query    url.Values
+	headers  http.Header
+	jsonBody any
+	hasBody  bool
+
+	status      int
+	respHeaders http.Header
+	respBody    []byte
+	delay       time.Duration
+
+	minCalls int
+	maxCalls int
+
+	mu    sync.Mutex
+	calls int
+}
+
+func newExpectation(method, path string) *Expectation {
+	return &Expectation{
+		method:      method,
+		path:        path,
+		query:       url.Values{},
+		headers:     http.Header{},
+		status:      http.StatusOK,
+		respHeaders: http.Header{},
+		minCalls:    1,
+		maxCalls:    1,
+	}
+}
+
+// WithQuery expects the query parameter key to have value.
+// Query parameters not given are not checked.
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.query.Add(key, value)
+	return e
+}
+
+// WithHeader expects the header key to have value.
+// Headers not given are not checked.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.headers.Add(key, value)
+	return e
+}
+
+// WithJSONBody expects the request body to be JSON equal to body.
+// body may be any value that marshals to JSON.
+// A string, []byte or json.RawMessage is taken as raw JSON.
+func (e *Expectation) WithJSONBody(body any) *Expectation {
+	e.jsonBody = body
+	e.hasBody = true
+	return e
+}
+
+// Respond sets the status and raw body of the response.
+func (e *Expectation) Respond(status int, body string) *Expectation {
+	e.status = status
+	e.respBody = []byte(body)
+	return e
+}
+
+// RespondJSON sets the status and JSON body of the response.
+// It panics if body cannot be marshaled, which is a bug in the test.
+func (e *Expectation) RespondJSON(status int, body any) *Expectation {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		panic(fmt.Sprintf("httpxmock: marshal response body: %v", err))
+	}
+	e.status = status
+	e.respBody = raw
+	e.respHeaders.Set("Content-Type", "application/json")
+	return e
+}
+
+// RespondHeader sets a header of the response.
+func (e *Expectation) RespondHeader(key, value string) *Expectation {
+	e.respHeaders.Set(key, value)
+	return e
+}
+
+// Delay delays the response by d, which is useful to test timeouts.
+// The delay is cut short if the request is cancelled.
+func (e *Expectation) Delay(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// Times expects the request to be made exactly n times.
+func (e *Expectation) Times(n int) *Expectation {
+	e.minCalls = n
+	e.maxCalls = n
+	return e
+}
+
+// Once expects the request to be made exactly once. It is the default.
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// AnyTimes allows the request to be made any times, including zero.
+func (e *Expectation) AnyTimes() *Expectation {
+	e.minCalls = 0
+	e.maxCalls = anyTimes
+	return e
+}
+
+// Calls returns how many times the expectation was matched.
+func (e *Expectation) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func (e *Expectation) String() string {
+	s := e.method + " " + e.path
+	if len(e.query) > 0 {
+		s += "?" + e.query.Encode()
+	}
+	return s
+}
+
+// match reports whether the request matches the expectation.
+// body is the already read request body.
+func (e *Expectation) match(r *http.Request, body []byte) bool {
+	if e.method != r.Method || e.path != r.URL.Path {
+		return false
+	}
+
+	query := r.URL.Query()
+	for k, vs := range e.query {
+		for _, v := range vs {
+			if !contains(query[k], v) {
+				return false
+			}
+		}
+	}
+
+	for k, vs := range e.headers {
+		for _, v := range vs {
+			if !contains(r.Header.Values(k), v) {
+				return false
+			}
+		}
+	}
+
+	if e.hasBody && !jsonEqual(e.jsonBody, body) {
+		return false
+	}
+	return true
+}
+
+// take counts a call if the expectation is not exhausted.
+func (e *Expectation) take() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.maxCalls != anyTimes && e.calls >= e.maxCalls {
+		return false
+	}
+	e.calls++
+	return true
+}
+
+// verify returns a description of the unmet call count, or "" if met.
+func (e *Expectation) verify() string {
+	calls := e.Calls()
+	switch {
+	case calls < e.minCalls:
+		return fmt.Sprintf("%s: expected %d calls, got %d", e, e.minCalls, calls)
+	case e.maxCalls != anyTimes && calls > e.maxCalls:
+		return fmt.Sprintf("%s: expected %d calls, got %d", e, e.maxCalls, calls)
+	}
+	return ""
+}
+
+func (e *Expectation) respond(w http.ResponseWriter, r *http.Request) {
+	if e.delay > 0 {
+		select {
+		case <-time.After(e.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for k, vs := range e.respHeaders {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(e.status)
+	w.Write(e.respBody)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonEqual(want any, got []byte) bool {
+	var wantRaw []byte
+	switch w := want.(type) {
+	case json.RawMessage:
+		wantRaw = w
+	case []byte:
+		wantRaw = w
+	case string:
+		wantRaw = []byte(w)
+	default:
+		var err error
+		wantRaw, err = json.Marshal(want)
+		if err != nil {
+			return false
+		}
+	}
+
+	var wantValue, gotValue any
+	if json.Unmarshal(wantRaw, &wantValue) != nil {
+		return false
+	}
+	if json.Unmarshal(bytes.TrimSpace(got), &gotValue) != nil {
+		return false
+	}
+	return reflect.DeepEqual(wantValue, gotValue)
+}
+
+func describeRequest(r *http.Request, body []byte) string {
+	s := r.Method + " " + r.URL.RequestURI()
+	if len(body) > 0 {
+		s += " " + strings.TrimSpace(string(body))
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+// Package httpxmock provides an in-process HTTP server with an expectation DSL,
+// for testing code built on httpx.XClient.
+//
+// Example:
+//
+//	func TestGetUser(t *testing.T) {
+//	    srv := httpxmock.New(t)
+//	    srv.Expect(http.MethodGet, "/users").
+//	        WithQuery("id", "1").
+//	        WithHeader("Authorization", "Bearer token").
+//	        RespondJSON(http.StatusOK, User{Name: "John"})
+//
+//	    client := srv.XClient(httpx.WithBearerAuth("token"))
+//	    var user User
+//	    err := client.GetJSON(ctx, "https://api.example.com/users", &user, httpx.WithQuery("id", "1"))
+//	    require.NoError(t, err)
+//	}
+//
+// All expectations are verified when the test finishes.
+package httpxmock
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+)
+
+// Server is an in-process HTTP server that replies to requests matching its expectations.
+// Requests that match no expectation fail the test and get a 404 response.
+type Server struct {
+	*httptest.Server
+	t testing.TB
+
+	mu           sync.Mutex
+	expectations []*Expectation
+}
+
+// New starts a Server. The server is closed and all expectations are
+// verified on t.Cleanup.
+func New(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(func() {
+		s.Close()
+		s.Verify()
+	})
+	return s
+}
+
+// Expect adds an expectation of a request with method and path.
+// Expectations are matched in the order they are added, and an expectation
+// that reached its call count is skipped.
+func (s *Server) Expect(method, path string) *Expectation {
+	e := newExpectation(method, path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// Verify fails the test for every expectation whose call count is not met.
+// It is called automatically on t.Cleanup.
+func (s *Server) Verify() {
+	s.t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.expectations {
+		if msg := e.verify(); msg != "" {
+			s.t.Errorf("httpxmock: %s", msg)
+		}
+	}
+}
+
+// XClient returns an XClient that sends all requests to the server,
+// whatever the scheme and host of the request URL are.
+// So the code under test can keep its real URLs.
+//
+// The default options of XClient are applied unless httpx.WithoutDefaultOption is given.
+// Each call returns a client of its own, so options of one client do not affect another.
+func (s *Server) XClient(opts ...httpx.XClientOption) *httpx.XClient {
+	opts = append([]httpx.XClientOption{s.redirectOption()}, opts...)
+	// the options modify the http.Client, do not share s.Client()
+	return httpx.NewXClientFromHttp(&http.Client{Transport: s.Client().Transport}, opts...)
+}
+
+func (s *Server) redirectOption() httpx.ClientOption {
+	target, _ := url.Parse(s.URL)
+	return func(cli *http.Client) *http.Client {
+		base := cli.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		cli.Transport = &redirectTransport{base: base, target: target}
+		return cli
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.t.Errorf("httpxmock: read request body: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	var matched *Expectation
+	for _, e := range s.expectations {
+		if e.match(r, body) && e.take() {
+			matched = e
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if matched == nil {
+		s.t.Errorf("httpxmock: unexpected request: %s", describeRequest(r, body))
+		http.Error(w, "httpxmock: unexpected request", http.StatusNotFound)
+		return
+	}
+	matched.respond(w, r)
+}
+
+// redirectTransport sends every request to target.
+type redirectTransport struct {
+	base   http.RoundTripper
+	target *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req2 := req.Clone(req.Context())
+	req2.URL.Scheme = t.target.Scheme
+	req2.URL.Host = t.target.Host
+	req2.Host = t.target.Host
+	return t.base.RoundTrip(req2)
+}
@@ -0,0 +1,120 @@
+package httpxmock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/require"
+)
+
+// recordT records the failures instead of failing the test,
+// and runs the cleanups when finish is called.
+type recordT struct {
+	testing.TB
+	mu       sync.Mutex
+	errs     []string
+	cleanups []func()
+}
+
+func (r *recordT) Helper() {}
+
+func (r *recordT) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recordT) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recordT) finish() []string {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+	return r.errs
+}
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestServer(t *testing.T) {
+	srv := New(t)
+	srv.Expect(http.MethodGet, "/users").
+		WithQuery("id", "1").
+		WithHeader("Authorization", "Bearer token").
+		RespondJSON(http.StatusOK, user{ID: 1, Name: "John"})
+	srv.Expect(http.MethodPost, "/users").
+		WithJSONBody(`{"name": "Jane", "id": 2}`).
+		RespondJSON(http.StatusCreated, user{ID: 2, Name: "Jane"}).
+		Times(2)
+
+	client := srv.XClient(httpx.WithBearerAuth("token"))
+	ctx := context.Background()
+
+	var got user
+	err := client.GetJSON(ctx, "https://api.example.com/users", &got, httpx.WithQuery("id", "1"))
+	require.NoError(t, err)
+	require.Equal(t, user{ID: 1, Name: "John"}, got)
+
+	for i := 0; i < 2; i++ {
+		err = client.PostJSON(ctx, "https://api.example.com/users", user{ID: 2, Name: "Jane"}, &got)
+		require.NoError(t, err)
+		require.Equal(t, "Jane", got.Name)
+	}
+}
+
+func TestServerDelay(t *testing.T) {
+	srv := New(t)
+	srv.Expect(http.MethodGet, "/slow").Delay(time.Second)
+
+	client := srv.XClient(httpx.WithTimeout(10 * time.Millisecond))
+	_, err := client.Get(context.Background(), srv.URL+"/slow")
+	require.Error(t, err)
+}
+
+func TestServerXClientsIndependent(t *testing.T) {
+	srv := New(t)
+	srv.Expect(http.MethodGet, "/slow").Delay(50 * time.Millisecond).Times(2)
+
+	fast := srv.XClient(httpx.WithTimeout(10 * time.Millisecond))
+	patient := srv.XClient(httpx.WithBearerAuth("token"))
+	ctx := context.Background()
+
+	_, err := fast.Get(ctx, "https://api.example.com/slow")
+	require.Error(t, err)
+	_, err = patient.Get(ctx, "https://api.example.com/slow")
+	require.NoError(t, err) // the timeout of fast is not shared
+	require.Zero(t, srv.Client().Timeout)
+}
+
+func TestServerReportsFailures(t *testing.T) {
+	rt := &recordT{TB: t}
+	srv := New(rt)
+	srv.Expect(http.MethodGet, "/called-once")
+	srv.Expect(http.MethodGet, "/never-called")
+	srv.Expect(http.MethodGet, "/any").AnyTimes()
+
+	client := srv.XClient()
+	ctx := context.Background()
+
+	_, err := client.GetBytes(ctx, srv.URL+"/called-once")
+	require.NoError(t, err)
+	_, err = client.GetBytes(ctx, srv.URL+"/called-once") // exhausted
+	var xerr *httpx.XError
+	require.ErrorAs(t, err, &xerr)
+	require.Equal(t, http.StatusNotFound, xerr.Code)
+
+	errs := rt.finish()
+	require.Equal(t, []string{
+		"httpxmock: unexpected request: GET /called-once",
+		"httpxmock: GET /never-called: expected 1 calls, got 0",
+	}, errs)
+}
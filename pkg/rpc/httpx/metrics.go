@@ -0,0 +1,139 @@
+package httpx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metric names recorded by WithMetrics.
+const (
+	MetricRequestsTotal    = "httpx_client_requests_total"
+	MetricRequestDuration  = "httpx_client_request_duration_seconds"
+	MetricRequestsInFlight = "httpx_client_requests_in_flight"
+	MetricResponseSize     = "httpx_client_response_size_bytes"
+)
+
+// MetricLabels are the labels attached to every metric recorded by WithMetrics.
+// StatusClass is empty for the in-flight gauge, which is recorded before the
+// response is known.
+type MetricLabels struct {
+	Method      string
+	Host        string
+	Route       string
+	StatusClass string // "2xx", "4xx", ... or "error" for transport errors
+}
+
+// MetricsSink receives the metrics recorded by WithMetrics.
+// Implementations must be safe for concurrent use.
+// It is kept small on purpose so that it can be adapted to any metrics backend.
+type MetricsSink interface {
+	IncCounter(name string, labels MetricLabels)
+	AddGauge(name string, labels MetricLabels, delta float64)
+	ObserveHistogram(name string, labels MetricLabels, value float64)
+}
+
+type routeCtxKey struct{}
+
+// ContextWithRoute returns a context carrying the route template of a request,
+// e.g. "/users/{id}". The route template is used as the "route" label by WithMetrics.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeCtxKey{}, route)
+}
+
+// RouteFromContext returns the route template set by ContextWithRoute or WithRoute.
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeCtxKey{}).(string)
+	return route
+}
+
+// WithRoute sets the route template of the request, which is used as the "route"
+// label by WithMetrics. Use a template instead of the real path to keep the
+// label cardinality low.
+//
+// Example:
+//
+//	err := client.GetJSON(ctx, "https://api.example.com/users/123", &user,
+//	    WithRoute("/users/{id}"))
+func WithRoute(route string) XRequestOption {
+	return func(sgc *xRequestOpts) {
+		sgc.addApplyRequest(func(r *http.Request) {
+			*r = *r.WithContext(ContextWithRoute(r.Context(), route))
+		})
+	}
+}
+
+// WithMetrics records Prometheus-style metrics for every request into the sink:
+//   - httpx_client_requests_total: counter of finished requests
+//   - httpx_client_request_duration_seconds: histogram of the time until response headers are received
+//   - httpx_client_requests_in_flight: gauge of requests waiting for response headers
+//   - httpx_client_response_size_bytes: histogram of response body sizes, recorded when the body is closed
+//
+// All metrics are labelled by method, host, route template (see WithRoute) and status class.
+//
+// Example:
+//
+//	sink := NewMemoryMetricsSink()
+//	client := NewXClient(WithMetrics(sink))
+func WithMetrics(sink MetricsSink) ClientDecorator {
+	return func(inner Client) Client {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			labels := MetricLabels{
+				Method: req.Method,
+				Host:   req.URL.Host,
+				Route:  RouteFromContext(req.Context()),
+			}
+
+			sink.AddGauge(MetricRequestsInFlight, labels, 1)
+			start := time.Now()
+			resp, err := inner.Do(req)
+			elapsed := time.Since(start)
+			sink.AddGauge(MetricRequestsInFlight, labels, -1)
+
+			labels.StatusClass = statusClass(resp, err)
+			sink.IncCounter(MetricRequestsTotal, labels)
+			sink.ObserveHistogram(MetricRequestDuration, labels, elapsed.Seconds())
+
+			if err != nil || resp == nil || resp.Body == nil {
+				return resp, err
+			}
+			resp.Body = &sizeRecordingBody{
+				ReadCloser: resp.Body,
+				record: func(size int64) {
+					sink.ObserveHistogram(MetricResponseSize, labels, float64(size))
+				},
+			}
+			return resp, nil
+		})
+	}
+}
+
+func statusClass(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode/100) + "xx"
+}
+
+// sizeRecordingBody counts the bytes read from the body,
+// and records the size once when the body is closed.
+type sizeRecordingBody struct {
+	io.ReadCloser
+	size   int64
+	once   sync.Once
+	record func(size int64)
+}
+
+func (b *sizeRecordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *sizeRecordingBody) Close() error {
+	b.once.Do(func() { b.record(b.size) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,252 @@
+package httpx
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultMetricsBuckets are the histogram buckets used by NewMemoryMetricsSink
+// when no buckets are given. They are the same as Prometheus' default buckets.
+var DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricKind string
+
+const (
+	metricKindCounter   metricKind = "counter"
+	metricKindGauge     metricKind = "gauge"
+	metricKindHistogram metricKind = "histogram"
+)
+
+type metricKey struct {
+	name   string
+	labels MetricLabels
+}
+
+// HistogramSnapshot is a point-in-time copy of a histogram in MemoryMetricsSink.
+// Counts[i] is the number of observations less than or equal to Buckets[i],
+// not including the observations counted in the previous buckets.
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+// MemoryMetricsSink is a MetricsSink that keeps all metrics in memory.
+// It is useful in tests, and can expose the metrics in the Prometheus text
+// exposition format through WriteText or as an http.Handler.
+type MemoryMetricsSink struct {
+	mu         sync.Mutex
+	buckets    []float64
+	kinds      map[string]metricKind
+	counters   map[metricKey]float64
+	gauges     map[metricKey]float64
+	histograms map[metricKey]*HistogramSnapshot
+}
+
+var _ MetricsSink = (*MemoryMetricsSink)(nil)
+
+// NewMemoryMetricsSink creates a MemoryMetricsSink with the given histogram buckets.
+// If no buckets are given, DefaultMetricsBuckets is used.
+func NewMemoryMetricsSink(buckets ...float64) *MemoryMetricsSink {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &MemoryMetricsSink{
+		buckets:    buckets,
+		kinds:      make(map[string]metricKind),
+		counters:   make(map[metricKey]float64),
+		gauges:     make(map[metricKey]float64),
+		histograms: make(map[metricKey]*HistogramSnapshot),
+	}
+}
+
+func (s *MemoryMetricsSink) IncCounter(name string, labels MetricLabels) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[name] = metricKindCounter
+	s.counters[metricKey{name, labels}]++
+}
+
+func (s *MemoryMetricsSink) AddGauge(name string, labels MetricLabels, delta float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[name] = metricKindGauge
+	s.gauges[metricKey{name, labels}] += delta
+}
+
+func (s *MemoryMetricsSink) ObserveHistogram(name string, labels MetricLabels, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.kinds[name] = metricKindHistogram
+	key := metricKey{name, labels}
+	h, ok := s.histograms[key]
+	if !ok {
+		h = &HistogramSnapshot{
+			Buckets: s.buckets,
+			Counts:  make([]uint64, len(s.buckets)),
+		}
+		s.histograms[key] = h
+	}
+	h.Count++
+	h.Sum += value
+	if i := sort.SearchFloat64s(s.buckets, value); i < len(s.buckets) {
+		h.Counts[i]++
+	}
+}
+
+// Counter returns the current value of a counter, or 0 if it was never incremented.
+func (s *MemoryMetricsSink) Counter(name string, labels MetricLabels) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[metricKey{name, labels}]
+}
+
+// Gauge returns the current value of a gauge, or 0 if it was never set.
+func (s *MemoryMetricsSink) Gauge(name string, labels MetricLabels) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gauges[metricKey{name, labels}]
+}
+
+// Histogram returns a copy of a histogram.
+// The returned snapshot is empty if nothing was observed.
+func (s *MemoryMetricsSink) Histogram(name string, labels MetricLabels) HistogramSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.histograms[metricKey{name, labels}]
+	if !ok {
+		return HistogramSnapshot{Buckets: s.buckets, Counts: make([]uint64, len(s.buckets))}
+	}
+	snapshot := *h
+	snapshot.Counts = append([]uint64(nil), h.Counts...)
+	return snapshot
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+// Metrics are sorted by name and labels, so the output is stable.
+//
+// Example output:
+//
+//	# TYPE httpx_client_requests_total counter
+//	httpx_client_requests_total{method="GET",host="api.example.com",route="/users/{id}",status_class="2xx"} 3
+func (s *MemoryMetricsSink) WriteText(w io.Writer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.kinds))
+	for name := range s.kinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &strings.Builder{}
+	for _, name := range names {
+		kind := s.kinds[name]
+		fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+		switch kind {
+		case metricKindCounter:
+			writeSamples(buf, name, s.counters)
+		case metricKindGauge:
+			writeSamples(buf, name, s.gauges)
+		case metricKindHistogram:
+			for _, key := range sortedKeys(name, s.histograms) {
+				h := s.histograms[key]
+				var cumulative uint64
+				for i, le := range h.Buckets {
+					cumulative += h.Counts[i]
+					fmt.Fprintf(buf, "%s_bucket%s %d\n", name, formatLabels(key.labels, formatFloat(le)), cumulative)
+				}
+				fmt.Fprintf(buf, "%s_bucket%s %d\n", name, formatLabels(key.labels, "+Inf"), h.Count)
+				fmt.Fprintf(buf, "%s_sum%s %s\n", name, formatLabels(key.labels, ""), formatFloat(h.Sum))
+				fmt.Fprintf(buf, "%s_count%s %d\n", name, formatLabels(key.labels, ""), h.Count)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format,
+// so that the sink can be mounted as a /metrics endpoint.
+func (s *MemoryMetricsSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = s.WriteText(w)
+}
+
+func writeSamples(buf *strings.Builder, name string, samples map[metricKey]float64) {
+	for _, key := range sortedKeys(name, samples) {
+		fmt.Fprintf(buf, "%s%s %s\n", name, formatLabels(key.labels, ""), formatFloat(samples[key]))
+	}
+}
+
+func sortedKeys[V any](name string, samples map[metricKey]V) []metricKey {
+	keys := make([]metricKey, 0, len(samples))
+	for key := range samples {
+		if key.name == name {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].labels, keys[j].labels
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.StatusClass < b.StatusClass
+	})
+	return keys
+}
+
+// formatLabels formats the labels as {k="v",...}.
+// Empty labels are omitted, and le is appended for histogram buckets if not empty.
+func formatLabels(labels MetricLabels, le string) string {
+	pairs := []struct{ k, v string }{
+		{"method", labels.Method},
+		{"host", labels.Host},
+		{"route", labels.Route},
+		{"status_class", labels.StatusClass},
+		{"le", le},
+	}
+	parts := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		if p.v == "" {
+			continue
+		}
+		parts = append(parts, p.k+`="`+escapeLabelValue(p.v)+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,95 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/404" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	host := mustParseURL(t, server.URL).Host
+
+	sink := NewMemoryMetricsSink(1, 10)
+	client := NewXClient(WithMetrics(sink))
+
+	ctx := context.Background()
+	body, err := client.GetBytes(ctx, server.URL+"/users/1", WithRoute("/users/{id}"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(body))
+
+	_, err = client.GetBytes(ctx, server.URL+"/users/404", WithRoute("/users/{id}"))
+	require.Error(t, err)
+
+	ok := MetricLabels{Method: "GET", Host: host, Route: "/users/{id}", StatusClass: "2xx"}
+	notFound := MetricLabels{Method: "GET", Host: host, Route: "/users/{id}", StatusClass: "4xx"}
+	inFlight := MetricLabels{Method: "GET", Host: host, Route: "/users/{id}"}
+
+	require.Equal(t, float64(1), sink.Counter(MetricRequestsTotal, ok))
+	require.Equal(t, float64(1), sink.Counter(MetricRequestsTotal, notFound))
+	require.Equal(t, float64(0), sink.Gauge(MetricRequestsInFlight, inFlight))
+	require.Equal(t, uint64(1), sink.Histogram(MetricRequestDuration, ok).Count)
+
+	size := sink.Histogram(MetricResponseSize, ok)
+	require.Equal(t, uint64(1), size.Count)
+	require.Equal(t, float64(5), size.Sum)
+	require.Equal(t, []uint64{0, 1}, size.Counts)
+}
+
+func TestWithMetricsTransportError(t *testing.T) {
+	sink := NewMemoryMetricsSink()
+	client := NewXClientFromHttp(&http.Client{
+		Transport: &ErrorTransport{},
+	}, WithoutDefaultOption(), WithMetrics(sink))
+
+	_, err := client.Get(context.Background(), "http://example.com/a")
+	require.Error(t, err)
+
+	labels := MetricLabels{Method: "GET", Host: "example.com", StatusClass: "error"}
+	require.Equal(t, float64(1), sink.Counter(MetricRequestsTotal, labels))
+	require.Equal(t, uint64(0), sink.Histogram(MetricResponseSize, labels).Count)
+}
+
+func TestMemoryMetricsSinkWriteText(t *testing.T) {
+	sink := NewMemoryMetricsSink(0.5, 1)
+	labels := MetricLabels{Method: "GET", Host: "example.com", Route: `/a"b`, StatusClass: "2xx"}
+	sink.IncCounter(MetricRequestsTotal, labels)
+	sink.IncCounter(MetricRequestsTotal, labels)
+	sink.AddGauge(MetricRequestsInFlight, MetricLabels{Method: "GET", Host: "example.com"}, 1)
+	sink.ObserveHistogram(MetricRequestDuration, labels, 0.2)
+	sink.ObserveHistogram(MetricRequestDuration, labels, 2)
+
+	buf := &strings.Builder{}
+	require.NoError(t, sink.WriteText(buf))
+
+	want := `# TYPE httpx_client_request_duration_seconds histogram
+httpx_client_request_duration_seconds_bucket{method="GET",host="example.com",route="/a\"b",status_class="2xx",le="0.5"} 1
+httpx_client_request_duration_seconds_bucket{method="GET",host="example.com",route="/a\"b",status_class="2xx",le="1"} 1
+httpx_client_request_duration_seconds_bucket{method="GET",host="example.com",route="/a\"b",status_class="2xx",le="+Inf"} 2
+httpx_client_request_duration_seconds_sum{method="GET",host="example.com",route="/a\"b",status_class="2xx"} 2.2
+httpx_client_request_duration_seconds_count{method="GET",host="example.com",route="/a\"b",status_class="2xx"} 2
+# TYPE httpx_client_requests_in_flight gauge
+httpx_client_requests_in_flight{method="GET",host="example.com"} 1
+# TYPE httpx_client_requests_total counter
+httpx_client_requests_total{method="GET",host="example.com",route="/a\"b",status_class="2xx"} 2
+`
+	require.Equal(t, want, buf.String())
+}
+
+func mustParseURL(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	return u
+}
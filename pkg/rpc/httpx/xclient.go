@@ -78,6 +78,18 @@ func NewXClientFromInterface(httpCli Client, opts ...XClientOption) *XClient {
 	}
 }
 
+// HTTPClient returns an *http.Client sending requests through c with all its options,
+// for third-party SDKs that only accept *http.Client. Non-2xx responses are passed
+// through, see NewRoundTripper.
+//
+// Example:
+//
+//	client := httpx.NewXClient(oauth2x.WithOAuth2Http(ctx, token, source))
+//	sdk := thirdparty.NewClient(client.HTTPClient())
+func (c *XClient) HTTPClient() *http.Client {
+	return &http.Client{Transport: NewRoundTripper(c.inner)}
+}
+
 func (c *XClient) Do(req *http.Request, opts ...XRequestOption) (*http.Response, error) {
 	cfg := xRequestOpts{}
 	for _, opt := range opts {
@@ -169,6 +181,7 @@ func (c *XClient) PostJSON(ctx context.Context, url string, request any, respons
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	return json.NewDecoder(resp.Body).Decode(response)
 }
@@ -0,0 +1,169 @@
+package jsonrpcx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+)
+
+// Batch collects calls and notifications and sends them in one HTTP request.
+// The responses are correlated to the calls by ID, so the server may
+// reply in any order.
+//
+// A Batch is sent once, and is not safe for concurrent use.
+//
+// Example:
+//
+//	batch := rpcCli.NewBatch()
+//	user := jsonrpcx.AddCall[GetUserReq, User](batch, "user.get", GetUserReq{ID: 1})
+//	count := jsonrpcx.AddCall[any, int](batch, "user.count", nil)
+//	batch.Notify("user.touch", TouchReq{ID: 1})
+//	if err := batch.Do(ctx); err != nil {
+//	    return err // transport error, or the whole batch was rejected
+//	}
+//	u, err := user.Result() // per-call result or *Error
+type Batch struct {
+	c       *Client
+	reqs    []request
+	pending map[uint64]batchEntry
+	err     error
+	sent    bool
+}
+
+// batchEntry is the type-erased BatchCall stored in Batch.
+type batchEntry interface {
+	resolve(result json.RawMessage, err error)
+}
+
+// BatchCall is the pending result of a call added to a Batch.
+// Its result is available after Batch.Do returns.
+type BatchCall[Resp any] struct {
+	result Resp
+	err    error
+}
+
+func (c *BatchCall[Resp]) resolve(result json.RawMessage, err error) {
+	if err != nil {
+		c.err = err
+		return
+	}
+	c.err = decodeResult(result, &c.result)
+}
+
+// Result returns the result of the call.
+// If the server returns a JSON-RPC error object for the call, the error is *Error.
+// If the server does not respond to the call, the error is ErrNoResponse.
+func (c *BatchCall[Resp]) Result() (Resp, error) {
+	return c.result, c.err
+}
+
+// NewBatch creates an empty Batch on the client.
+func (c *Client) NewBatch() *Batch {
+	return &Batch{
+		c:       c,
+		pending: make(map[uint64]batchEntry),
+	}
+}
+
+// AddCall adds a call to the batch and returns its pending result.
+// It is a function instead of a method because methods cannot have type parameters.
+func AddCall[Req any, Resp any](b *Batch, method string, params Req) *BatchCall[Resp] {
+	call := &BatchCall[Resp]{err: ErrNoResponse}
+	id := b.c.newID()
+	req, err := newRequest(id, method, params)
+	if err != nil {
+		call.err = err
+		b.setErr(err)
+		return call
+	}
+	b.reqs = append(b.reqs, req)
+	b.pending[*id] = call
+	return call
+}
+
+// Notify adds a notification to the batch.
+func (b *Batch) Notify(method string, params any) {
+	req, err := newRequest(nil, method, params)
+	if err != nil {
+		b.setErr(err)
+		return
+	}
+	b.reqs = append(b.reqs, req)
+}
+
+// Len returns the number of calls and notifications in the batch.
+func (b *Batch) Len() int {
+	return len(b.reqs)
+}
+
+func (b *Batch) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Do sends the batch and resolves all the calls.
+// It returns an error only if the batch could not be sent, or the server
+// rejected the batch as a whole. Errors of each call are returned by BatchCall.Result.
+// Do sends the batch once; later calls return ErrBatchSent, even if the first one failed,
+// as the server may have run the requests.
+func (b *Batch) Do(ctx context.Context, opts ...httpx.XRequestOption) error {
+	if b.sent {
+		return ErrBatchSent
+	}
+	if b.err != nil {
+		return b.err
+	}
+	b.sent = true
+	if len(b.reqs) == 0 {
+		return nil
+	}
+
+	raw, err := b.c.post(ctx, b.reqs, opts...)
+	if err != nil {
+		return err
+	}
+	if len(b.pending) == 0 {
+		return nil // only notifications, the server does not reply
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '{' {
+		// a single response object means the whole batch is rejected
+		var resp response
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			return fmt.Errorf("jsonrpc: decode batch response: %w", err)
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return fmt.Errorf("jsonrpc: unexpected non-array batch response: %s", raw)
+	}
+
+	var resps []response
+	if err := json.Unmarshal(raw, &resps); err != nil {
+		return fmt.Errorf("jsonrpc: decode batch response: %w", err)
+	}
+	for _, resp := range resps {
+		var id uint64
+		if err := json.Unmarshal(resp.ID, &id); err != nil {
+			continue // e.g. null id for a request the server could not parse
+		}
+		call, ok := b.pending[id]
+		if !ok {
+			continue
+		}
+		switch err := resp.validate(); {
+		case err != nil:
+			call.resolve(nil, err)
+		case resp.Error != nil:
+			call.resolve(nil, resp.Error)
+		default:
+			call.resolve(resp.Result, nil)
+		}
+	}
+	return nil
+}
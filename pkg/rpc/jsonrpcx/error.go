@@ -0,0 +1,65 @@
+package jsonrpcx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Error codes defined by the JSON-RPC 2.0 specification.
+// Codes from -32000 to -32099 are reserved for implementation-defined server errors.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+var (
+	// ErrNoResponse is returned for a call in a batch
+	// when the server does not return a response with the call's ID.
+	ErrNoResponse = errors.New("jsonrpc: no response for request")
+
+	// ErrIDMismatch is returned when the ID of the response
+	// does not match the ID of the request.
+	ErrIDMismatch = errors.New("jsonrpc: response id mismatch")
+
+	// ErrInvalidResponse is returned when a response has neither a result nor an error,
+	// or has both, which the JSON-RPC 2.0 specification forbids.
+	ErrInvalidResponse = errors.New("jsonrpc: invalid response")
+
+	// ErrBatchSent is returned by Batch.Do when the batch was already sent,
+	// as sending it again would repeat the calls and the notifications.
+	ErrBatchSent = errors.New("jsonrpc: batch already sent")
+)
+
+// Error is a JSON-RPC 2.0 error object returned by the server.
+// Use errors.As to get it from the error returned by Call.
+//
+// Example:
+//
+//	var rpcErr *jsonrpcx.Error
+//	if errors.As(err, &rpcErr) && rpcErr.Code == jsonrpcx.CodeMethodNotFound {
+//	    // ...
+//	}
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("jsonrpc error %d: %s: %s", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// DecodeData unmarshals the optional data member of the error into v.
+func (e *Error) DecodeData(v any) error {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(e.Data, v)
+}
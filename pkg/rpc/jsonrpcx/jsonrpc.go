@@ -0,0 +1,217 @@
+package jsonrpcx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+)
+
+const version = "2.0"
+
+// request is a JSON-RPC 2.0 request object.
+// A request without ID is a notification.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *uint64         `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// response is a JSON-RPC 2.0 response object.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+}
+
+// Client is a JSON-RPC 2.0 client over HTTP.
+// It sends requests through an httpx.Client, so it composes with
+// the decorators of httpx and oauth2x, e.g. otel, auth and retry.
+// It is safe for concurrent use.
+type Client struct {
+	endpoint string
+	cli      *httpx.XClient
+	nextID   atomic.Uint64
+}
+
+// NewClient creates a JSON-RPC client that posts requests to endpoint through cli.
+// The cli is used as is, no default httpx options will be added.
+//
+// Example:
+//
+//	rpcCli := jsonrpcx.NewClient("https://rpc.example.com",
+//	    httpx.NewClient(httpx.WithBearerAuth("token")))
+//	resp, err := jsonrpcx.Call[GetUserReq, User](ctx, rpcCli, "user.get", GetUserReq{ID: 1})
+func NewClient(endpoint string, cli httpx.Client) *Client {
+	return &Client{
+		endpoint: endpoint,
+		cli:      httpx.NewXClientFromInterface(cli, httpx.WithoutDefaultOption()),
+	}
+}
+
+func (c *Client) newID() *uint64 {
+	id := c.nextID.Add(1)
+	return &id
+}
+
+// Call calls the remote method with params and decodes the result into Resp.
+// If the server returns a JSON-RPC error object, the returned error is *Error,
+// see errors.As. A non-2xx HTTP status is returned as *httpx.XError, and a response
+// of another id, or without result and error, as ErrIDMismatch or ErrInvalidResponse.
+//
+// Params must marshal to a JSON object or array. A nil params will be omitted.
+//
+// Example:
+//
+//	type AddReq [2]int
+//	sum, err := jsonrpcx.Call[AddReq, int](ctx, rpcCli, "add", AddReq{1, 2})
+func Call[Req any, Resp any](ctx context.Context, c *Client, method string, params Req, opts ...httpx.XRequestOption) (Resp, error) {
+	var result Resp
+
+	req, err := newRequest(c.newID(), method, params)
+	if err != nil {
+		return result, err
+	}
+
+	raw, err := c.post(ctx, req, opts...)
+	if err != nil {
+		return result, err
+	}
+
+	var resp response
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return result, fmt.Errorf("jsonrpc: decode response: %w", err)
+	}
+	if !matchID(resp.ID, *req.ID) {
+		// the server replies a null id to a request it could not read the id of
+		if resp.Error != nil && isNull(resp.ID) {
+			return result, resp.Error
+		}
+		return result, fmt.Errorf("%w: want %d, got %s", ErrIDMismatch, *req.ID, resp.ID)
+	}
+	if err := resp.validate(); err != nil {
+		return result, err
+	}
+	if resp.Error != nil {
+		return result, resp.Error
+	}
+	if err := decodeResult(resp.Result, &result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Notify sends a notification, which is a request the server does not reply to.
+// Any response body returned by the server is discarded, but a non-2xx HTTP status
+// is returned as *httpx.XError.
+func (c *Client) Notify(ctx context.Context, method string, params any, opts ...httpx.XRequestOption) error {
+	req, err := newRequest(nil, method, params)
+	if err != nil {
+		return err
+	}
+	_, err = c.post(ctx, req, opts...)
+	return err
+}
+
+// post sends the payload and returns the raw response body.
+// A non-2xx status is returned as *httpx.XError, wrapping the JSON-RPC error object
+// if the body is one, whether the status is checked here or by the httpx.Client.
+func (c *Client) post(ctx context.Context, payload any, opts ...httpx.XRequestOption) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append([]httpx.XRequestOption{httpx.WithHeader("Accept", "application/json")}, opts...)
+	resp, err := c.cli.Post(ctx, c.endpoint, "application/json", bytes.NewReader(body), opts...)
+	if err != nil {
+		var xerr *httpx.XError
+		if errors.As(err, &xerr) {
+			return nil, statusError(xerr)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, statusError(&httpx.XError{
+			Response: resp,
+			Method:   http.MethodPost,
+			Code:     resp.StatusCode,
+			Body:     raw,
+		})
+	}
+	return raw, nil
+}
+
+// statusError returns the error of a non-2xx response, with the JSON-RPC error
+// object of the body if any, so that both errors.As *Error and *httpx.XError work.
+func statusError(xerr *httpx.XError) error {
+	var errResp response
+	if json.Unmarshal(xerr.Body, &errResp) == nil && errResp.Error != nil {
+		return fmt.Errorf("%w: %w", errResp.Error, xerr)
+	}
+	return xerr
+}
+
+func newRequest(id *uint64, method string, params any) (request, error) {
+	req := request{
+		JSONRPC: version,
+		ID:      id,
+		Method:  method,
+	}
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return req, fmt.Errorf("jsonrpc: encode params of %s: %w", method, err)
+	}
+	if string(rawParams) != "null" {
+		req.Params = rawParams
+	}
+	return req, nil
+}
+
+// validate checks the response has either a result or an error.
+// A null result along with an error is taken as no result, as some servers send it.
+func (r *response) validate() error {
+	switch {
+	case r.Error != nil && !isNull(r.Result):
+		return fmt.Errorf("%w: id %s has both result and error", ErrInvalidResponse, r.ID)
+	case r.Error == nil && len(r.Result) == 0:
+		return fmt.Errorf("%w: id %s has neither result nor error", ErrInvalidResponse, r.ID)
+	}
+	return nil
+}
+
+func decodeResult(raw json.RawMessage, result any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, result); err != nil {
+		return fmt.Errorf("jsonrpc: decode result: %w", err)
+	}
+	return nil
+}
+
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+func matchID(raw json.RawMessage, id uint64) bool {
+	var got uint64
+	if err := json.Unmarshal(raw, &got); err != nil {
+		return false
+	}
+	return got == id
+}
@@ -0,0 +1,262 @@
+package jsonrpcx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockServer serves "add" with [a, b] params, and replies
+// method-not-found to other methods. Notifications are counted.
+func newMockServer(t *testing.T, notified *atomic.Int32) *httptest.Server {
+	handle := func(req request) *response {
+		if req.ID == nil {
+			notified.Add(1)
+			return nil
+		}
+		id, _ := json.Marshal(*req.ID)
+		resp := &response{JSONRPC: version, ID: id}
+		switch req.Method {
+		case "add":
+			var params [2]int
+			require.NoError(t, json.Unmarshal(req.Params, &params))
+			resp.Result, _ = json.Marshal(params[0] + params[1])
+		default:
+			resp.Error = &Error{Code: CodeMethodNotFound, Message: "method not found"}
+		}
+		return resp
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		if body[0] == '[' {
+			var reqs []request
+			require.NoError(t, json.Unmarshal(body, &reqs))
+			resps := []*response{}
+			for i := len(reqs) - 1; i >= 0; i-- { // reply in reverse order
+				if resp := handle(reqs[i]); resp != nil {
+					resps = append(resps, resp)
+				}
+			}
+			if len(resps) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			json.NewEncoder(w).Encode(resps)
+			return
+		}
+
+		var req request
+		require.NoError(t, json.Unmarshal(body, &req))
+		if resp := handle(req); resp != nil {
+			json.NewEncoder(w).Encode(resp)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestCall(t *testing.T) {
+	notified := &atomic.Int32{}
+	server := newMockServer(t, notified)
+	defer server.Close()
+	ctx := context.Background()
+	cli := NewClient(server.URL, http.DefaultClient)
+
+	sum, err := Call[[2]int, int](ctx, cli, "add", [2]int{1, 2})
+	require.NoError(t, err)
+	require.Equal(t, 3, sum)
+
+	_, err = Call[any, int](ctx, cli, "sub", nil)
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, CodeMethodNotFound, rpcErr.Code)
+
+	require.NoError(t, cli.Notify(ctx, "touch", map[string]int{"id": 1}))
+	require.Equal(t, int32(1), notified.Load())
+}
+
+func TestCallErrorWithNon2xx(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":null,"error":{"code":-32603,"message":"internal error","data":"boom"}}`))
+	}))
+	defer server.Close()
+
+	cli := NewClient(server.URL, httpx.WithReturnErrorIfNot2xx()(http.DefaultClient))
+	_, err := Call[any, int](context.Background(), cli, "add", nil)
+
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, CodeInternalError, rpcErr.Code)
+	var data string
+	require.NoError(t, rpcErr.DecodeData(&data))
+	require.Equal(t, "boom", data)
+}
+
+func TestCallHTTPStatus(t *testing.T) {
+	var status atomic.Int32
+	var body atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	cli := NewClient(server.URL, http.DefaultClient)
+
+	// not checked by the httpx.Client
+	status.Store(http.StatusBadGateway)
+	body.Store("<html>bad gateway</html>")
+	_, err := Call[any, int](ctx, cli, "add", nil)
+	var xerr *httpx.XError
+	require.ErrorAs(t, err, &xerr)
+	require.Equal(t, http.StatusBadGateway, xerr.Code)
+
+	status.Store(http.StatusInternalServerError)
+	body.Store("")
+	err = cli.Notify(ctx, "touch", nil)
+	require.ErrorAs(t, err, &xerr)
+	require.Equal(t, http.StatusInternalServerError, xerr.Code)
+
+	body.Store(`{"jsonrpc":"2.0","id":null,"error":{"code":-32603,"message":"internal error"}}`)
+	_, err = Call[any, int](ctx, cli, "add", nil)
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, CodeInternalError, rpcErr.Code)
+	require.ErrorAs(t, err, &xerr)
+	require.Equal(t, http.StatusInternalServerError, xerr.Code)
+}
+
+func TestCallInvalidResponse(t *testing.T) {
+	// ID in the response is replaced by the id of the request
+	var body atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		w.Write([]byte(strings.ReplaceAll(body.Load().(string), "ID", fmt.Sprint(*req.ID))))
+	}))
+	defer server.Close()
+	cli := NewClient(server.URL, http.DefaultClient)
+	call := func(resp string) error {
+		body.Store(resp)
+		_, err := Call[any, int](context.Background(), cli, "add", nil)
+		return err
+	}
+
+	// the id is checked before the error
+	err := call(`{"jsonrpc":"2.0","id":12345,"result":1}`)
+	require.True(t, errors.Is(err, ErrIDMismatch))
+	err = call(`{"jsonrpc":"2.0","id":12345,"error":{"code":-32603,"message":"internal error"}}`)
+	require.True(t, errors.Is(err, ErrIDMismatch))
+
+	// a null id is allowed for an error, when the server cannot read the id
+	err = call(`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`)
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, CodeParseError, rpcErr.Code)
+
+	err = call(`{"jsonrpc":"2.0","id":ID}`)
+	require.ErrorIs(t, err, ErrInvalidResponse)
+	err = call(`{"jsonrpc":"2.0","id":ID,"result":1,"error":{"code":-32603,"message":"internal error"}}`)
+	require.ErrorIs(t, err, ErrInvalidResponse)
+
+	// a null result is a result
+	require.NoError(t, call(`{"jsonrpc":"2.0","id":ID,"result":null}`))
+}
+
+func TestBatch(t *testing.T) {
+	notified := &atomic.Int32{}
+	server := newMockServer(t, notified)
+	defer server.Close()
+	cli := NewClient(server.URL, http.DefaultClient)
+
+	batch := cli.NewBatch()
+	sum1 := AddCall[[2]int, int](batch, "add", [2]int{1, 2})
+	sum2 := AddCall[[2]int, int](batch, "add", [2]int{3, 4})
+	unknown := AddCall[any, int](batch, "unknown", nil)
+	batch.Notify("touch", nil)
+	require.Equal(t, 4, batch.Len())
+
+	require.NoError(t, batch.Do(context.Background()))
+
+	got, err := sum1.Result()
+	require.NoError(t, err)
+	require.Equal(t, 3, got)
+
+	got, err = sum2.Result()
+	require.NoError(t, err)
+	require.Equal(t, 7, got)
+
+	_, err = unknown.Result()
+	var rpcErr *Error
+	require.ErrorAs(t, err, &rpcErr)
+	require.Equal(t, CodeMethodNotFound, rpcErr.Code)
+
+	require.Equal(t, int32(1), notified.Load())
+
+	// the batch is not sent again
+	require.ErrorIs(t, batch.Do(context.Background()), ErrBatchSent)
+	require.Equal(t, int32(1), notified.Load())
+	got, err = sum1.Result()
+	require.NoError(t, err)
+	require.Equal(t, 3, got)
+}
+
+func TestBatchOnlyNotifications(t *testing.T) {
+	notified := &atomic.Int32{}
+	server := newMockServer(t, notified)
+	defer server.Close()
+	cli := NewClient(server.URL, http.DefaultClient)
+
+	batch := cli.NewBatch()
+	batch.Notify("touch", nil)
+	batch.Notify("touch", nil)
+	require.NoError(t, batch.Do(context.Background()))
+	require.Equal(t, int32(2), notified.Load())
+}
+
+func TestBatchMissingResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	cli := NewClient(server.URL, http.DefaultClient)
+
+	batch := cli.NewBatch()
+	call := AddCall[[2]int, int](batch, "add", [2]int{1, 2})
+	require.NoError(t, batch.Do(context.Background()))
+
+	_, err := call.Result()
+	require.ErrorIs(t, err, ErrNoResponse)
+}
+
+func TestBatchInvalidResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqs))
+		fmt.Fprintf(w, `[{"jsonrpc":"2.0","id":%d}]`, *reqs[0].ID)
+	}))
+	defer server.Close()
+	cli := NewClient(server.URL, http.DefaultClient)
+
+	batch := cli.NewBatch()
+	call := AddCall[[2]int, int](batch, "add", [2]int{1, 2})
+	require.NoError(t, batch.Do(context.Background()))
+
+	_, err := call.Result()
+	require.ErrorIs(t, err, ErrInvalidResponse)
+}
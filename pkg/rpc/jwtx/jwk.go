@@ -0,0 +1,131 @@
+package jwtx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// JWK is a public JSON Web Key (RFC 7517) of RSA, EC P-256 or Ed25519.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, the document served by the jwks_uri of an authorization server.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK returns the JWK of a public key, e.g. to serve the keys of a signer as JWKS.
+// pub must be *rsa.PublicKey, *ecdsa.PublicKey on P-256, or ed25519.PublicKey.
+//
+// Example:
+//
+//	jwk, err := jwtx.NewJWK(&privateKey.PublicKey, "key-1")
+//	jwks := jwtx.JWKS{Keys: []jwtx.JWK{jwk}}
+func NewJWK(pub crypto.PublicKey, kid string) (JWK, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: RS256,
+			N:         encodeSegment(pub.N.Bytes()),
+			E:         encodeSegment(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return JWK{}, errors.New("jwtx: only P-256 EC keys are supported")
+		}
+		x, y := make([]byte, 32), make([]byte, 32)
+		pub.X.FillBytes(x)
+		pub.Y.FillBytes(y)
+		return JWK{
+			KeyType:   "EC",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: ES256,
+			Curve:     "P-256",
+			X:         encodeSegment(x),
+			Y:         encodeSegment(y),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: EdDSA,
+			Curve:     "Ed25519",
+			X:         encodeSegment(pub),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("jwtx: unsupported public key type %T", pub)
+	}
+}
+
+// PublicKey returns the public key of the JWK, which is
+// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwtx: invalid RSA modulus of key %q: %w", k.KeyID, err)
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwtx: invalid RSA exponent of key %q", k.KeyID)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("jwtx: unsupported EC curve %q of key %q", k.Curve, k.KeyID)
+		}
+		x, errX := decodeSegment(k.X)
+		y, errY := decodeSegment(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("jwtx: invalid EC point of key %q", k.KeyID)
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("jwtx: EC point of key %q is not on the curve", k.KeyID)
+		}
+		return pub, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("jwtx: unsupported OKP curve %q of key %q", k.Curve, k.KeyID)
+		}
+		x, err := decodeSegment(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwtx: invalid Ed25519 key %q", k.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("jwtx: unsupported key type %q of key %q", k.KeyType, k.KeyID)
+	}
+}
@@ -0,0 +1,139 @@
+package jwtx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// Header is the JOSE header of a JWT.
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// NumericDate is a JSON numeric date, the seconds since the epoch.
+// Fractional seconds are accepted when decoding, and truncated.
+type NumericDate int64
+
+// NewNumericDate returns the NumericDate of t.
+func NewNumericDate(t time.Time) NumericDate {
+	return NumericDate(t.Unix())
+}
+
+// Time returns the time of the NumericDate.
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+func (d *NumericDate) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	if i, err := n.Int64(); err == nil {
+		*d = NumericDate(i)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return err
+	}
+	*d = NumericDate(math.Floor(f))
+	return nil
+}
+
+// Audience is the "aud" claim, which is a single string or an array of strings in JSON.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(b, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+// Contains reports whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisteredClaims are the registered claims of RFC 7519.
+// Embed it in a struct to add custom claims.
+type RegisteredClaims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitempty"`
+	NotBefore NumericDate `json:"nbf,omitempty"`
+	IssuedAt  NumericDate `json:"iat,omitempty"`
+	ID        string      `json:"jti,omitempty"`
+}
+
+// Sign encodes the claims and signs them, returning the compact serialized JWT.
+// claims may be any value that marshals to a JSON object.
+//
+// Example:
+//
+//	token, err := jwtx.Sign(jwtx.NewRS256Signer(key, "key-1"), jwtx.RegisteredClaims{
+//	    Issuer:    "client-id",
+//	    Audience:  jwtx.Audience{"https://auth.example.com/token"},
+//	    ExpiresAt: jwtx.NewNumericDate(time.Now().Add(5 * time.Minute)),
+//	})
+func Sign(signer Signer, claims any) (string, error) {
+	if rotating, ok := signer.(*RotatingSigner); ok {
+		signer = rotating.Current()
+	}
+
+	header, err := json.Marshal(Header{
+		Algorithm: signer.Algorithm(),
+		Type:      "JWT",
+		KeyID:     signer.KeyID(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	sig, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encodeSegment(sig), nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,140 @@
+package jwtx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func splitToken(t *testing.T, token string) (Header, map[string]any, []byte, []byte) {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	var header Header
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &header))
+
+	var claims map[string]any
+	raw, err = base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &claims))
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	return header, claims, []byte(parts[0] + "." + parts[1]), sig
+}
+
+func TestSign(t *testing.T) {
+	claims := RegisteredClaims{
+		Issuer:    "client",
+		Audience:  Audience{"https://auth.example.com/token"},
+		ExpiresAt: NewNumericDate(time.Unix(1700000300, 0)),
+		IssuedAt:  NewNumericDate(time.Unix(1700000000, 0)),
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	esSigner, err := NewES256Signer(ecKey, "ec")
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("secret")
+
+	tests := []struct {
+		signer Signer
+		verify func(data, sig []byte) bool
+	}{
+		{NewRS256Signer(rsaKey, "rsa"), func(data, sig []byte) bool {
+			sum := sha256.Sum256(data)
+			return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, sum[:], sig) == nil
+		}},
+		{esSigner, func(data, sig []byte) bool {
+			sum := sha256.Sum256(data)
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			return len(sig) == 64 && ecdsa.Verify(&ecKey.PublicKey, sum[:], r, s)
+		}},
+		{NewEdDSASigner(edKey, "ed"), func(data, sig []byte) bool {
+			return ed25519.Verify(edPub, data, sig)
+		}},
+		{NewHS256Signer(secret, ""), func(data, sig []byte) bool {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(data)
+			return hmac.Equal(mac.Sum(nil), sig)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signer.Algorithm(), func(t *testing.T) {
+			token, err := Sign(tt.signer, claims)
+			require.NoError(t, err)
+
+			header, got, data, sig := splitToken(t, token)
+			require.Equal(t, Header{Algorithm: tt.signer.Algorithm(), Type: "JWT", KeyID: tt.signer.KeyID()}, header)
+			require.Equal(t, "client", got["iss"])
+			require.Equal(t, "https://auth.example.com/token", got["aud"])
+			require.Equal(t, float64(1700000300), got["exp"])
+			require.True(t, tt.verify(data, sig))
+		})
+	}
+}
+
+func TestRotatingSigner(t *testing.T) {
+	signer := NewRotatingSigner(NewHS256Signer([]byte("old"), "key-1"))
+	token, err := Sign(signer, RegisteredClaims{})
+	require.NoError(t, err)
+	header, _, _, _ := splitToken(t, token)
+	require.Equal(t, "key-1", header.KeyID)
+
+	signer.Rotate(NewHS256Signer([]byte("new"), "key-2"))
+	token, err = Sign(signer, RegisteredClaims{})
+	require.NoError(t, err)
+	header, _, data, sig := splitToken(t, token)
+	require.Equal(t, "key-2", header.KeyID)
+
+	mac := hmac.New(sha256.New, []byte("new"))
+	mac.Write(data)
+	require.Equal(t, mac.Sum(nil), sig)
+}
+
+func TestAudience(t *testing.T) {
+	var aud Audience
+	require.NoError(t, json.Unmarshal([]byte(`"a"`), &aud))
+	require.Equal(t, Audience{"a"}, aud)
+	require.NoError(t, json.Unmarshal([]byte(`["a","b"]`), &aud))
+	require.True(t, aud.Contains("b"))
+	require.False(t, aud.Contains("c"))
+
+	b, err := json.Marshal(aud)
+	require.NoError(t, err)
+	require.JSONEq(t, `["a","b"]`, string(b))
+}
+
+func TestNumericDate(t *testing.T) {
+	var claims RegisteredClaims
+	require.NoError(t, json.Unmarshal([]byte(`{"exp":1700000300.75,"iat":1700000000,"nbf":1.7e9}`), &claims))
+	require.Equal(t, NumericDate(1700000300), claims.ExpiresAt)
+	require.Equal(t, NumericDate(1700000000), claims.IssuedAt)
+	require.Equal(t, NumericDate(1700000000), claims.NotBefore)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"exp":null}`), &claims))
+	require.Error(t, json.Unmarshal([]byte(`{"exp":"soon"}`), &claims))
+
+	b, err := json.Marshal(RegisteredClaims{ExpiresAt: 1700000300})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"exp":1700000300}`, string(b))
+}
@@ -0,0 +1,202 @@
+package jwtx
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+)
+
+// KeySet looks up the public key to verify a JWT by its "kid" header.
+type KeySet interface {
+	// Key returns the JWK of kid, or an error wrapping ErrUnknownKeyID if there is none.
+	Key(ctx context.Context, kid string) (JWK, error)
+}
+
+// StaticKeySet is a KeySet of fixed keys, e.g. for tests.
+type StaticKeySet struct {
+	keys map[string]JWK
+}
+
+func NewStaticKeySet(jwks JWKS) *StaticKeySet {
+	s := &StaticKeySet{keys: make(map[string]JWK, len(jwks.Keys))}
+	for _, k := range jwks.Keys {
+		s.keys[k.KeyID] = k
+	}
+	return s
+}
+
+func (s *StaticKeySet) Key(ctx context.Context, kid string) (JWK, error) {
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	return JWK{}, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+}
+
+const (
+	defaultRefreshInterval    = time.Hour
+	defaultMinRefreshInterval = time.Minute
+	fetchTimeout              = 30 * time.Second
+)
+
+type remoteKeySetConfig struct {
+	client             *httpx.XClient
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+}
+
+// RemoteKeySetOption configures NewRemoteKeySet.
+type RemoteKeySetOption func(*remoteKeySetConfig)
+
+// WithJWKSClient sets the client fetching the JWKS. The default is httpx.NewXClient().
+func WithJWKSClient(client *httpx.XClient) RemoteKeySetOption {
+	return func(c *remoteKeySetConfig) {
+		c.client = client
+	}
+}
+
+// WithRefreshInterval sets how long the fetched keys are cached. The default is 1 hour.
+func WithRefreshInterval(d time.Duration) RemoteKeySetOption {
+	return func(c *remoteKeySetConfig) {
+		c.refreshInterval = d
+	}
+}
+
+// WithMinRefreshInterval sets the minimum interval between two fetches, which limits
+// the fetches caused by tokens of unknown kid. The default is 1 minute.
+func WithMinRefreshInterval(d time.Duration) RemoteKeySetOption {
+	return func(c *remoteKeySetConfig) {
+		c.minRefreshInterval = d
+	}
+}
+
+// RemoteKeySet is a KeySet fetching and caching the JWKS document at a URL.
+//
+// The keys are fetched on first use and cached for the refresh interval.
+// A lookup of an unknown kid fetches the keys again for key rotation, but at most
+// once per minimum refresh interval, so that tokens with random kids cannot flood
+// the JWKS endpoint. If a fetch fails, the cached keys are still used.
+// It is safe for concurrent use: cached keys are served while a fetch is in flight,
+// even once they are stale, and concurrent lookups share a single fetch.
+// Only lookups of an unknown kid wait for the fetch.
+//
+// Example:
+//
+//	keys := jwtx.NewRemoteKeySet("https://auth.example.com/.well-known/jwks.json")
+//	verifier := jwtx.NewVerifier[jwtx.RegisteredClaims](keys,
+//	    jwtx.WithIssuer("https://auth.example.com/"),
+//	    jwtx.WithAudience("api"),
+//	)
+type RemoteKeySet struct {
+	url string
+	cfg remoteKeySetConfig
+
+	mu        sync.RWMutex // guards the fields below
+	keys      map[string]JWK
+	fetchedAt time.Time
+	lastFetch time.Time     // the last attempt, even if it failed
+	lastErr   error         // the error of the last attempt
+	fetching  chan struct{} // closed once the fetch in flight is done, nil if none
+}
+
+func NewRemoteKeySet(url string, opts ...RemoteKeySetOption) *RemoteKeySet {
+	cfg := remoteKeySetConfig{
+		refreshInterval:    defaultRefreshInterval,
+		minRefreshInterval: defaultMinRefreshInterval,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.client == nil {
+		cfg.client = httpx.NewXClient()
+	}
+	return &RemoteKeySet{url: url, cfg: cfg}
+}
+
+func (s *RemoteKeySet) Key(ctx context.Context, kid string) (JWK, error) {
+	s.mu.RLock()
+	key, known := s.keys[kid]
+	fresh := s.keys != nil && time.Since(s.fetchedAt) < s.cfg.refreshInterval
+	s.mu.RUnlock()
+	if known && fresh {
+		return key, nil
+	}
+
+	done := s.startFetch(ctx)
+	if known {
+		// the stale key is served while the keys are fetched in the background
+		return key, nil
+	}
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return JWK{}, ctx.Err()
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// on error, fall back to the cached keys
+	if s.keys == nil {
+		return JWK{}, s.lastErr
+	}
+	key, known = s.keys[kid]
+	if !known {
+		return JWK{}, fmt.Errorf("%w: %q", ErrUnknownKeyID, kid)
+	}
+	return key, nil
+}
+
+// startFetch starts fetching the keys unless the last attempt is within the minimum
+// refresh interval, and returns a channel closed once the fetch in flight is done,
+// or nil if there is none.
+func (s *RemoteKeySet) startFetch(ctx context.Context) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fetching != nil {
+		return s.fetching
+	}
+	now := time.Now()
+	if now.Sub(s.lastFetch) < s.cfg.minRefreshInterval {
+		return nil
+	}
+	s.lastFetch = now
+	done := make(chan struct{})
+	s.fetching = done
+
+	// the fetch is shared, it must not be canceled by the ctx of one caller
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+	go func() {
+		defer cancel()
+		keys, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		if err == nil {
+			s.keys = keys
+			s.fetchedAt = now
+		}
+		s.lastErr = err
+		s.fetching = nil
+		s.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (s *RemoteKeySet) fetch(ctx context.Context) (map[string]JWK, error) {
+	var jwks JWKS
+	if err := s.cfg.client.GetJSON(ctx, s.url, &jwks); err != nil {
+		return nil, fmt.Errorf("jwtx: fetch JWKS: %w", err)
+	}
+	keys := make(map[string]JWK, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		keys[k.KeyID] = k
+	}
+	return keys, nil
+}
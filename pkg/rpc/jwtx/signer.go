@@ -0,0 +1,155 @@
+package jwtx
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"sync/atomic"
+)
+
+// Algorithms supported by the signers.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+	HS256 = "HS256"
+)
+
+// Signer signs the signing input of a JWT.
+type Signer interface {
+	// Algorithm returns the "alg" header of the JWT.
+	Algorithm() string
+	// KeyID returns the "kid" header of the JWT. It may be empty.
+	KeyID() string
+	// Sign returns the signature of data.
+	Sign(data []byte) ([]byte, error)
+}
+
+type rsaSigner struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+// NewRS256Signer returns a Signer signing with RSASSA-PKCS1-v1_5 using SHA-256.
+func NewRS256Signer(key *rsa.PrivateKey, kid string) Signer {
+	return &rsaSigner{key: key, kid: kid}
+}
+
+func (s *rsaSigner) Algorithm() string { return RS256 }
+func (s *rsaSigner) KeyID() string     { return s.kid }
+
+func (s *rsaSigner) Sign(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+}
+
+type ecdsaSigner struct {
+	key *ecdsa.PrivateKey
+	kid string
+}
+
+// NewES256Signer returns a Signer signing with ECDSA using P-256 and SHA-256.
+// It returns an error if the key is not on the P-256 curve.
+func NewES256Signer(key *ecdsa.PrivateKey, kid string) (Signer, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("jwtx: ES256 requires a P-256 key")
+	}
+	return &ecdsaSigner{key: key, kid: kid}, nil
+}
+
+func (s *ecdsaSigner) Algorithm() string { return ES256 }
+func (s *ecdsaSigner) KeyID() string     { return s.kid }
+
+// Sign returns the signature as R || S, each padded to 32 bytes, as required by JWS.
+func (s *ecdsaSigner) Sign(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	ss.FillBytes(sig[32:])
+	return sig, nil
+}
+
+type ed25519Signer struct {
+	key ed25519.PrivateKey
+	kid string
+}
+
+// NewEdDSASigner returns a Signer signing with Ed25519.
+func NewEdDSASigner(key ed25519.PrivateKey, kid string) Signer {
+	return &ed25519Signer{key: key, kid: kid}
+}
+
+func (s *ed25519Signer) Algorithm() string { return EdDSA }
+func (s *ed25519Signer) KeyID() string     { return s.kid }
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+type hmacSigner struct {
+	secret []byte
+	kid    string
+}
+
+// NewHS256Signer returns a Signer signing with HMAC using SHA-256,
+// e.g. for the client_secret_jwt client authentication.
+func NewHS256Signer(secret []byte, kid string) Signer {
+	return &hmacSigner{secret: secret, kid: kid}
+}
+
+func (s *hmacSigner) Algorithm() string { return HS256 }
+func (s *hmacSigner) KeyID() string     { return s.kid }
+
+func (s *hmacSigner) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// RotatingSigner is a Signer whose key can be replaced at any time,
+// for key rotation without rebuilding what uses it.
+// It is safe for concurrent use.
+//
+// Example:
+//
+//	signer := jwtx.NewRotatingSigner(jwtx.NewRS256Signer(oldKey, "key-1"))
+//	// later
+//	signer.Rotate(jwtx.NewRS256Signer(newKey, "key-2"))
+type RotatingSigner struct {
+	current atomic.Pointer[Signer]
+}
+
+func NewRotatingSigner(signer Signer) *RotatingSigner {
+	s := &RotatingSigner{}
+	s.Rotate(signer)
+	return s
+}
+
+// Rotate replaces the current signer.
+func (s *RotatingSigner) Rotate(signer Signer) {
+	s.current.Store(&signer)
+}
+
+// Current returns the current signer.
+// Sign uses the current signer for both the header and the signature of a JWT,
+// so a concurrent rotation never produces a mismatched JWT.
+func (s *RotatingSigner) Current() Signer {
+	return *s.current.Load()
+}
+
+func (s *RotatingSigner) Algorithm() string { return s.Current().Algorithm() }
+func (s *RotatingSigner) KeyID() string     { return s.Current().KeyID() }
+
+func (s *RotatingSigner) Sign(data []byte) ([]byte, error) {
+	return s.Current().Sign(data)
+}
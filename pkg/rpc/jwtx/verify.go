@@ -0,0 +1,253 @@
+package jwtx
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is wrapped by all the errors of an invalid token,
+	// as opposed to errors like failing to fetch the keys.
+	ErrInvalidToken = errors.New("jwtx: invalid token")
+
+	ErrMalformedToken       = fmt.Errorf("%w: malformed", ErrInvalidToken)
+	ErrUnsupportedAlgorithm = fmt.Errorf("%w: unsupported algorithm", ErrInvalidToken)
+	ErrUnknownKeyID         = fmt.Errorf("%w: unknown key id", ErrInvalidToken)
+	ErrInvalidSignature     = fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+	ErrTokenExpired         = fmt.Errorf("%w: expired", ErrInvalidToken)
+	ErrTokenNotValidYet     = fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	ErrInvalidIssuer        = fmt.Errorf("%w: invalid issuer", ErrInvalidToken)
+	ErrInvalidAudience      = fmt.Errorf("%w: invalid audience", ErrInvalidToken)
+)
+
+const defaultClockSkew = time.Minute
+
+type verifierConfig struct {
+	issuer     string
+	audience   string
+	clockSkew  time.Duration
+	algorithms []string
+	requireExp bool
+}
+
+// VerifierOption configures NewVerifier.
+type VerifierOption func(*verifierConfig)
+
+// WithIssuer requires the "iss" claim to be issuer.
+func WithIssuer(issuer string) VerifierOption {
+	return func(c *verifierConfig) {
+		c.issuer = issuer
+	}
+}
+
+// WithAudience requires the "aud" claim to contain audience.
+func WithAudience(audience string) VerifierOption {
+	return func(c *verifierConfig) {
+		c.audience = audience
+	}
+}
+
+// WithClockSkew sets the leeway of the "exp" and "nbf" claims
+// for clock differences between servers. The default is 1 minute.
+func WithClockSkew(skew time.Duration) VerifierOption {
+	return func(c *verifierConfig) {
+		c.clockSkew = skew
+	}
+}
+
+// WithAlgorithms limits the accepted algorithms. The default is RS256, ES256 and EdDSA.
+// HS256 is never accepted, as the keys are public.
+func WithAlgorithms(algs ...string) VerifierOption {
+	return func(c *verifierConfig) {
+		c.algorithms = algs
+	}
+}
+
+// WithoutRequireExpiry accepts tokens without the "exp" claim, which are rejected by default.
+func WithoutRequireExpiry() VerifierOption {
+	return func(c *verifierConfig) {
+		c.requireExp = false
+	}
+}
+
+// Verifier verifies JWTs by the keys of a KeySet, and decodes their claims into T.
+// T may be RegisteredClaims, a struct embedding it to add custom claims,
+// or any other type the payload unmarshals into. The registered claims
+// are validated whatever T is.
+//
+// Verifier implements oauth2x.TokenValidator, so it can be used by oauth2x.BearerMiddleware.
+//
+// Example:
+//
+//	type Claims struct {
+//	    jwtx.RegisteredClaims
+//	    Scope string `json:"scope"`
+//	}
+//
+//	verifier := jwtx.NewVerifier[Claims](jwtx.NewRemoteKeySet(jwksURL),
+//	    jwtx.WithIssuer("https://auth.example.com/"),
+//	    jwtx.WithAudience("api"),
+//	)
+//	claims, err := verifier.Verify(ctx, token)
+type Verifier[T any] struct {
+	keys KeySet
+	cfg  verifierConfig
+}
+
+func NewVerifier[T any](keys KeySet, opts ...VerifierOption) *Verifier[T] {
+	cfg := verifierConfig{
+		clockSkew:  defaultClockSkew,
+		algorithms: []string{RS256, ES256, EdDSA},
+		requireExp: true,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Verifier[T]{keys: keys, cfg: cfg}
+}
+
+// Verify verifies the signature and the registered claims of the token,
+// and returns its claims. Errors of invalid tokens wrap ErrInvalidToken.
+func (v *Verifier[T]) Verify(ctx context.Context, token string) (T, error) {
+	var claims T
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrMalformedToken
+	}
+	var header Header
+	if err := decodeJSONSegment(parts[0], &header); err != nil {
+		return claims, err
+	}
+	if !v.acceptsAlgorithm(header.Algorithm) {
+		return claims, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, header.Algorithm)
+	}
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+
+	jwk, err := v.keys.Key(ctx, header.KeyID)
+	if err != nil {
+		return claims, err
+	}
+	if jwk.Algorithm != "" && jwk.Algorithm != header.Algorithm {
+		return claims, fmt.Errorf("%w: key %q is for %s", ErrUnsupportedAlgorithm, jwk.KeyID, jwk.Algorithm)
+	}
+	pub, err := jwk.PublicKey()
+	if err != nil {
+		return claims, err
+	}
+	if err := verifySignature(header.Algorithm, pub, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return claims, err
+	}
+
+	var registered RegisteredClaims
+	if err := decodeJSONSegment(parts[1], &registered); err != nil {
+		return claims, err
+	}
+	if err := v.validate(&registered, time.Now()); err != nil {
+		return claims, err
+	}
+	if err := decodeJSONSegment(parts[1], &claims); err != nil {
+		return claims, err
+	}
+	return claims, nil
+}
+
+// ValidateToken is Verify, implementing oauth2x.TokenValidator.
+func (v *Verifier[T]) ValidateToken(ctx context.Context, token string) (T, error) {
+	return v.Verify(ctx, token)
+}
+
+func (v *Verifier[T]) acceptsAlgorithm(alg string) bool {
+	if alg == HS256 {
+		return false
+	}
+	for _, a := range v.cfg.algorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Verifier[T]) validate(c *RegisteredClaims, now time.Time) error {
+	skew := v.cfg.clockSkew
+	if c.ExpiresAt == 0 && v.cfg.requireExp {
+		return fmt.Errorf("%w: no exp claim", ErrTokenExpired)
+	}
+	if c.ExpiresAt != 0 && !now.Before(c.ExpiresAt.Time().Add(skew)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != 0 && now.Before(c.NotBefore.Time().Add(-skew)) {
+		return ErrTokenNotValidYet
+	}
+	if v.cfg.issuer != "" && c.Issuer != v.cfg.issuer {
+		return fmt.Errorf("%w: %q", ErrInvalidIssuer, c.Issuer)
+	}
+	if v.cfg.audience != "" && !c.Audience.Contains(v.cfg.audience) {
+		return fmt.Errorf("%w: %q", ErrInvalidAudience, c.Audience)
+	}
+	return nil
+}
+
+func verifySignature(alg string, pub crypto.PublicKey, data, sig []byte) error {
+	switch alg {
+	case RS256:
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			break
+		}
+		sum := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case ES256:
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			break
+		}
+		if len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		sum := sha256.Sum256(data)
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, sum[:], r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	case EdDSA:
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			break
+		}
+		if !ed25519.Verify(key, data, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s with %T", ErrUnsupportedAlgorithm, alg, pub)
+}
+
+func decodeJSONSegment(s string, v any) error {
+	b, err := decodeSegment(s)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	return nil
+}
@@ -0,0 +1,316 @@
+package jwtx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testKey struct {
+	signer Signer
+	jwk    JWK
+}
+
+func newTestKeys(t *testing.T) []testKey {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	esSigner, err := NewES256Signer(ecKey, "ec")
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keys := []testKey{
+		{signer: NewRS256Signer(rsaKey, "rsa")},
+		{signer: esSigner},
+		{signer: NewEdDSASigner(edKey, "ed")},
+	}
+	for i, pub := range []any{&rsaKey.PublicKey, &ecKey.PublicKey, edPub} {
+		keys[i].jwk, err = NewJWK(pub, keys[i].signer.KeyID())
+		require.NoError(t, err)
+	}
+	return keys
+}
+
+func jwksOf(keys []testKey) JWKS {
+	jwks := JWKS{}
+	for _, k := range keys {
+		jwks.Keys = append(jwks.Keys, k.jwk)
+	}
+	return jwks
+}
+
+type customClaims struct {
+	RegisteredClaims
+	Scope string `json:"scope"`
+}
+
+func validClaims() customClaims {
+	now := time.Now()
+	return customClaims{
+		RegisteredClaims: RegisteredClaims{
+			Issuer:    "https://auth.example.com/",
+			Subject:   "user",
+			Audience:  Audience{"api", "other"},
+			ExpiresAt: NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  NewNumericDate(now),
+		},
+		Scope: "read",
+	}
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+	verifier := NewVerifier[customClaims](NewStaticKeySet(jwksOf(keys)),
+		WithIssuer("https://auth.example.com/"),
+		WithAudience("api"),
+	)
+
+	for _, k := range keys {
+		t.Run(k.signer.Algorithm(), func(t *testing.T) {
+			token, err := Sign(k.signer, validClaims())
+			require.NoError(t, err)
+
+			claims, err := verifier.Verify(context.Background(), token)
+			require.NoError(t, err)
+			require.Equal(t, "user", claims.Subject)
+			require.Equal(t, "read", claims.Scope)
+
+			// the signature of another payload
+			other := validClaims()
+			other.Subject = "admin"
+			forged, err := Sign(k.signer, other)
+			require.NoError(t, err)
+			parts, forgedParts := strings.Split(token, "."), strings.Split(forged, ".")
+			_, err = verifier.Verify(context.Background(), forgedParts[0]+"."+forgedParts[1]+"."+parts[2])
+			require.ErrorIs(t, err, ErrInvalidSignature)
+		})
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	keys := newTestKeys(t)
+	signer := keys[0].signer
+	verifier := NewVerifier[RegisteredClaims](NewStaticKeySet(jwksOf(keys)),
+		WithIssuer("https://auth.example.com/"),
+		WithAudience("api"),
+		WithClockSkew(time.Minute),
+	)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		modify  func(c *customClaims)
+		wantErr error
+	}{
+		{"within skew after exp", func(c *customClaims) { c.ExpiresAt = NewNumericDate(now.Add(-30 * time.Second)) }, nil},
+		{"expired", func(c *customClaims) { c.ExpiresAt = NewNumericDate(now.Add(-2 * time.Minute)) }, ErrTokenExpired},
+		{"no exp", func(c *customClaims) { c.ExpiresAt = 0 }, ErrTokenExpired},
+		{"within skew before nbf", func(c *customClaims) { c.NotBefore = NewNumericDate(now.Add(30 * time.Second)) }, nil},
+		{"not valid yet", func(c *customClaims) { c.NotBefore = NewNumericDate(now.Add(2 * time.Minute)) }, ErrTokenNotValidYet},
+		{"wrong issuer", func(c *customClaims) { c.Issuer = "https://evil.example.com/" }, ErrInvalidIssuer},
+		{"wrong audience", func(c *customClaims) { c.Audience = Audience{"other"} }, ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(&claims)
+			token, err := Sign(signer, claims)
+			require.NoError(t, err)
+
+			_, err = verifier.Verify(context.Background(), token)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+			require.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+}
+
+func TestVerifyRejectsAlgorithms(t *testing.T) {
+	keys := newTestKeys(t)
+	verifier := NewVerifier[RegisteredClaims](NewStaticKeySet(jwksOf(keys)))
+	ctx := context.Background()
+
+	// HS256 with the public key as the secret, the classic algorithm confusion
+	n, _ := json.Marshal(keys[0].jwk)
+	token, err := Sign(NewHS256Signer(n, "rsa"), validClaims())
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, token)
+	require.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	// a key used for another algorithm
+	token, err = Sign(&renamedSigner{Signer: keys[1].signer, kid: "rsa"}, validClaims())
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, token)
+	require.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+
+	_, err = verifier.Verify(ctx, "not.a-token")
+	require.ErrorIs(t, err, ErrMalformedToken)
+
+	token, err = Sign(&renamedSigner{Signer: keys[0].signer, kid: "unknown"}, validClaims())
+	require.NoError(t, err)
+	_, err = verifier.Verify(ctx, token)
+	require.ErrorIs(t, err, ErrUnknownKeyID)
+}
+
+type renamedSigner struct {
+	Signer
+	kid string
+}
+
+func (s *renamedSigner) KeyID() string { return s.kid }
+
+// jwksServer serves the current keys, and counts the fetches.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	jwks    JWKS
+	fetches atomic.Int32
+}
+
+func newJWKSServer(jwks JWKS) *jwksServer {
+	s := &jwksServer{jwks: jwks}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(s.jwks)
+	}))
+	return s
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	keys := newTestKeys(t)
+	server := newJWKSServer(jwksOf(keys[:1]))
+	defer server.Close()
+
+	keySet := NewRemoteKeySet(server.URL, WithMinRefreshInterval(100*time.Millisecond))
+	verifier := NewVerifier[RegisteredClaims](keySet)
+	ctx := context.Background()
+
+	token, err := Sign(keys[0].signer, validClaims())
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = verifier.Verify(ctx, token)
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 1, server.fetches.Load())
+
+	// the issuer rotates to a new key
+	server.mu.Lock()
+	server.jwks = jwksOf(keys)
+	server.mu.Unlock()
+	rotated, err := Sign(keys[2].signer, validClaims())
+	require.NoError(t, err)
+
+	// an unknown kid refreshes the keys, but not more than once per min refresh interval
+	_, err = verifier.Verify(ctx, rotated)
+	require.ErrorIs(t, err, ErrUnknownKeyID)
+	require.EqualValues(t, 1, server.fetches.Load())
+
+	time.Sleep(150 * time.Millisecond)
+	_, err = verifier.Verify(ctx, rotated)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, server.fetches.Load())
+
+	forged, err := Sign(&renamedSigner{Signer: keys[0].signer, kid: "random"}, validClaims())
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = verifier.Verify(ctx, forged)
+		require.ErrorIs(t, err, ErrUnknownKeyID)
+	}
+	require.EqualValues(t, 2, server.fetches.Load())
+}
+
+func TestRemoteKeySetFetchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := NewRemoteKeySet(server.URL).Key(context.Background(), "kid")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestRemoteKeySetConcurrentFetch(t *testing.T) {
+	keys := newTestKeys(t)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release // the refresh hangs
+		}
+		json.NewEncoder(w).Encode(jwksOf(keys))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	keySet := NewRemoteKeySet(server.URL, WithMinRefreshInterval(0))
+	ctx := context.Background()
+	_, err := keySet.Key(ctx, keys[0].jwk.KeyID)
+	require.NoError(t, err)
+
+	// an unknown kid starts a refresh, which is shared and not canceled by its caller
+	canceled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = keySet.Key(canceled, "unknown")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	waiting, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = keySet.Key(waiting, "unknown")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.EqualValues(t, 2, fetches.Load())
+
+	// the cached keys are served while the refresh is in flight
+	start := time.Now()
+	key, err := keySet.Key(ctx, keys[1].jwk.KeyID)
+	require.NoError(t, err)
+	require.Equal(t, keys[1].jwk.KeyID, key.KeyID)
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestRemoteKeySetStaleKey(t *testing.T) {
+	keys := newTestKeys(t)
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release // the refresh hangs
+		}
+		json.NewEncoder(w).Encode(jwksOf(keys))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	keySet := NewRemoteKeySet(server.URL, WithRefreshInterval(50*time.Millisecond), WithMinRefreshInterval(0))
+	ctx := context.Background()
+	_, err := keySet.Key(ctx, keys[0].jwk.KeyID)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	// the stale key is served at once, while the refresh it starts is blocked
+	waiting, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	key, err := keySet.Key(waiting, keys[0].jwk.KeyID)
+	require.NoError(t, err)
+	require.Equal(t, keys[0].jwk.KeyID, key.KeyID)
+	require.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,235 @@
+package oauth2x
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/jwtx"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	grantTypeJWTBearer     = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	clientAssertionTypeJWT = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	defaultAssertionTTL = 5 * time.Minute
+)
+
+// ClientCredentialsConfig describes the client credentials grant (RFC 6749 section 4.4)
+// for service-to-service calls.
+//
+// The client authenticates by ClientSecret, or by a signed JWT assertion
+// (RFC 7523 section 2.2) if Signer is set: private_key_jwt with a private key signer,
+// or client_secret_jwt with an HMAC signer. Use jwtx.RotatingSigner to rotate the key.
+// The token requests are sent by golang.org/x/oauth2/clientcredentials.
+//
+// Example:
+//
+//	conf := &ClientCredentialsConfig{
+//	    ClientID: "service-a",
+//	    Signer:   jwtx.NewRS256Signer(privateKey, "key-1"),
+//	    TokenURL: "https://auth.example.com/token",
+//	    Scopes:   []string{"read"},
+//	    Audience: "https://api.example.com",
+//	}
+//	client := httpx.NewXClient(WithOAuth2Http(ctx, nil, conf.TokenSource(ctx)))
+type ClientCredentialsConfig struct {
+	ClientID     string
+	ClientSecret string
+	// AuthStyle is how ClientSecret is sent. AuthStyleAutoDetect tries the header first,
+	// then the params, as oauth2 does.
+	AuthStyle oauth2.AuthStyle
+	// Signer signs the client assertion. If set, ClientSecret is not sent.
+	Signer jwtx.Signer
+
+	TokenURL string
+	Scopes   []string
+	// Audience is sent as the "audience" parameter if not empty.
+	Audience string
+	// EndpointParams are additional parameters of the token request.
+	EndpointParams url.Values
+	// AssertionTTL is the lifetime of the client assertion. The default is 5 minutes.
+	AssertionTTL time.Duration
+}
+
+// TokenSource returns a token source that requests a new token when the cached
+// one expires. It can be used as OAuth2Core.Source directly.
+func (c *ClientCredentialsConfig) TokenSource(ctx context.Context) oauth2.TokenSource {
+	if c.Signer == nil {
+		conf := &clientcredentials.Config{
+			ClientID:       c.ClientID,
+			ClientSecret:   c.ClientSecret,
+			TokenURL:       c.TokenURL,
+			Scopes:         c.Scopes,
+			EndpointParams: tokenParams(c.Audience, c.EndpointParams),
+			AuthStyle:      c.AuthStyle,
+		}
+		return conf.TokenSource(ctx)
+	}
+	return oauth2.ReuseTokenSource(nil, &assertionSource{
+		ctx: ctx,
+		conf: &clientcredentials.Config{
+			ClientID:  c.ClientID,
+			TokenURL:  c.TokenURL,
+			Scopes:    c.Scopes,
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		params: func() (url.Values, error) {
+			assertion, err := signAssertion(c.Signer, c.ClientID, c.ClientID, c.TokenURL, c.AssertionTTL, nil)
+			if err != nil {
+				return nil, err
+			}
+			v := tokenParams(c.Audience, c.EndpointParams)
+			v.Set("client_assertion_type", clientAssertionTypeJWT)
+			v.Set("client_assertion", assertion)
+			return v, nil
+		},
+	})
+}
+
+// assertionSource requests the tokens by conf, with the endpoint params of a new
+// assertion for each request.
+type assertionSource struct {
+	ctx    context.Context
+	params func() (url.Values, error)
+
+	mu   sync.Mutex // guards conf.EndpointParams
+	conf *clientcredentials.Config
+}
+
+func (s *assertionSource) Token() (*oauth2.Token, error) {
+	v, err := s.params()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// conf is kept, not copied, for the auth style it detects
+	s.conf.EndpointParams = v
+	return s.conf.Token(s.ctx)
+}
+
+// JWTBearerConfig describes the JWT bearer grant (RFC 7523 section 2.1),
+// which exchanges a signed JWT assertion for an access token.
+//
+// Unlike golang.org/x/oauth2/jwt, which signs by an RSA key in PEM, the assertion is
+// signed by any jwtx.Signer. The token requests are sent by
+// golang.org/x/oauth2/clientcredentials, with the grant type replaced.
+//
+// Example:
+//
+//	signer := jwtx.NewRotatingSigner(jwtx.NewEdDSASigner(key, "key-1"))
+//	conf := &JWTBearerConfig{
+//	    Signer:   signer,
+//	    Issuer:   "service-a@example.com",
+//	    Subject:  "user@example.com",
+//	    TokenURL: "https://auth.example.com/token",
+//	    Scopes:   []string{"read"},
+//	}
+//	client := httpx.NewXClient(WithOAuth2Http(ctx, nil, conf.TokenSource(ctx)))
+type JWTBearerConfig struct {
+	// Signer signs the assertion. Use jwtx.RotatingSigner to rotate the key.
+	Signer  jwtx.Signer
+	Issuer  string
+	Subject string
+	// AssertionAudience is the "aud" of the assertion. The default is TokenURL.
+	AssertionAudience string
+	// PrivateClaims are added to the claims of the assertion.
+	PrivateClaims map[string]any
+	// AssertionTTL is the lifetime of the assertion. The default is 5 minutes.
+	AssertionTTL time.Duration
+
+	// ClientID and ClientSecret optionally authenticate the client, by AuthStyle as
+	// ClientCredentialsConfig does.
+	ClientID     string
+	ClientSecret string
+	AuthStyle    oauth2.AuthStyle
+
+	TokenURL string
+	Scopes   []string
+	// Audience is sent as the "audience" parameter if not empty.
+	Audience string
+	// EndpointParams are additional parameters of the token request.
+	EndpointParams url.Values
+}
+
+// TokenSource returns a token source that requests a new token with a new
+// assertion when the cached one expires. It can be used as OAuth2Core.Source directly.
+func (c *JWTBearerConfig) TokenSource(ctx context.Context) oauth2.TokenSource {
+	style := c.AuthStyle
+	if c.ClientID == "" {
+		style = oauth2.AuthStyleInParams // no client authentication
+	}
+	return oauth2.ReuseTokenSource(nil, &assertionSource{
+		ctx: ctx,
+		conf: &clientcredentials.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			TokenURL:     c.TokenURL,
+			Scopes:       c.Scopes,
+			AuthStyle:    style,
+		},
+		params: func() (url.Values, error) {
+			aud := c.AssertionAudience
+			if aud == "" {
+				aud = c.TokenURL
+			}
+			assertion, err := signAssertion(c.Signer, c.Issuer, c.Subject, aud, c.AssertionTTL, c.PrivateClaims)
+			if err != nil {
+				return nil, err
+			}
+			v := tokenParams(c.Audience, c.EndpointParams)
+			v.Set("grant_type", grantTypeJWTBearer)
+			v.Set("assertion", assertion)
+			return v, nil
+		},
+	})
+}
+
+// tokenParams returns the endpoint params of a token request, with the audience.
+func tokenParams(audience string, params url.Values) url.Values {
+	v := url.Values{}
+	for k, vs := range params {
+		v[k] = vs
+	}
+	if audience != "" {
+		v.Set("audience", audience)
+	}
+	return v
+}
+
+func signAssertion(signer jwtx.Signer, iss, sub, aud string, ttl time.Duration, privateClaims map[string]any) (string, error) {
+	if ttl == 0 {
+		ttl = defaultAssertionTTL
+	}
+	jti, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := make(map[string]any, len(privateClaims)+6)
+	for k, v := range privateClaims {
+		claims[k] = v
+	}
+	claims["iss"] = iss
+	claims["sub"] = sub
+	claims["aud"] = aud
+	claims["iat"] = jwtx.NewNumericDate(now)
+	claims["exp"] = jwtx.NewNumericDate(now.Add(ttl))
+	claims["jti"] = jti
+	return jwtx.Sign(signer, claims)
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
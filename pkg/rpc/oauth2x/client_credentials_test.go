@@ -0,0 +1,155 @@
+package oauth2x
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/jwtx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// verifyHS256 verifies a HS256 JWT and returns its header and claims.
+func verifyHS256(t *testing.T, token string, secret []byte) (jwtx.Header, map[string]any) {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	require.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2], "bad signature")
+
+	var header jwtx.Header
+	raw, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, json.Unmarshal(raw, &header))
+	var claims map[string]any
+	raw, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, json.Unmarshal(raw, &claims))
+	return header, claims
+}
+
+// newGrantServer returns a token endpoint that checks the request by check,
+// and issues numbered access tokens.
+func newGrantServer(t *testing.T, check func(r *http.Request)) (*httptest.Server, *int32) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		check(r)
+		n := atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access_token_%d","token_type":"Bearer","expires_in":3600}`, n)
+	}))
+	return server, &issued
+}
+
+func TestClientCredentialsSecret(t *testing.T) {
+	server, issued := newGrantServer(t, func(r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "service", id)
+		assert.Equal(t, "secret", secret)
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		assert.Equal(t, "read write", r.Form.Get("scope"))
+		assert.Equal(t, "https://api.example.com", r.Form.Get("audience"))
+		assert.Equal(t, "extra", r.Form.Get("resource"))
+	})
+	defer server.Close()
+
+	conf := &ClientCredentialsConfig{
+		ClientID:       "service",
+		ClientSecret:   "secret",
+		AuthStyle:      oauth2.AuthStyleInHeader,
+		TokenURL:       server.URL,
+		Scopes:         []string{"read", "write"},
+		Audience:       "https://api.example.com",
+		EndpointParams: map[string][]string{"resource": {"extra"}},
+	}
+	source := conf.TokenSource(context.Background())
+	for i := 0; i < 3; i++ {
+		token, err := source.Token()
+		require.NoError(t, err)
+		require.Equal(t, "access_token_1", token.AccessToken)
+	}
+	require.EqualValues(t, 1, *issued)
+}
+
+func TestClientCredentialsAssertion(t *testing.T) {
+	secrets := map[string][]byte{"key-1": []byte("secret-1"), "key-2": []byte("secret-2")}
+	var kids []string
+	server, _ := newGrantServer(t, func(r *http.Request) {
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		assert.Equal(t, "service", r.Form.Get("client_id"))
+		assert.Empty(t, r.Form.Get("client_secret"))
+		assert.Equal(t, clientAssertionTypeJWT, r.Form.Get("client_assertion_type"))
+
+		header, _, _ := strings.Cut(r.Form.Get("client_assertion"), ".")
+		raw, _ := base64.RawURLEncoding.DecodeString(header)
+		var h jwtx.Header
+		require.NoError(t, json.Unmarshal(raw, &h))
+		h, claims := verifyHS256(t, r.Form.Get("client_assertion"), secrets[h.KeyID])
+		kids = append(kids, h.KeyID)
+		assert.Equal(t, "service", claims["iss"])
+		assert.Equal(t, "service", claims["sub"])
+		assert.Equal(t, "http://"+r.Host, claims["aud"])
+		assert.NotEmpty(t, claims["jti"])
+		assert.Equal(t, claims["iat"].(float64)+60, claims["exp"])
+	})
+	defer server.Close()
+
+	signer := jwtx.NewRotatingSigner(jwtx.NewHS256Signer(secrets["key-1"], "key-1"))
+	conf := &ClientCredentialsConfig{
+		ClientID:     "service",
+		ClientSecret: "unused",
+		Signer:       signer,
+		TokenURL:     server.URL,
+		AssertionTTL: time.Minute,
+	}
+	ctx := context.Background()
+	_, err := conf.TokenSource(ctx).Token()
+	require.NoError(t, err)
+
+	signer.Rotate(jwtx.NewHS256Signer(secrets["key-2"], "key-2"))
+	_, err = conf.TokenSource(ctx).Token()
+	require.NoError(t, err)
+	require.Equal(t, []string{"key-1", "key-2"}, kids)
+}
+
+func TestJWTBearer(t *testing.T) {
+	secret := []byte("secret")
+	server, _ := newGrantServer(t, func(r *http.Request) {
+		assert.Equal(t, grantTypeJWTBearer, r.Form.Get("grant_type"))
+		assert.Equal(t, "read", r.Form.Get("scope"))
+		assert.Empty(t, r.Form.Get("client_id"))
+
+		_, claims := verifyHS256(t, r.Form.Get("assertion"), secret)
+		assert.Equal(t, "issuer", claims["iss"])
+		assert.Equal(t, "user@example.com", claims["sub"])
+		assert.Equal(t, "http://"+r.Host, claims["aud"])
+		assert.Equal(t, "admin", claims["role"])
+		assert.Equal(t, claims["iat"].(float64)+defaultAssertionTTL.Seconds(), claims["exp"])
+	})
+	defer server.Close()
+
+	conf := &JWTBearerConfig{
+		Signer:        jwtx.NewHS256Signer(secret, ""),
+		Issuer:        "issuer",
+		Subject:       "user@example.com",
+		PrivateClaims: map[string]any{"role": "admin", "iss": "ignored"},
+		TokenURL:      server.URL,
+		Scopes:        []string{"read"},
+	}
+	token, err := conf.TokenSource(context.Background()).Token()
+	require.NoError(t, err)
+	require.Equal(t, "access_token_1", token.AccessToken)
+	require.True(t, token.Valid())
+}
@@ -0,0 +1,120 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"golang.org/x/oauth2"
+)
+
+// clientAuth authenticates the client to an endpoint,
+// by adding form values or headers to the request.
+type clientAuth func(v url.Values, req *http.Request)
+
+// secretClientAuth authenticates with the client secret, in the header or in the params.
+func secretClientAuth(clientID, clientSecret string, style oauth2.AuthStyle) clientAuth {
+	return func(v url.Values, req *http.Request) {
+		if style == oauth2.AuthStyleInHeader {
+			req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+			return
+		}
+		v.Set("client_id", clientID)
+		if clientSecret != "" {
+			v.Set("client_secret", clientSecret)
+		}
+	}
+}
+
+// authStyles caches the auth styles detected, by authStyleKey.
+var authStyles sync.Map
+
+// authStyleKey is the key of authStyles. The style is remembered per client,
+// as clients registered on the same endpoint may authenticate differently.
+type authStyleKey struct {
+	endpoint string
+	clientID string
+}
+
+// postEndpointWithSecret is postEndpoint authenticated by the client secret.
+// AuthStyleAutoDetect tries the header first, then the params if the endpoint rejects
+// the client with 400 or 401, and remembers the style that worked, the same as oauth2 does.
+// Other errors, e.g. 5xx or 429, are returned as they are.
+func postEndpointWithSecret(ctx context.Context, client *httpx.XClient, endpoint string, values url.Values,
+	clientID, clientSecret string, style oauth2.AuthStyle) ([]byte, error) {
+	if style != oauth2.AuthStyleAutoDetect {
+		return postEndpoint(ctx, client, endpoint, values, secretClientAuth(clientID, clientSecret, style))
+	}
+	key := authStyleKey{endpoint: endpoint, clientID: clientID}
+	if detected, ok := authStyles.Load(key); ok {
+		return postEndpoint(ctx, client, endpoint, values, secretClientAuth(clientID, clientSecret, detected.(oauth2.AuthStyle)))
+	}
+
+	style = oauth2.AuthStyleInHeader
+	raw, err := postEndpoint(ctx, client, endpoint, values, secretClientAuth(clientID, clientSecret, style))
+	var xErr *httpx.XError
+	if errors.As(err, &xErr) && (xErr.Code == http.StatusBadRequest || xErr.Code == http.StatusUnauthorized) {
+		style = oauth2.AuthStyleInParams
+		raw, err = postEndpoint(ctx, client, endpoint, values, secretClientAuth(clientID, clientSecret, style))
+	}
+	if err == nil {
+		authStyles.Store(key, style)
+	}
+	return raw, err
+}
+
+// postEndpoint posts the form values to an endpoint other than the token endpoint,
+// e.g. the introspection or revocation endpoint, and returns the response body.
+// If client is nil, httpx.NewXClient() is used. Non-2xx responses are returned
+// as *httpx.XError, even if the client is built without the default options.
+func postEndpoint(ctx context.Context, client *httpx.XClient, endpoint string, values url.Values, auth clientAuth) ([]byte, error) {
+	if client == nil {
+		client = defaultXClient
+	}
+	v := url.Values{}
+	for k, vs := range values {
+		v[k] = vs
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil {
+		auth(v, req)
+	}
+	body := v.Encode()
+	req.Body = io.NopCloser(strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(body)), nil
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &httpx.XError{
+			Response: resp,
+			Method:   req.Method,
+			Code:     resp.StatusCode,
+			Body:     raw,
+		}
+	}
+	return raw, nil
+}
+
+var defaultXClient = httpx.NewXClient()
@@ -0,0 +1,52 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+func TestPostEndpointAutoDetectPerClient(t *testing.T) {
+	ctx := context.Background()
+	// the client "in_header" authenticates in the header only,
+	// and the client "in_params" in the params only
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		id, _, ok := r.BasicAuth()
+		if (ok && id == "in_header") || (!ok && r.Form.Get("client_id") == "in_params") {
+			w.Write([]byte("ok"))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	for _, clientID := range []string{"in_params", "in_header", "in_params"} {
+		raw, err := postEndpointWithSecret(ctx, nil, server.URL, url.Values{}, clientID, "secret", oauth2.AuthStyleAutoDetect)
+		require.NoError(t, err, clientID)
+		require.Equal(t, "ok", string(raw))
+	}
+}
+
+func TestPostEndpointAutoDetectServerError(t *testing.T) {
+	ctx := context.Background()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := postEndpointWithSecret(ctx, nil, server.URL, url.Values{}, "cli", "secret", oauth2.AuthStyleAutoDetect)
+	var xErr *httpx.XError
+	require.True(t, errors.As(err, &xErr))
+	require.Equal(t, http.StatusServiceUnavailable, xErr.Code)
+	require.Equal(t, 1, requests) // not retried with the client in the params
+}
@@ -0,0 +1,119 @@
+package oauth2x
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/cachex"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/jwtx"
+	"golang.org/x/oauth2"
+)
+
+// IntrospectionResponse is the response of the token introspection endpoint (RFC 7662).
+// Only Active is required, the other fields are optional.
+type IntrospectionResponse struct {
+	Active    bool             `json:"active"`
+	Scope     string           `json:"scope,omitempty"`
+	ClientID  string           `json:"client_id,omitempty"`
+	Username  string           `json:"username,omitempty"`
+	TokenType string           `json:"token_type,omitempty"`
+	ExpiresAt jwtx.NumericDate `json:"exp,omitempty"`
+	IssuedAt  jwtx.NumericDate `json:"iat,omitempty"`
+	NotBefore jwtx.NumericDate `json:"nbf,omitempty"`
+	Subject   string           `json:"sub,omitempty"`
+	Audience  jwtx.Audience    `json:"aud,omitempty"`
+	Issuer    string           `json:"iss,omitempty"`
+	ID        string           `json:"jti,omitempty"`
+}
+
+// IntrospectionClient validates opaque tokens by the token introspection endpoint (RFC 7662).
+// Active responses are cached until their exp if Cache is set.
+//
+// Example:
+//
+//	introspector := &IntrospectionClient{
+//	    Endpoint:     "https://auth.example.com/introspect",
+//	    ClientID:     "resource-server",
+//	    ClientSecret: "secret",
+//	    Cache:        cachex.NewMemoryKeyedCacher(),
+//	    MaxCacheTTL:  time.Minute,
+//	}
+//	resp, err := introspector.Introspect(ctx, token)
+//	if err != nil {
+//	    return err
+//	}
+//	if !resp.Active {
+//	    return ErrUnauthorized
+//	}
+type IntrospectionClient struct {
+	Endpoint string
+	// ClientID and ClientSecret authenticate the caller to the endpoint.
+	ClientID     string
+	ClientSecret string
+	// AuthStyle is how ClientSecret is sent. AuthStyleAutoDetect tries the header first,
+	// then the params if the client is rejected with 400 or 401, as oauth2 does.
+	AuthStyle oauth2.AuthStyle
+
+	// Client sends the requests. If nil, httpx.NewXClient() is used.
+	Client *httpx.XClient
+
+	// Cache caches active responses by the SHA-256 of the token, until their exp.
+	// Responses without exp, and inactive responses, are not cached.
+	// If nil, every call requests the endpoint.
+	Cache cachex.KeyedCacher
+	// MaxCacheTTL limits how long a response is cached, so that a revoked token
+	// is noticed in time. Zero means no limit other than exp.
+	MaxCacheTTL time.Duration
+}
+
+// Introspect returns the state of the token. An invalid, expired or revoked token
+// is not an error, but a response with Active false.
+func (c *IntrospectionClient) Introspect(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	var cache *cachex.JSONCacher[introspectionCacheEntry]
+	if c.Cache != nil {
+		cache = cachex.NewJSONCacher[introspectionCacheEntry](c.Cache.Cacher(tokenCacheKey(token)))
+		// the cache is best effort, errors fall back to the endpoint
+		if cached, err := cache.Get(ctx); err == nil && cached.Response.Active && time.Now().Before(cached.Until) {
+			return &cached.Response, nil
+		}
+	}
+
+	raw, err := postEndpointWithSecret(ctx, c.Client, c.Endpoint, url.Values{"token": {token}},
+		c.ClientID, c.ClientSecret, c.AuthStyle)
+	if err != nil {
+		return nil, err
+	}
+	var resp IntrospectionResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("oauth2x: cannot parse introspection response: %w", err)
+	}
+
+	if cache != nil && resp.Active && resp.ExpiresAt != 0 {
+		until := resp.ExpiresAt.Time()
+		if c.MaxCacheTTL > 0 && time.Until(until) > c.MaxCacheTTL {
+			until = time.Now().Add(c.MaxCacheTTL)
+		}
+		if ttl := time.Until(until); ttl > 0 {
+			cache.Set(ctx, &introspectionCacheEntry{Response: resp, Until: until}, ttl)
+		}
+	}
+	return &resp, nil
+}
+
+type introspectionCacheEntry struct {
+	Response IntrospectionResponse `json:"response"`
+	Until    time.Time             `json:"until"`
+}
+
+// tokenCacheKey does not use the token itself as the key,
+// so that tokens are not leaked through the cache.
+func tokenCacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,213 @@
+package oauth2x
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/cachex"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// tokenAdminServer serves the introspection and revocation endpoints,
+// and records the tokens revoked.
+type tokenAdminServer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu          sync.Mutex
+	introspects int
+	revoked     []string // token:hint
+	rejected    int      // revocations rejected for the client in the header
+}
+
+func newTokenAdminServer(t *testing.T) *tokenAdminServer {
+	s := &tokenAdminServer{t: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/introspect", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		id, secret, _ := r.BasicAuth()
+		assert.Equal(t, "resource", id)
+		assert.Equal(t, "secret", secret)
+
+		s.mu.Lock()
+		s.introspects++
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Form.Get("token") {
+		case "active":
+			fmt.Fprintf(w, `{"active":true,"sub":"user","aud":"api","scope":"read","exp":%d}`, time.Now().Add(time.Hour).Unix())
+		case "no_exp":
+			w.Write([]byte(`{"active":true,"sub":"user"}`))
+		default:
+			w.Write([]byte(`{"active":false}`))
+		}
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		// accepts the client in the params only, like Google
+		if r.Form.Get("client_id") != "cli" {
+			s.mu.Lock()
+			s.rejected++
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Form.Get("token") == "unavailable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.mu.Lock()
+		s.revoked = append(s.revoked, r.Form.Get("token")+":"+r.Form.Get("token_type_hint"))
+		s.mu.Unlock()
+	})
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *tokenAdminServer) introspectionClient() *IntrospectionClient {
+	return &IntrospectionClient{
+		Endpoint:     s.URL + "/introspect",
+		ClientID:     "resource",
+		ClientSecret: "secret",
+		AuthStyle:    oauth2.AuthStyleInHeader,
+		Cache:        cachex.NewMemoryKeyedCacher(),
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	server := newTokenAdminServer(t)
+	defer server.Close()
+	client := server.introspectionClient()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Introspect(ctx, "active")
+		require.NoError(t, err)
+		require.True(t, resp.Active)
+		require.Equal(t, "user", resp.Subject)
+		require.True(t, resp.Audience.Contains("api"))
+		require.Equal(t, "read", resp.Scope)
+	}
+	require.Equal(t, 1, server.introspects, "active response should be cached until exp")
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Introspect(ctx, "no_exp")
+		require.NoError(t, err)
+		require.True(t, resp.Active)
+		resp, err = client.Introspect(ctx, "revoked")
+		require.NoError(t, err)
+		require.False(t, resp.Active)
+	}
+	require.Equal(t, 5, server.introspects, "responses without exp and inactive responses should not be cached")
+}
+
+func TestIntrospectMaxCacheTTL(t *testing.T) {
+	server := newTokenAdminServer(t)
+	defer server.Close()
+	client := server.introspectionClient()
+	client.MaxCacheTTL = 50 * time.Millisecond
+	ctx := context.Background()
+
+	_, err := client.Introspect(ctx, "active")
+	require.NoError(t, err)
+	_, err = client.Introspect(ctx, "active")
+	require.NoError(t, err)
+	require.Equal(t, 1, server.introspects)
+
+	time.Sleep(100 * time.Millisecond)
+	resp, err := client.Introspect(ctx, "active")
+	require.NoError(t, err)
+	require.Greater(t, time.Until(resp.ExpiresAt.Time()), 50*time.Minute, "exp should not be changed by MaxCacheTTL")
+	require.Equal(t, 2, server.introspects)
+}
+
+func TestRevoke(t *testing.T) {
+	server := newTokenAdminServer(t)
+	defer server.Close()
+	revoker := &RevocationClient{Endpoint: server.URL + "/revoke", ClientID: "cli"}
+	ctx := context.Background()
+
+	require.NoError(t, revoker.Revoke(ctx, "token", ""))
+	require.NoError(t, revoker.Revoke(ctx, "token", TokenTypeHintRefreshToken))
+	require.Equal(t, []string{"token:", "token:refresh_token"}, server.revoked)
+	require.Equal(t, 1, server.rejected, "the auth style detected should be remembered")
+
+	var xErr *httpx.XError
+	require.ErrorAs(t, revoker.Revoke(ctx, "unavailable", TokenTypeHintAccessToken), &xErr)
+	require.Equal(t, http.StatusServiceUnavailable, xErr.Code)
+}
+
+func TestOAuth2CoreLogout(t *testing.T) {
+	admin := newTokenAdminServer(t)
+	defer admin.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer api.Close()
+
+	source := &countingTokenSource{expiry: time.Hour}
+	var core *OAuth2Core
+	client := httpx.NewXClient(WithOAuth2Http(context.Background(), nil, source,
+		WithRevocation(&RevocationClient{Endpoint: admin.URL + "/revoke", ClientID: "cli"}),
+		func(t *OAuth2Core) { core = t },
+	))
+	ctx := context.Background()
+
+	resp, err := client.Get(ctx, api.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "refresh_token_1", core.CurrentRefreshToken)
+
+	require.NoError(t, core.Logout(ctx))
+	require.Equal(t, []string{"refresh_token_1:refresh_token", "access_token_1:access_token"}, admin.revoked)
+	require.Empty(t, core.CurrentRefreshToken)
+
+	_, err = client.Get(ctx, api.URL)
+	require.ErrorIs(t, err, ErrLoggedOut)
+	require.Equal(t, 1, source.calls)
+}
+
+func TestOAuth2CoreLogoutDuringRetry(t *testing.T) {
+	loggedOut := make(chan struct{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-loggedOut // the session is logged out while the request is in flight
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer api.Close()
+
+	forceRefreshes := 0
+	var core *OAuth2Core
+	client := httpx.NewXClient(WithOAuth2Http(context.Background(), nil, &countingTokenSource{expiry: time.Hour},
+		WithRetryOnUnauthorized(func(ctx context.Context, oldToken *oauth2.Token) (*oauth2.Token, oauth2.TokenSource, error) {
+			forceRefreshes++
+			return &oauth2.Token{AccessToken: "revived", RefreshToken: "revived"}, nil, nil
+		}),
+		func(t *OAuth2Core) { core = t },
+	))
+	ctx := context.Background()
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := client.Get(ctx, api.URL)
+		errCh <- err
+	}()
+	require.Eventually(t, func() bool {
+		core.mu.Lock()
+		defer core.mu.Unlock()
+		return core.token != nil
+	}, time.Second, time.Millisecond)
+	require.NoError(t, core.Logout(ctx))
+	close(loggedOut)
+
+	require.ErrorIs(t, <-errCh, ErrLoggedOut)
+	require.Zero(t, forceRefreshes, "the retry must not bring the session back")
+	require.Empty(t, core.CurrentRefreshToken)
+	_, err := client.Get(ctx, api.URL)
+	require.ErrorIs(t, err, ErrLoggedOut)
+}
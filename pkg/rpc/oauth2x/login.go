@@ -0,0 +1,164 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrStateMismatch is returned when the state of the authorization
+	// callback does not match the state sent, which may be a CSRF attack.
+	ErrStateMismatch = errors.New("oauth2x: authorization callback state mismatch")
+
+	// ErrAccessDenied is returned when the user denies the authorization.
+	ErrAccessDenied = errors.New("oauth2x: access denied")
+
+	// ErrDeviceCodeExpired is returned when the device code expires
+	// before the user completes the authorization.
+	ErrDeviceCodeExpired = errors.New("oauth2x: device code expired")
+)
+
+type loginConfig struct {
+	listenAddr      string
+	callbackPath    string
+	successPage     string
+	authCodeOptions []oauth2.AuthCodeOption
+}
+
+// LoginOption configures LoginWithAuthCode and LoginWithDeviceCode.
+type LoginOption func(*loginConfig)
+
+// WithListenAddr sets the address of the loopback redirect listener.
+// The default is "127.0.0.1:0", which listens on a random port.
+// Use a fixed port if the authorization server requires an exact redirect URL.
+func WithListenAddr(addr string) LoginOption {
+	return func(c *loginConfig) {
+		c.listenAddr = addr
+	}
+}
+
+// WithCallbackPath sets the path of the loopback redirect URL. The default is "/callback".
+func WithCallbackPath(path string) LoginOption {
+	return func(c *loginConfig) {
+		c.callbackPath = path
+	}
+}
+
+// WithSuccessPage sets the page shown in the browser after the callback is received.
+func WithSuccessPage(html string) LoginOption {
+	return func(c *loginConfig) {
+		c.successPage = html
+	}
+}
+
+// WithAuthCodeOptions adds options to the authorization request,
+// e.g. oauth2.AccessTypeOffline or oauth2.SetAuthURLParam("audience", "...").
+func WithAuthCodeOptions(opts ...oauth2.AuthCodeOption) LoginOption {
+	return func(c *loginConfig) {
+		c.authCodeOptions = append(c.authCodeOptions, opts...)
+	}
+}
+
+func newLoginConfig(opts ...LoginOption) *loginConfig {
+	c := &loginConfig{
+		listenAddr:   "127.0.0.1:0",
+		callbackPath: "/callback",
+		successPage:  "<html><body>Login succeeded. You can close this window now.</body></html>",
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// LoginWithAuthCode runs the authorization code flow with PKCE for CLIs,
+// receiving the authorization code by a loopback redirect listener (RFC 8252).
+//
+// It listens on the loopback address, sets conf.RedirectURL to it (on a copy of conf),
+// and calls openURL with the authorization URL, which should open it in a browser
+// or print it for the user. It returns the token once the authorization code is
+// exchanged, or an error if ctx is done first.
+//
+// Example:
+//
+//	token, err := LoginWithAuthCode(ctx, conf, func(authURL string) error {
+//	    fmt.Println("Open the URL to login:", authURL)
+//	    return nil
+//	})
+//	client := httpx.NewXClient(WithOAuth2Http(ctx, token, conf.TokenSource(ctx, token)))
+func LoginWithAuthCode(ctx context.Context, conf *oauth2.Config, openURL func(authURL string) error, opts ...LoginOption) (*oauth2.Token, error) {
+	cfg := newLoginConfig(opts...)
+
+	listener, err := net.Listen("tcp", cfg.listenAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	confCopy := *conf
+	conf = &confCopy
+	conf.RedirectURL = fmt.Sprintf("http://%s%s", listener.Addr().String(), cfg.callbackPath)
+
+	state, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	type callbackResult struct {
+		code string
+		err  error
+	}
+	resultCh := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		result := callbackResult{}
+		query := r.URL.Query()
+		switch {
+		case query.Get("state") != state:
+			result.err = ErrStateMismatch
+		case query.Get("error") == "access_denied":
+			result.err = fmt.Errorf("%w: %s", ErrAccessDenied, query.Get("error_description"))
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("oauth2x: authorization failed: %s: %s", query.Get("error"), query.Get("error_description"))
+		case query.Get("code") == "":
+			result.err = errors.New("oauth2x: authorization callback without code")
+		default:
+			result.code = query.Get("code")
+		}
+
+		if result.err != nil {
+			http.Error(w, result.err.Error(), http.StatusBadRequest)
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(cfg.successPage))
+		}
+		select {
+		case resultCh <- result:
+		default: // only the first callback counts
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authOpts := append([]oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}, cfg.authCodeOptions...)
+	if err := openURL(conf.AuthCodeURL(state, authOpts...)); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-resultCh:
+		if result.err != nil {
+			return nil, result.err
+		}
+		return conf.Exchange(ctx, result.code, oauth2.VerifierOption(verifier))
+	}
+}
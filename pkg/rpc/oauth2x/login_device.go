@@ -0,0 +1,54 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/oauth2"
+)
+
+// LoginWithDeviceCode runs the device authorization grant (RFC 8628) for CLIs
+// on devices without a browser.
+//
+// It requests a device code from conf.Endpoint.DeviceAuthURL, calls prompt with
+// the user code and verification URI to show to the user, and then polls
+// conf.Endpoint.TokenURL until the user completes the authorization,
+// by conf.DeviceAuth and conf.DeviceAccessToken.
+//
+// It returns ErrAccessDenied if the user denies the authorization,
+// ErrDeviceCodeExpired if the device code expires, or ctx.Err() if ctx is done first.
+//
+// Example:
+//
+//	token, err := LoginWithDeviceCode(ctx, conf, func(da *oauth2.DeviceAuthResponse) error {
+//	    fmt.Printf("Open %s and enter the code %s\n", da.VerificationURI, da.UserCode)
+//	    return nil
+//	})
+func LoginWithDeviceCode(ctx context.Context, conf *oauth2.Config, prompt func(da *oauth2.DeviceAuthResponse) error, opts ...LoginOption) (*oauth2.Token, error) {
+	cfg := newLoginConfig(opts...)
+
+	da, err := conf.DeviceAuth(ctx, cfg.authCodeOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if err := prompt(da); err != nil {
+		return nil, err
+	}
+
+	token, err := conf.DeviceAccessToken(ctx, da, cfg.authCodeOptions...)
+	if err == nil {
+		return token, nil
+	}
+	var retrieveErr *oauth2.RetrieveError
+	switch {
+	case errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "access_denied":
+		return nil, fmt.Errorf("%w: %s", ErrAccessDenied, retrieveErr.ErrorDescription)
+	case errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "expired_token":
+		return nil, ErrDeviceCodeExpired
+	case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		// DeviceAccessToken polls until da.Expiry
+		return nil, ErrDeviceCodeExpired
+	}
+	return nil, err
+}
@@ -0,0 +1,187 @@
+package oauth2x
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// fakeAuthServer is a local authorization server supporting the authorization
+// code flow with PKCE and the device authorization grant.
+type fakeAuthServer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu          sync.Mutex
+	challenges  map[string]string // code -> code_challenge
+	deviceSteps []string          // error codes to respond before issuing the device token
+	devicePolls int
+}
+
+func newFakeAuthServer(t *testing.T) *fakeAuthServer {
+	s := &fakeAuthServer{t: t, challenges: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/device", s.device)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *fakeAuthServer) config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID: "cli",
+		Scopes:   []string{"openid"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       s.URL + "/authorize",
+			DeviceAuthURL: s.URL + "/device",
+			TokenURL:      s.URL + "/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// authorize approves immediately and redirects back with a code.
+func (s *fakeAuthServer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	assert.Equal(s.t, "code", q.Get("response_type"))
+	assert.Equal(s.t, "S256", q.Get("code_challenge_method"))
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	require.NoError(s.t, err)
+	assert.Equal(s.t, "127.0.0.1", redirect.Hostname())
+
+	s.mu.Lock()
+	code := fmt.Sprintf("code_%d", len(s.challenges))
+	s.challenges[code] = q.Get("code_challenge")
+	s.mu.Unlock()
+
+	callback := redirect.Query()
+	callback.Set("code", code)
+	callback.Set("state", q.Get("state"))
+	redirect.RawQuery = callback.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *fakeAuthServer) device(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"device_code":"device_code","user_code":"ABCD-EFGH","verification_uri":"%s/activate","expires_in":60,"interval":1}`, s.URL)
+}
+
+func (s *fakeAuthServer) token(w http.ResponseWriter, r *http.Request) {
+	require.NoError(s.t, r.ParseForm())
+	w.Header().Set("Content-Type", "application/json")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Form.Get("grant_type") {
+	case "authorization_code":
+		challenge, ok := s.challenges[r.Form.Get("code")]
+		if !ok || oauth2.S256ChallengeFromVerifier(r.Form.Get("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"code_access_token","refresh_token":"code_refresh_token","token_type":"Bearer","expires_in":3600}`))
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		assert.Equal(s.t, "device_code", r.Form.Get("device_code"))
+		assert.Equal(s.t, "cli", r.Form.Get("client_id"))
+		s.devicePolls++
+		if len(s.deviceSteps) > 0 {
+			step := s.deviceSteps[0]
+			s.deviceSteps = s.deviceSteps[1:]
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"error":%q}`, step)
+			return
+		}
+		w.Write([]byte(`{"access_token":"device_access_token","refresh_token":"device_refresh_token","token_type":"Bearer","expires_in":3600,"id_token":"id"}`))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"unsupported_grant_type"}`))
+	}
+}
+
+func TestLoginWithAuthCode(t *testing.T) {
+	server := newFakeAuthServer(t)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := LoginWithAuthCode(ctx, server.config(), func(authURL string) error {
+		// act as the browser, following the redirect to the loopback listener
+		go func() {
+			res, err := http.Get(authURL)
+			if assert.NoError(t, err) {
+				assert.Equal(t, http.StatusOK, res.StatusCode)
+				res.Body.Close()
+			}
+		}()
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "code_access_token", token.AccessToken)
+	require.Equal(t, "code_refresh_token", token.RefreshToken)
+}
+
+func TestLoginWithAuthCodeStateMismatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conf := &oauth2.Config{ClientID: "cli", Endpoint: oauth2.Endpoint{AuthURL: "http://auth.invalid/authorize"}}
+	_, err := LoginWithAuthCode(ctx, conf, func(authURL string) error {
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		go func() {
+			res, err := http.Get(u.Query().Get("redirect_uri") + "?code=code&state=forged")
+			if assert.NoError(t, err) {
+				res.Body.Close()
+			}
+		}()
+		return nil
+	})
+	require.ErrorIs(t, err, ErrStateMismatch)
+}
+
+func TestLoginWithDeviceCode(t *testing.T) {
+	t.Parallel() // polls every second
+
+	server := newFakeAuthServer(t)
+	defer server.Close()
+	server.deviceSteps = []string{"authorization_pending"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var userCode string
+	token, err := LoginWithDeviceCode(ctx, server.config(), func(da *oauth2.DeviceAuthResponse) error {
+		userCode = da.UserCode
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ABCD-EFGH", userCode)
+	require.Equal(t, "device_access_token", token.AccessToken)
+	require.Equal(t, "device_refresh_token", token.RefreshToken)
+	require.Equal(t, "id", token.Extra("id_token"))
+	require.Equal(t, 2, server.devicePolls)
+}
+
+func TestLoginWithDeviceCodeDenied(t *testing.T) {
+	t.Parallel()
+
+	server := newFakeAuthServer(t)
+	defer server.Close()
+	server.deviceSteps = []string{"access_denied"}
+
+	_, err := LoginWithDeviceCode(context.Background(), server.config(), func(da *oauth2.DeviceAuthResponse) error {
+		return nil
+	})
+	require.ErrorIs(t, err, ErrAccessDenied)
+}
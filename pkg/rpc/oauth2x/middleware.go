@@ -0,0 +1,168 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/jwtx"
+)
+
+var (
+	// ErrMissingToken is returned when the request has no bearer token.
+	ErrMissingToken = errors.New("oauth2x: missing bearer token")
+
+	// ErrInvalidToken is returned when the bearer token is invalid, expired or revoked.
+	// Validators should wrap it, or jwtx.ErrInvalidToken, for tokens they reject.
+	ErrInvalidToken = errors.New("oauth2x: invalid bearer token")
+)
+
+// TokenValidator validates a bearer token and returns its claims,
+// e.g. by verifying a JWT with JWKS by jwtx.Verifier, or by the introspection endpoint.
+type TokenValidator[T any] interface {
+	ValidateToken(ctx context.Context, token string) (T, error)
+}
+
+// TokenValidatorFunc adapts a function to a TokenValidator.
+type TokenValidatorFunc[T any] func(ctx context.Context, token string) (T, error)
+
+func (f TokenValidatorFunc[T]) ValidateToken(ctx context.Context, token string) (T, error) {
+	return f(ctx, token)
+}
+
+// ValidateToken implements TokenValidator by Introspect,
+// returning ErrInvalidToken if the token is not active.
+func (c *IntrospectionClient) ValidateToken(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	resp, err := c.Introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Active {
+		return nil, ErrInvalidToken
+	}
+	return resp, nil
+}
+
+var _ TokenValidator[*IntrospectionResponse] = (*IntrospectionClient)(nil)
+
+type claimsKey[T any] struct{}
+
+// ContextWithClaims returns a context carrying the claims of the bearer token.
+func ContextWithClaims[T any](ctx context.Context, claims T) context.Context {
+	return context.WithValue(ctx, claimsKey[T]{}, claims)
+}
+
+// ClaimsFromContext returns the claims put into the context by BearerMiddleware
+// with a validator of the same claims type.
+func ClaimsFromContext[T any](ctx context.Context) (T, bool) {
+	claims, ok := ctx.Value(claimsKey[T]{}).(T)
+	return claims, ok
+}
+
+type bearerConfig struct {
+	realm        string
+	optional     bool
+	errorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// BearerOption configures BearerMiddleware.
+type BearerOption func(*bearerConfig)
+
+// WithRealm sets the realm of the WWW-Authenticate header of 401 responses.
+func WithRealm(realm string) BearerOption {
+	return func(c *bearerConfig) {
+		c.realm = realm
+	}
+}
+
+// WithOptionalToken lets requests without a bearer token through without claims.
+// Requests with an invalid token are still rejected.
+func WithOptionalToken() BearerOption {
+	return func(c *bearerConfig) {
+		c.optional = true
+	}
+}
+
+// WithBearerErrorHandler replaces the default error response, which is 401 with
+// a WWW-Authenticate header for ErrMissingToken, ErrInvalidToken and jwtx.ErrInvalidToken (RFC 6750),
+// and 500 for other errors of the validator.
+func WithBearerErrorHandler(handler func(w http.ResponseWriter, r *http.Request, err error)) BearerOption {
+	return func(c *bearerConfig) {
+		c.errorHandler = handler
+	}
+}
+
+// BearerMiddleware is the server side of OAuth2Core. It extracts the bearer token
+// from the Authorization header, validates it by validator, and puts the claims
+// into the request context, which can be got by ClaimsFromContext.
+//
+// Example:
+//
+//	introspector := &IntrospectionClient{Endpoint: introspectURL, ClientID: "api", ClientSecret: secret}
+//	handler := BearerMiddleware[*IntrospectionResponse](introspector, WithRealm("api"))(mux)
+//
+//	// in the handler
+//	claims, ok := ClaimsFromContext[*IntrospectionResponse](r.Context())
+func BearerMiddleware[T any](validator TokenValidator[T], opts ...BearerOption) func(http.Handler) http.Handler {
+	cfg := &bearerConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.errorHandler == nil {
+		cfg.errorHandler = cfg.writeError
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				if cfg.optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				cfg.errorHandler(w, r, ErrMissingToken)
+				return
+			}
+
+			claims, err := validator.ValidateToken(r.Context(), token)
+			if err != nil {
+				cfg.errorHandler(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+// bearerToken returns the token of the "Authorization: Bearer <token>" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func (c *bearerConfig) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	challenge := "Bearer"
+	if c.realm != "" {
+		challenge += fmt.Sprintf(" realm=%q", c.realm)
+	}
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		// RFC 6750 section 3.1: no error code if the request lacks authentication
+	case errors.Is(err, ErrInvalidToken) || errors.Is(err, jwtx.ErrInvalidToken):
+		if c.realm != "" {
+			challenge += ","
+		}
+		challenge += ` error="invalid_token"`
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,158 @@
+package oauth2x
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/jwtx"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+type testClaims struct {
+	Subject string
+}
+
+var testValidator = TokenValidatorFunc[testClaims](func(ctx context.Context, token string) (testClaims, error) {
+	switch token {
+	case "good":
+		return testClaims{Subject: "user"}, nil
+	case "broken":
+		return testClaims{}, errors.New("validator down")
+	default:
+		return testClaims{}, ErrInvalidToken
+	}
+})
+
+func serveBearer(handler http.Handler, authorization string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBearerMiddleware(t *testing.T) {
+	handler := BearerMiddleware[testClaims](testValidator, WithRealm("api"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext[testClaims](r.Context())
+			require.True(t, ok)
+			w.Write([]byte(claims.Subject))
+		}))
+
+	rec := serveBearer(handler, "bearer good")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "user", rec.Body.String())
+
+	rec = serveBearer(handler, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, `Bearer realm="api"`, rec.Header().Get("WWW-Authenticate"))
+
+	rec = serveBearer(handler, "Basic dXNlcjpwYXNz")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serveBearer(handler, "Bearer expired")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, `Bearer realm="api", error="invalid_token"`, rec.Header().Get("WWW-Authenticate"))
+
+	rec = serveBearer(handler, "Bearer broken")
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestBearerMiddlewareOptional(t *testing.T) {
+	handler := BearerMiddleware[testClaims](testValidator, WithOptionalToken())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := ClaimsFromContext[testClaims](r.Context())
+			require.False(t, ok)
+		}))
+
+	require.Equal(t, http.StatusOK, serveBearer(handler, "").Code)
+	require.Equal(t, http.StatusUnauthorized, serveBearer(handler, "Bearer expired").Code)
+}
+
+func TestBearerMiddlewareIntrospection(t *testing.T) {
+	admin := newTokenAdminServer(t)
+	defer admin.Close()
+	handler := BearerMiddleware[*IntrospectionResponse](admin.introspectionClient())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext[*IntrospectionResponse](r.Context())
+			w.Write([]byte(claims.Subject))
+		}))
+
+	rec := serveBearer(handler, "Bearer active")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "user", rec.Body.String())
+	require.Equal(t, http.StatusUnauthorized, serveBearer(handler, "Bearer revoked").Code)
+}
+
+func TestOAuth2CoreRoundTrip(t *testing.T) {
+	// the client side and the server side of the bearer token
+	server := httptest.NewServer(BearerMiddleware[testClaims](testValidator)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	defer server.Close()
+
+	core := &OAuth2Core{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "good", Expiry: time.Now().Add(time.Hour)}),
+		Inner:  http.DefaultClient,
+		Ctx:    context.Background(),
+	}
+	resp, err := (&http.Client{Transport: core}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 401 is passed through the RoundTripper
+	core = &OAuth2Core{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "expired"}),
+		Inner:  http.DefaultClient,
+		Ctx:    context.Background(),
+	}
+	resp, err = (&http.Client{Transport: core}).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// the decorator of an XClient still returns the authentication error
+	httpCli := httpx.NewXClient(WithOAuth2Http(context.Background(), nil,
+		oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "expired"}),
+		WithAuthError(ErrInvalidToken),
+	)).HTTPClient()
+	_, err = httpCli.Get(server.URL)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestBearerMiddlewareJWT(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	jwk, err := jwtx.NewJWK(key.Public(), "key-1")
+	require.NoError(t, err)
+	signer := jwtx.NewEdDSASigner(key, "key-1")
+	verifier := jwtx.NewVerifier[jwtx.RegisteredClaims](jwtx.NewStaticKeySet(jwtx.JWKS{Keys: []jwtx.JWK{jwk}}))
+
+	handler := BearerMiddleware[jwtx.RegisteredClaims](verifier)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, _ := ClaimsFromContext[jwtx.RegisteredClaims](r.Context())
+			w.Write([]byte(claims.Subject))
+		}))
+
+	token, err := jwtx.Sign(signer, jwtx.RegisteredClaims{Subject: "user", ExpiresAt: jwtx.NewNumericDate(time.Now().Add(time.Hour))})
+	require.NoError(t, err)
+	rec := serveBearer(handler, "Bearer "+token)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "user", rec.Body.String())
+
+	expired, err := jwtx.Sign(signer, jwtx.RegisteredClaims{Subject: "user", ExpiresAt: jwtx.NewNumericDate(time.Now().Add(-time.Hour))})
+	require.NoError(t, err)
+	rec = serveBearer(handler, "Bearer "+expired)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.Equal(t, `Bearer error="invalid_token"`, rec.Header().Get("WWW-Authenticate"))
+}
@@ -15,6 +15,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
 	"golang.org/x/oauth2"
@@ -35,6 +37,10 @@ import (
 //	        return saveToken(newToken)
 //	    },
 //	}
+//
+// OAuth2Core is safe for concurrent use. The token is cached until it is about to
+// expire, and concurrent requests share a single refresh, each waiting for it
+// until its own context is done.
 type OAuth2Core struct {
 	// Source supplies the token to add to outgoing requests'
 	// Authorization headers.
@@ -44,24 +50,74 @@ type OAuth2Core struct {
 	// If nil, http.DefaultClient is used.
 	Inner httpx.Client
 
+	// RefreshSkew is how long before expiry the cached token is considered stale,
+	// and a new token is asked from Source. If zero, defaultRefreshSkew is used.
+	// Source should honor the same skew to refresh proactively,
+	// e.g. by oauth2.ReuseTokenSourceWithExpiry.
+	RefreshSkew time.Duration
+
 	Ctx                      context.Context
 	ErrAuthenticationInvalid error  // error to return when RefreshTokenFailed / AuthorizationFailed
-	CurrentRefreshToken      string // used to compare with the new token
+	CurrentRefreshToken      string // used to compare with the new token, guarded by mu once in use
 	OnRefreshTokenChange     func(ctx context.Context, newToken *oauth2.Token) error
 	OnAuthError              func(ctx context.Context, oldToken *oauth2.Token, refreshErr error)
 	OnRecordError            func(ctx context.Context, err error)
+
+	// RetryOnUnauthorized enables replaying the request once with a force refreshed
+	// token when the server responds 401. See WithRetryOnUnauthorized.
+	RetryOnUnauthorized bool
+	// ForceRefresh gets a new token bypassing any cache when retrying on 401.
+	// If nil, the cached token is dropped and a token is asked from Source.
+	// The request is not replayed if the same access token is got again.
+	ForceRefresh ForceRefreshFunc
+
+	// Revoker revokes the tokens on Logout. If nil, Logout only clears them.
+	Revoker *RevocationClient
+
+	mu                sync.Mutex         // guards the fields below and CurrentRefreshToken
+	token             *oauth2.Token      // cached token
+	refreshTokenKnown bool               // whether OnRefreshTokenChange has seen CurrentRefreshToken
+	refreshedSource   oauth2.TokenSource // replaces Source after ForceRefresh if not nil
+	loggedOut         bool               // set by Logout, no token is got afterwards
+	refreshing        *tokenCall         // the refresh in flight, nil if none
 }
 
+// defaultRefreshSkew is the same as the expiryDelta of oauth2.
+const defaultRefreshSkew = 10 * time.Second
+
 // Do authorizes and authenticates the request with an access token.
 // It will:
-// 1. Get a valid token from the TokenSource
+// 1. Get a valid token from the cache, or from the TokenSource if the cached one is about to expire
 // 2. Trigger OnRefreshTokenChange if the refresh token has changed
 // 3. Add the token to the request's Authorization header
 // 4. Execute the request
-// 5. Handle authentication errors (401/403) by returning ErrAuthenticationInvalid
+// 5. If RetryOnUnauthorized is set and the response is 401, force refresh the token and replay the request once
+// 6. Handle authentication errors (401/403) by returning ErrAuthenticationInvalid
 //
 // Note: When returning an error, the response body will be closed automatically.
 func (t *OAuth2Core) Do(req *http.Request) (*http.Response, error) {
+	resp, token, err := t.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		defer resp.Body.Close() // golang HTTP 规范要求 RoundTrip 中返回 err 时，resp.Body 需要关闭
+		respBuf, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.recordError(t.Ctx, err)
+		}
+
+		err = fmt.Errorf("oauth2: Authorization failed, resp: %s", string(respBuf))
+		return nil, t.returnAuthError(token, err) // 返回特定错误
+	}
+
+	return resp, nil
+}
+
+// send sends the request with the token, retrying on 401 if RetryOnUnauthorized,
+// and returns the response with the token sent.
+func (t *OAuth2Core) send(req *http.Request) (*http.Response, *oauth2.Token, error) {
 	reqBodyClosed := false
 	if req.Body != nil {
 		defer func() {
@@ -72,15 +128,14 @@ func (t *OAuth2Core) Do(req *http.Request) (*http.Response, error) {
 	}
 
 	if t.Source == nil {
-		return nil, errors.New("oauth2: Transport's Source is nil")
-	}
-	token, err := t.Source.Token()
-	if err != nil {
-		return nil, t.returnAuthError(token, err) // 返回特定错误
+		return nil, nil, errors.New("oauth2: Transport's Source is nil")
 	}
-	err = t.doIfRefreshTokenChanged(token)
+	token, err := t.getToken(req.Context())
 	if err != nil {
-		return nil, t.returnAuthError(token, err) // 返回特定错误
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, nil, ctxErr // 不是认证错误
+		}
+		return nil, nil, t.returnAuthError(token, err) // 返回特定错误
 	}
 
 	req2 := t.cloneRequest(req) // per RoundTripper contract
@@ -90,23 +145,60 @@ func (t *OAuth2Core) Do(req *http.Request) (*http.Response, error) {
 	reqBodyClosed = true
 	resp, err := t.base().Do(req2)
 	if err != nil {
-		return nil, err // 这里不需要特殊处理，因为 err 不是认证错误
+		return nil, nil, err // 这里不需要特殊处理，因为 err 不是认证错误
 	}
 
-	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		defer resp.Body.Close() // golang HTTP 规范要求 RoundTrip 中返回 err 时，resp.Body 需要关闭
-		respBuf, err := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnauthorized && t.RetryOnUnauthorized && canReplay(req) {
+		newToken, err := t.forceRefresh(req.Context(), token)
+		if err == nil && newToken.AccessToken == token.AccessToken {
+			// 拿到的还是被拒绝的 token，重放也会失败
+			return resp, token, nil
+		}
+		resp.Body.Close()
+		token = newToken
 		if err != nil {
-			t.recordError(t.Ctx, err)
+			if ctxErr := req.Context().Err(); ctxErr != nil {
+				return nil, nil, ctxErr // 不是认证错误
+			}
+			return nil, nil, t.returnAuthError(token, err) // 返回特定错误
 		}
 
-		err = fmt.Errorf("oauth2: Authorization failed, resp: %s", string(respBuf))
-		return nil, t.returnAuthError(token, err) // 返回特定错误
+		req3, err := t.replayRequest(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		token.SetAuthHeader(req3)
+		resp, err = t.base().Do(req3)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 
-	return resp, nil
+	return resp, token, nil
 }
 
+// RoundTrip implements http.RoundTripper, so that OAuth2Core can be used as the
+// Transport of an *http.Client for third-party SDKs. Inner must not be that *http.Client.
+//
+// Unlike Do, it returns the 401 and 403 responses as they are, as a RoundTripper must,
+// after retrying on 401 if RetryOnUnauthorized. Errors getting the token are still
+// returned, by ErrAuthenticationInvalid if set.
+//
+// Example:
+//
+//	core := &OAuth2Core{
+//	    Source: conf.TokenSource(ctx, token),
+//	    Inner:  http.DefaultClient,
+//	    Ctx:    ctx,
+//	}
+//	sdk := thirdparty.NewClient(&http.Client{Transport: core})
+func (t *OAuth2Core) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, _, err := t.send(req)
+	return resp, err
+}
+
+var _ http.RoundTripper = (*OAuth2Core)(nil)
+
 func (t *OAuth2Core) base() httpx.Client {
 	if t.Inner != nil {
 		return t.Inner
@@ -128,14 +220,134 @@ func (t *OAuth2Core) cloneRequest(r *http.Request) *http.Request {
 	return r2
 }
 
-func (t *OAuth2Core) doIfRefreshTokenChanged(newToken *oauth2.Token) error {
-	if t.CurrentRefreshToken == "" || t.CurrentRefreshToken != newToken.RefreshToken {
-		t.CurrentRefreshToken = newToken.RefreshToken
-		if t.OnRefreshTokenChange != nil {
-			return t.OnRefreshTokenChange(t.Ctx, newToken)
+// getToken returns the cached token, or gets a new one from Source if the cached
+// one is about to expire. Concurrent callers share the refresh in flight,
+// so Source is asked and OnRefreshTokenChange is triggered only once per refresh,
+// and each caller stops waiting once its ctx is done.
+func (t *OAuth2Core) getToken(ctx context.Context) (*oauth2.Token, error) {
+	t.mu.Lock()
+	if t.loggedOut {
+		t.mu.Unlock()
+		return nil, ErrLoggedOut
+	}
+	if t.token != nil && !t.expiresSoon(t.token) {
+		token := t.token
+		t.mu.Unlock()
+		return token, nil
+	}
+	call := t.refreshing
+	if call == nil {
+		call = t.startRefresh(sourceRefresh(t.source()))
+	}
+	t.mu.Unlock()
+	return call.wait(ctx)
+}
+
+// tokenCall is a token refresh in flight, shared by the concurrent callers.
+type tokenCall struct {
+	done  chan struct{} // closed once token and err are set
+	token *oauth2.Token
+	err   error
+}
+
+func (c *tokenCall) wait(ctx context.Context) (*oauth2.Token, error) {
+	select {
+	case <-c.done:
+		return c.token, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refreshFunc gets a new token, and optionally the token source to use from now on.
+type refreshFunc func() (*oauth2.Token, oauth2.TokenSource, error)
+
+func sourceRefresh(source oauth2.TokenSource) refreshFunc {
+	return func() (*oauth2.Token, oauth2.TokenSource, error) {
+		token, err := source.Token()
+		return token, nil, err
+	}
+}
+
+// startRefresh must be called with mu held. The refresh runs in the background,
+// so that it is not canceled when the caller starting it stops waiting.
+func (t *OAuth2Core) startRefresh(refresh refreshFunc) *tokenCall {
+	call := &tokenCall{done: make(chan struct{})}
+	t.refreshing = call
+	go func() {
+		token, err := t.refresh(refresh)
+
+		t.mu.Lock()
+		if err == nil && t.loggedOut {
+			err = ErrLoggedOut
 		}
+		if err == nil {
+			t.token = token
+		}
+		t.refreshing = nil
+		t.mu.Unlock()
+
+		call.token, call.err = token, err
+		close(call.done)
+	}()
+	return call
+}
+
+// refresh gets a new token and triggers OnRefreshTokenChange without holding mu.
+func (t *OAuth2Core) refresh(refresh refreshFunc) (*oauth2.Token, error) {
+	token, source, err := refresh()
+	if err != nil {
+		return token, err
 	}
-	return nil
+
+	t.mu.Lock()
+	if t.loggedOut {
+		t.mu.Unlock()
+		return token, ErrLoggedOut
+	}
+	if source != nil {
+		t.refreshedSource = source
+	}
+	changed := t.refreshTokenChanged(token)
+	t.mu.Unlock()
+
+	if changed && t.OnRefreshTokenChange != nil {
+		return token, t.OnRefreshTokenChange(t.Ctx, token)
+	}
+	return token, nil
+}
+
+// source must be called with mu held.
+func (t *OAuth2Core) source() oauth2.TokenSource {
+	if t.refreshedSource != nil {
+		return t.refreshedSource
+	}
+	return t.Source
+}
+
+func (t *OAuth2Core) expiresSoon(token *oauth2.Token) bool {
+	if token.AccessToken == "" {
+		return true
+	}
+	if token.Expiry.IsZero() {
+		return false
+	}
+	skew := t.RefreshSkew
+	if skew == 0 {
+		skew = defaultRefreshSkew
+	}
+	return token.Expiry.Add(-skew).Before(time.Now())
+}
+
+// refreshTokenChanged must be called with mu held. It records the refresh token
+// of newToken, and reports whether OnRefreshTokenChange should be triggered.
+func (t *OAuth2Core) refreshTokenChanged(newToken *oauth2.Token) bool {
+	if (!t.refreshTokenKnown && t.CurrentRefreshToken == "") || t.CurrentRefreshToken != newToken.RefreshToken {
+		t.CurrentRefreshToken = newToken.RefreshToken
+		t.refreshTokenKnown = true
+		return true
+	}
+	return false
 }
 
 func (t *OAuth2Core) returnAuthError(oldToken *oauth2.Token, err error) error {
@@ -198,6 +410,22 @@ func WithOAuth2Http(
 
 type OAuth2HttpOption func(t *OAuth2Core)
 
+// WithRefreshSkew sets how long before expiry the token is refreshed.
+// The default is 10 seconds, the same as oauth2.
+//
+// The token is asked from the token source once it is within the skew,
+// so the token source should honor the same skew:
+//
+//	source := oauth2.ReuseTokenSourceWithExpiry(token, conf.TokenSource(ctx, token), time.Minute)
+//	client := httpx.NewXClient(WithOAuth2Http(ctx, token, source,
+//	    WithRefreshSkew(time.Minute),
+//	))
+func WithRefreshSkew(skew time.Duration) OAuth2HttpOption {
+	return func(t *OAuth2Core) {
+		t.RefreshSkew = skew
+	}
+}
+
 // WithOnRefreshTokenChange sets a callback that is triggered when the refresh token changes.
 // This is useful for persisting the new token for future use.
 // If the callback returns an error, the request will fail with ErrAuthenticationInvalid
@@ -3,11 +3,15 @@ package oauth2x
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
 )
@@ -166,3 +170,168 @@ func TestTransportReturnSpecificErrorWhenAuthHeaderInvalid(t *testing.T) {
 	require.Nil(t, res)
 	require.False(t, triggered)
 }
+
+// countingTokenSource returns a new token with a new refresh token on every call.
+type countingTokenSource struct {
+	mu     sync.Mutex
+	calls  int
+	expiry time.Duration
+}
+
+func (s *countingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	time.Sleep(10 * time.Millisecond) // widen the window for concurrent refreshes
+	return &oauth2.Token{
+		AccessToken:  fmt.Sprintf("access_token_%d", s.calls),
+		RefreshToken: fmt.Sprintf("refresh_token_%d", s.calls),
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(s.expiry),
+	}, nil
+}
+
+func (s *countingTokenSource) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestTransportConcurrentRefreshOnce(t *testing.T) {
+	ctx := context.Background()
+	server := newMockServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+
+	source := &countingTokenSource{expiry: time.Hour}
+	changed := atomic.Int32{}
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		&oauth2.Token{RefreshToken: "refresh_token_0"},
+		source,
+		WithOnRefreshTokenChange(func(ctx context.Context, newToken *oauth2.Token) error {
+			changed.Add(1)
+			return nil
+		}),
+	))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.Get(ctx, server.URL)
+			if assert.NoError(t, err) {
+				res.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, 1, source.Calls())
+	require.Equal(t, int32(1), changed.Load())
+}
+
+func TestTransportRefreshBeforeExpiry(t *testing.T) {
+	ctx := context.Background()
+	var gotAuth []string
+	server := newMockServer(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+	})
+	defer server.Close()
+
+	source := &countingTokenSource{expiry: 30 * time.Second}
+	var rotated []string
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		nil,
+		source,
+		WithRefreshSkew(time.Minute), // every token is already within the skew
+		WithOnRefreshTokenChange(func(ctx context.Context, newToken *oauth2.Token) error {
+			rotated = append(rotated, newToken.RefreshToken)
+			return nil
+		}),
+	))
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Get(ctx, server.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	require.Equal(t, 2, source.Calls())
+	require.Equal(t, []string{"Bearer access_token_1", "Bearer access_token_2"}, gotAuth)
+	require.Equal(t, []string{"refresh_token_1", "refresh_token_2"}, rotated)
+}
+
+func TestTransportNoRepeatedChangeWithoutRefreshToken(t *testing.T) {
+	ctx := context.Background()
+	server := newMockServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+
+	changed := 0
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		nil,
+		&tokenSource{token: &oauth2.Token{AccessToken: "access_token", Expiry: time.Now().Add(-time.Hour)}},
+		WithOnRefreshTokenChange(func(ctx context.Context, newToken *oauth2.Token) error {
+			changed++
+			return nil
+		}),
+	))
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(ctx, server.URL)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+	require.Equal(t, 1, changed)
+}
+
+// blockingTokenSource blocks in Token until release is closed.
+type blockingTokenSource struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingTokenSource) Token() (*oauth2.Token, error) {
+	close(s.started)
+	<-s.release
+	return &oauth2.Token{AccessToken: "access_token", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestTransportWaitRefreshUntilContextDone(t *testing.T) {
+	ctx := context.Background()
+	server := newMockServer(func(w http.ResponseWriter, r *http.Request) {})
+	defer server.Close()
+
+	source := &blockingTokenSource{started: make(chan struct{}), release: make(chan struct{})}
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		nil,
+		source,
+		WithAuthError(ErrAuthenticationInvalidInTest),
+	))
+
+	firstErr := make(chan error, 1)
+	go func() {
+		res, err := client.Get(ctx, server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		firstErr <- err
+	}()
+	<-source.started
+
+	// a waiter gives up on its own ctx, while the refresh is still in flight
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Get(waitCtx, server.URL)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(source.release)
+	require.NoError(t, <-firstErr)
+
+	res, err := client.Get(ctx, server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+}
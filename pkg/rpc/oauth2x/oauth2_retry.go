@@ -0,0 +1,119 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// ForceRefreshFunc gets a new token bypassing any cached token,
+// e.g. by using the refresh token of oldToken directly.
+//
+// It may also return the token source to use from now on, which replaces
+// OAuth2Core.Source, so that later refreshes start from the new refresh token.
+// Return a nil source to keep using the current one.
+type ForceRefreshFunc func(ctx context.Context, oldToken *oauth2.Token) (*oauth2.Token, oauth2.TokenSource, error)
+
+// ConfigForceRefresh returns a ForceRefreshFunc that refreshes with conf,
+// using the refresh token of the old token.
+//
+// Example:
+//
+//	client := httpx.NewXClient(WithOAuth2Http(ctx, token, conf.TokenSource(ctx, token),
+//	    WithRetryOnUnauthorized(ConfigForceRefresh(conf)),
+//	))
+func ConfigForceRefresh(conf *oauth2.Config) ForceRefreshFunc {
+	return func(ctx context.Context, oldToken *oauth2.Token) (*oauth2.Token, oauth2.TokenSource, error) {
+		if oldToken == nil {
+			return nil, nil, errors.New("oauth2x: no token to force refresh")
+		}
+		token, err := refreshByConfig(ctx, conf, oldToken)
+		if err != nil {
+			return nil, nil, err
+		}
+		return token, conf.TokenSource(ctx, token), nil
+	}
+}
+
+// WithRetryOnUnauthorized enables retrying once after a 401 response, which
+// happens when the access token is revoked on the server side before it expires.
+// The token is force refreshed by refresh, and the request is replayed with it.
+// Only if the replayed request fails again, OnAuthError is triggered.
+//
+// If refresh is nil, the cached token is dropped and a token is asked from the
+// token source, which only helps if the token source does not cache tokens itself.
+// If the rejected access token is got again, the request is not replayed,
+// and the 401 response is handled as is.
+//
+// Requests with a body are only replayed if the body can be recreated by
+// http.Request.GetBody, which is set by http.NewRequest for in-memory bodies.
+func WithRetryOnUnauthorized(refresh ForceRefreshFunc) OAuth2HttpOption {
+	return func(t *OAuth2Core) {
+		t.RetryOnUnauthorized = true
+		t.ForceRefresh = refresh
+	}
+}
+
+// forceRefresh gets a new token bypassing the cache.
+// If another request has already refreshed the token since oldToken
+// was used, the refreshed token is reused instead of refreshing again,
+// and a refresh in flight is shared.
+func (t *OAuth2Core) forceRefresh(ctx context.Context, oldToken *oauth2.Token) (*oauth2.Token, error) {
+	t.mu.Lock()
+	if t.loggedOut {
+		t.mu.Unlock()
+		return oldToken, ErrLoggedOut
+	}
+	if t.token != nil && t.token.AccessToken != oldToken.AccessToken && !t.expiresSoon(t.token) {
+		token := t.token
+		t.mu.Unlock()
+		return token, nil
+	}
+	call := t.refreshing
+	if call == nil {
+		if t.ForceRefresh != nil {
+			call = t.startRefresh(t.forceRefreshFunc(oldToken))
+		} else {
+			t.token = nil
+			call = t.startRefresh(sourceRefresh(t.source()))
+		}
+	}
+	t.mu.Unlock()
+
+	token, err := call.wait(ctx)
+	if err != nil && token == nil {
+		return oldToken, err
+	}
+	return token, err
+}
+
+func (t *OAuth2Core) forceRefreshFunc(oldToken *oauth2.Token) refreshFunc {
+	forceRefresh := t.ForceRefresh
+	ctx := t.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return func() (*oauth2.Token, oauth2.TokenSource, error) {
+		return forceRefresh(ctx, oldToken)
+	}
+}
+
+func canReplay(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// replayRequest clones the request with a new body from GetBody.
+func (t *OAuth2Core) replayRequest(req *http.Request) (*http.Request, error) {
+	req2 := t.cloneRequest(req)
+	if req.Body == nil || req.Body == http.NoBody {
+		return req2, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req2.Body = body
+	return req2, nil
+}
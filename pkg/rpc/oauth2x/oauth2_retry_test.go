@@ -0,0 +1,188 @@
+package oauth2x
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// newRevokedTokenServer accepts only the access token "new_access_token",
+// and echoes the request body.
+func newRevokedTokenServer(t *testing.T) *httptest.Server {
+	return newMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer new_access_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Write(body)
+	})
+}
+
+func TestTransportRetryOnUnauthorized(t *testing.T) {
+	ctx := context.Background()
+	server := newRevokedTokenServer(t)
+	defer server.Close()
+
+	oldToken := &oauth2.Token{
+		AccessToken:  "old_access_token",
+		RefreshToken: "old_refresh_token",
+		Expiry:       time.Now().Add(time.Hour),
+	}
+	refreshed := 0
+	authErrors := 0
+	var rotated []string
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		oldToken,
+		oauth2.StaticTokenSource(oldToken),
+		WithRetryOnUnauthorized(func(ctx context.Context, token *oauth2.Token) (*oauth2.Token, oauth2.TokenSource, error) {
+			refreshed++
+			require.Equal(t, "old_refresh_token", token.RefreshToken)
+			newToken := &oauth2.Token{
+				AccessToken:  "new_access_token",
+				RefreshToken: "new_refresh_token",
+				Expiry:       time.Now().Add(time.Hour),
+			}
+			return newToken, oauth2.StaticTokenSource(newToken), nil
+		}),
+		WithOnRefreshTokenChange(func(ctx context.Context, newToken *oauth2.Token) error {
+			rotated = append(rotated, newToken.RefreshToken)
+			return nil
+		}),
+		WithOnAuthError(func(ctx context.Context, oldToken *oauth2.Token, refreshErr error) {
+			authErrors++
+		}),
+	))
+
+	for i := 0; i < 2; i++ {
+		res, err := client.Post(ctx, server.URL, "text/plain", strings.NewReader("hello"))
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, "hello", string(body))
+	}
+
+	require.Equal(t, 1, refreshed)
+	require.Equal(t, 0, authErrors)
+	require.Equal(t, []string{"new_refresh_token"}, rotated)
+}
+
+func TestTransportRetryOnUnauthorizedFailsTwice(t *testing.T) {
+	ctx := context.Background()
+	server := newMockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer server.Close()
+
+	token := &oauth2.Token{AccessToken: "access_token", Expiry: time.Now().Add(time.Hour)}
+	source := &countingTokenSource{expiry: time.Hour}
+	authErrors := 0
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		token,
+		source,
+		WithRetryOnUnauthorized(nil),
+		WithOnAuthError(func(ctx context.Context, oldToken *oauth2.Token, refreshErr error) {
+			authErrors++
+		}),
+		WithAuthError(ErrAuthenticationInvalidInTest),
+	))
+
+	_, err := client.Get(ctx, server.URL)
+	require.Equal(t, ErrAuthenticationInvalidInTest, err)
+	require.Equal(t, 2, source.Calls()) // initial token, then the forced one
+	require.Equal(t, 1, authErrors)
+}
+
+func TestTransportRetryOnUnauthorizedSameToken(t *testing.T) {
+	ctx := context.Background()
+	requests := 0
+	server := newMockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	defer server.Close()
+
+	token := &oauth2.Token{AccessToken: "access_token", Expiry: time.Now().Add(time.Hour)}
+	authErrors := 0
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		token,
+		oauth2.StaticTokenSource(token), // gives the rejected token again
+		WithRetryOnUnauthorized(nil),
+		WithOnAuthError(func(ctx context.Context, oldToken *oauth2.Token, refreshErr error) {
+			authErrors++
+		}),
+		WithAuthError(ErrAuthenticationInvalidInTest),
+	))
+
+	_, err := client.Get(ctx, server.URL)
+	require.Equal(t, ErrAuthenticationInvalidInTest, err)
+	require.Equal(t, 1, requests) // not replayed
+	require.Equal(t, 1, authErrors)
+}
+
+func TestTransportRetryOnUnauthorizedNotReplayable(t *testing.T) {
+	ctx := context.Background()
+	server := newRevokedTokenServer(t)
+	defer server.Close()
+
+	token := &oauth2.Token{AccessToken: "old_access_token", Expiry: time.Now().Add(time.Hour)}
+	refreshed := 0
+	client := httpx.NewXClient(WithOAuth2Http(
+		ctx,
+		token,
+		oauth2.StaticTokenSource(token),
+		WithRetryOnUnauthorized(func(ctx context.Context, token *oauth2.Token) (*oauth2.Token, oauth2.TokenSource, error) {
+			refreshed++
+			return &oauth2.Token{AccessToken: "new_access_token"}, nil, nil
+		}),
+		WithAuthError(ErrAuthenticationInvalidInTest),
+	))
+
+	// a body without GetBody cannot be replayed
+	body := io.NopCloser(strings.NewReader("hello"))
+	_, err := client.Post(ctx, server.URL, "text/plain", body)
+	require.Equal(t, ErrAuthenticationInvalidInTest, err)
+	require.Equal(t, 0, refreshed)
+}
+
+func TestConfigForceRefresh(t *testing.T) {
+	ctx := context.Background()
+	tokenServer := newMockServer(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "refresh_token", r.Form.Get("grant_type"))
+		require.Equal(t, "old_refresh_token", r.Form.Get("refresh_token"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"new_access_token","refresh_token":"new_refresh_token","token_type":"Bearer","expires_in":3600}`))
+	})
+	defer tokenServer.Close()
+
+	conf := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL},
+	}
+	token, source, err := ConfigForceRefresh(conf)(ctx, &oauth2.Token{
+		AccessToken:  "old_access_token",
+		RefreshToken: "old_refresh_token",
+		Expiry:       time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "new_access_token", token.AccessToken)
+	require.Equal(t, "new_refresh_token", token.RefreshToken)
+
+	sourceToken, err := source.Token()
+	require.NoError(t, err)
+	require.Equal(t, "new_access_token", sourceToken.AccessToken)
+}
@@ -0,0 +1,111 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"golang.org/x/oauth2"
+)
+
+// Token type hints of the revocation and introspection requests.
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// ErrLoggedOut is returned by OAuth2Core after Logout.
+var ErrLoggedOut = errors.New("oauth2x: logged out")
+
+// RevocationClient revokes tokens by the token revocation endpoint (RFC 7009).
+//
+// Example:
+//
+//	revoker := &RevocationClient{
+//	    Endpoint: "https://auth.example.com/revoke",
+//	    ClientID: "cli",
+//	}
+//	err := revoker.Revoke(ctx, token.RefreshToken, TokenTypeHintRefreshToken)
+type RevocationClient struct {
+	Endpoint string
+	// ClientID and ClientSecret authenticate the client to the endpoint.
+	// The token can only be revoked by the client it was issued to.
+	ClientID     string
+	ClientSecret string
+	// AuthStyle is how ClientSecret is sent. AuthStyleAutoDetect tries the header first,
+	// then the params if the client is rejected with 400 or 401, as oauth2 does.
+	AuthStyle oauth2.AuthStyle
+
+	// Client sends the requests. If nil, httpx.NewXClient() is used.
+	Client *httpx.XClient
+}
+
+// Revoke revokes the token. tokenTypeHint may be empty, or one of
+// TokenTypeHintAccessToken and TokenTypeHintRefreshToken.
+// Revoking an invalid or already revoked token is not an error.
+func (c *RevocationClient) Revoke(ctx context.Context, token string, tokenTypeHint string) error {
+	v := url.Values{"token": {token}}
+	if tokenTypeHint != "" {
+		v.Set("token_type_hint", tokenTypeHint)
+	}
+	_, err := postEndpointWithSecret(ctx, c.Client, c.Endpoint, v,
+		c.ClientID, c.ClientSecret, c.AuthStyle)
+	return err
+}
+
+// WithRevocation sets the revocation client used by OAuth2Core.Logout.
+func WithRevocation(revoker *RevocationClient) OAuth2HttpOption {
+	return func(t *OAuth2Core) {
+		t.Revoker = revoker
+	}
+}
+
+// Logout revokes the refresh token and the cached access token by Revoker if set,
+// and clears them and CurrentRefreshToken. Requests after Logout fail with ErrLoggedOut
+// (or ErrAuthenticationInvalid if configured) without asking Source.
+//
+// The tokens are cleared even if the revocation fails, and the error is returned.
+// Tokens persisted by OnRefreshTokenChange, e.g. in a TokenStore, should be cleared by the caller.
+//
+// Example:
+//
+//	var core *OAuth2Core
+//	client := httpx.NewXClient(WithOAuth2Http(ctx, token, source,
+//	    WithRevocation(&RevocationClient{Endpoint: revokeURL, ClientID: conf.ClientID}),
+//	    func(t *OAuth2Core) { core = t },
+//	))
+//	// ...
+//	err := core.Logout(ctx)
+func (t *OAuth2Core) Logout(ctx context.Context) error {
+	t.mu.Lock()
+
+	refreshToken := t.CurrentRefreshToken
+	accessToken := ""
+	if t.token != nil {
+		accessToken = t.token.AccessToken
+		if t.token.RefreshToken != "" {
+			refreshToken = t.token.RefreshToken
+		}
+	}
+
+	t.token = nil
+	t.CurrentRefreshToken = ""
+	t.refreshTokenKnown = true
+	t.refreshedSource = nil
+	t.loggedOut = true
+	t.mu.Unlock()
+
+	if t.Revoker == nil {
+		return nil
+	}
+	var errs []error
+	// revoke the refresh token first, which usually revokes its access tokens as well
+	if refreshToken != "" {
+		errs = append(errs, t.Revoker.Revoke(ctx, refreshToken, TokenTypeHintRefreshToken))
+	}
+	if accessToken != "" {
+		errs = append(errs, t.Revoker.Revoke(ctx, accessToken, TokenTypeHintAccessToken))
+	}
+	return errors.Join(errs...)
+}
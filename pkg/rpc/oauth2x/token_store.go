@@ -0,0 +1,180 @@
+package oauth2x
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/cachex"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"golang.org/x/oauth2"
+)
+
+// ErrNoStoredToken is returned when the TokenStore has no token to refresh from.
+var ErrNoStoredToken = errors.New("oauth2x: no token in store")
+
+// TokenStore persists an OAuth2 token in a cachex.RWCacher, which may be shared
+// by multiple processes. Token rotations are done under the cachex lock, and
+// a process always refreshes from the latest stored refresh token, so
+// processes sharing a store never use a stale refresh token.
+//
+// Example:
+//
+//	store := NewTokenStore(cachex.NewRWCacher(
+//	    cachex.NewJSONCacher[oauth2.Token](redisCacher), redisLocker, 0))
+//	decorator, err := WithOAuth2Store(ctx, store, conf)
+//	if err != nil {
+//	    return err
+//	}
+//	client := httpx.NewXClient(decorator)
+type TokenStore struct {
+	cache *cachex.RWCacher[oauth2.Token]
+}
+
+func NewTokenStore(cache *cachex.RWCacher[oauth2.Token]) *TokenStore {
+	return &TokenStore{
+		cache: cache,
+	}
+}
+
+// Load returns the stored token, or nil if no token is stored.
+func (s *TokenStore) Load(ctx context.Context) (*oauth2.Token, error) {
+	token, err := s.cache.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isEmptyToken(token) {
+		return nil, nil
+	}
+	return token, nil
+}
+
+// Save stores the token under the lock, e.g. the first token got from login.
+func (s *TokenStore) Save(ctx context.Context, token *oauth2.Token) error {
+	return s.cache.Modify(ctx, func(*oauth2.Token) (*oauth2.Token, error) {
+		return token, nil
+	})
+}
+
+// Rotate refreshes the stored token atomically under the lock.
+// refresh is called with the latest stored token, unless isFresh reports the
+// stored token is fresh enough, e.g. because another process has just rotated it.
+// It returns the stored token after rotation.
+func (s *TokenStore) Rotate(
+	ctx context.Context,
+	isFresh func(stored *oauth2.Token) bool,
+	refresh func(stored *oauth2.Token) (*oauth2.Token, error),
+) (*oauth2.Token, error) {
+	var result *oauth2.Token
+	err := s.cache.Modify(ctx, func(stored *oauth2.Token) (*oauth2.Token, error) {
+		if isEmptyToken(stored) {
+			return nil, ErrNoStoredToken
+		}
+		if isFresh(stored) {
+			result = stored
+			return stored, nil
+		}
+		token, err := refresh(stored)
+		if err != nil {
+			return nil, err
+		}
+		result = token
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// OnRefreshTokenChange saves the new token, and can be used as the hook of
+// WithOnRefreshTokenChange when the token source is not from the store.
+func (s *TokenStore) OnRefreshTokenChange(ctx context.Context, newToken *oauth2.Token) error {
+	return s.Save(ctx, newToken)
+}
+
+// TokenSource returns a token source that reads through the store.
+// The stored token is returned while it is valid, otherwise it is refreshed by conf
+// under the lock and the rotated token is stored.
+func (s *TokenStore) TokenSource(ctx context.Context, conf *oauth2.Config) oauth2.TokenSource {
+	return &storeTokenSource{
+		ctx:   ctx,
+		store: s,
+		conf:  conf,
+		skew:  defaultRefreshSkew,
+	}
+}
+
+// ForceRefresh returns a ForceRefreshFunc for WithRetryOnUnauthorized,
+// which refreshes the stored token by conf under the lock. If another process
+// has already rotated the token since oldToken, the stored token is used instead.
+func (s *TokenStore) ForceRefresh(conf *oauth2.Config) ForceRefreshFunc {
+	return func(ctx context.Context, oldToken *oauth2.Token) (*oauth2.Token, oauth2.TokenSource, error) {
+		token, err := s.Rotate(ctx, func(stored *oauth2.Token) bool {
+			return oldToken != nil && stored.AccessToken != oldToken.AccessToken && stored.Valid()
+		}, func(stored *oauth2.Token) (*oauth2.Token, error) {
+			return refreshByConfig(ctx, conf, stored)
+		})
+		return token, nil, err
+	}
+}
+
+// WithOAuth2Store is like WithOAuth2Http, but loads the initial token from the
+// store and gets tokens through store.TokenSource.
+// It returns ErrNoStoredToken if the store is empty.
+func WithOAuth2Store(
+	ctx context.Context,
+	store *TokenStore,
+	conf *oauth2.Config,
+	opts ...OAuth2HttpOption,
+) (httpx.ClientDecorator, error) {
+	token, err := store.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrNoStoredToken
+	}
+	return WithOAuth2Http(ctx, token, store.TokenSource(ctx, conf), opts...), nil
+}
+
+type storeTokenSource struct {
+	ctx   context.Context
+	store *TokenStore
+	conf  *oauth2.Config
+	skew  time.Duration
+}
+
+func (s *storeTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.store.Load(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	if token != nil && s.isFresh(token) {
+		return token, nil
+	}
+
+	return s.store.Rotate(s.ctx, s.isFresh, func(stored *oauth2.Token) (*oauth2.Token, error) {
+		return refreshByConfig(s.ctx, s.conf, stored)
+	})
+}
+
+func (s *storeTokenSource) isFresh(token *oauth2.Token) bool {
+	if token.AccessToken == "" {
+		return false
+	}
+	return token.Expiry.IsZero() || time.Now().Add(s.skew).Before(token.Expiry)
+}
+
+// refreshByConfig refreshes by the refresh token of token, bypassing its access token.
+func refreshByConfig(ctx context.Context, conf *oauth2.Config, token *oauth2.Token) (*oauth2.Token, error) {
+	if token.RefreshToken == "" {
+		return nil, errors.New("oauth2x: no refresh token to refresh")
+	}
+	// without access token, the token source always refreshes
+	return conf.TokenSource(ctx, &oauth2.Token{RefreshToken: token.RefreshToken}).Token()
+}
+
+func isEmptyToken(token *oauth2.Token) bool {
+	return token == nil || (token.AccessToken == "" && token.RefreshToken == "")
+}
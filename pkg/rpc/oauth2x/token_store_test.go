@@ -0,0 +1,147 @@
+package oauth2x
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/cachex"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/httpx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// rotatingTokenServer rotates the refresh token on every refresh,
+// and rejects refresh tokens that were already used.
+type rotatingTokenServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	refreshes int
+	current   string
+}
+
+func newRotatingTokenServer(t *testing.T, current string) *rotatingTokenServer {
+	s := &rotatingTokenServer{current: current}
+	s.Server = newMockServer(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		require.NoError(t, r.ParseForm())
+		if r.Form.Get("refresh_token") != s.current {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		s.refreshes++
+		s.current = fmt.Sprintf("refresh_token_%d", s.refreshes)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access_token_%d","refresh_token":%q,"token_type":"Bearer","expires_in":3600}`, s.refreshes, s.current)
+	})
+	return s
+}
+
+func (s *rotatingTokenServer) Refreshes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshes
+}
+
+func newMemoryTokenStore() *TokenStore {
+	return NewTokenStore(cachex.NewRWCacher(
+		cachex.NewJSONCacher[oauth2.Token](cachex.NewMemoryCacher()),
+		cachex.NewSyncLockObtainer(),
+		0,
+	))
+}
+
+func TestTokenStoreLoadSave(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryTokenStore()
+
+	token, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Nil(t, token)
+
+	_, err = WithOAuth2Store(ctx, store, &oauth2.Config{})
+	require.ErrorIs(t, err, ErrNoStoredToken)
+
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	require.NoError(t, store.Save(ctx, &oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: expiry}))
+	token, err = store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "a", token.AccessToken)
+	require.Equal(t, "r", token.RefreshToken)
+	require.True(t, expiry.Equal(token.Expiry))
+}
+
+func TestTokenStoreSharedRefresh(t *testing.T) {
+	ctx := context.Background()
+	tokenServer := newRotatingTokenServer(t, "refresh_token_0")
+	defer tokenServer.Close()
+	conf := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+
+	store := newMemoryTokenStore()
+	require.NoError(t, store.Save(ctx, &oauth2.Token{
+		AccessToken:  "access_token_0",
+		RefreshToken: "refresh_token_0",
+		Expiry:       time.Now().Add(-time.Minute),
+	}))
+
+	// each source acts as a different process sharing the store
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := store.TokenSource(ctx, conf).Token()
+			if assert.NoError(t, err) {
+				assert.Equal(t, "access_token_1", token.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 1, tokenServer.Refreshes())
+
+	stored, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "refresh_token_1", stored.RefreshToken)
+}
+
+func TestWithOAuth2StoreForceRefresh(t *testing.T) {
+	ctx := context.Background()
+	tokenServer := newRotatingTokenServer(t, "refresh_token_0")
+	defer tokenServer.Close()
+	conf := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+
+	server := newMockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access_token_1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	defer server.Close()
+
+	store := newMemoryTokenStore()
+	require.NoError(t, store.Save(ctx, &oauth2.Token{
+		AccessToken:  "access_token_0", // revoked on the server side
+		RefreshToken: "refresh_token_0",
+		Expiry:       time.Now().Add(time.Hour),
+	}))
+
+	decorator, err := WithOAuth2Store(ctx, store, conf, WithRetryOnUnauthorized(store.ForceRefresh(conf)))
+	require.NoError(t, err)
+	client := httpx.NewXClient(decorator)
+
+	res, err := client.Get(ctx, server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	stored, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "access_token_1", stored.AccessToken)
+	require.Equal(t, 1, tokenServer.Refreshes())
+}
@@ -0,0 +1,298 @@
+package sshx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// PassphraseFunc returns the passphrase of an encrypted private key.
+// file is the path of the key, or empty if the key is given as bytes.
+type PassphraseFunc func(file string) ([]byte, error)
+
+// signerSource provides the signers offered by the publickey method.
+// It is called on every authentication, so that keys may be loaded lazily.
+type signerSource func() ([]ssh.Signer, error)
+
+// WithPassphrase sets the callback to decrypt encrypted private keys, e.g. by
+// prompting the user. It is called once per key on the first authentication,
+// so it may be given before or after the keys.
+//
+// Example:
+//
+//	opts := []SSHClientOption{
+//	    WithPrivateKeyFile("~/.ssh/id_ed25519"),
+//	    WithPassphrase(func(file string) ([]byte, error) {
+//	        fmt.Printf("Enter passphrase for %s: ", file)
+//	        return term.ReadPassword(int(os.Stdin.Fd()))
+//	    }),
+//	}
+func WithPassphrase(passphrase PassphraseFunc) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.passphrase = passphrase
+		return nil
+	}
+}
+
+// WithPrivateKeyFile configures SSH authentication using a private key file in PEM format,
+// and its OpenSSH user certificate file "<file>-cert.pub" if it exists.
+// A leading "~/" of file is expanded to the user's home directory.
+// An encrypted key is decrypted on first use by the passphrase from WithPassphrase.
+//
+// Example:
+//
+//	opts := WithPrivateKeyFile("~/.ssh/id_ed25519")
+func WithPrivateKeyFile(file string) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		file, err := expandHome(file)
+		if err != nil {
+			return err
+		}
+		privateKeyBytes, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		certificateBytes, err := os.ReadFile(file + "-cert.pub")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return c.addPrivateKey(file, privateKeyBytes, certificateBytes)
+	}
+}
+
+// WithUserCertificate configures SSH authentication using a private key and its
+// OpenSSH user certificate signed by a CA the server trusts, in the format of
+// the "-cert.pub" file written by `ssh-keygen -s`.
+//
+// Example:
+//
+//	keyBytes, _ := os.ReadFile("id_ed25519")
+//	certBytes, _ := os.ReadFile("id_ed25519-cert.pub")
+//	opts := WithUserCertificate(keyBytes, certBytes)
+func WithUserCertificate(privateKeyBytes, certificateBytes []byte) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		if len(certificateBytes) == 0 {
+			return errors.New("sshx: empty user certificate")
+		}
+		return c.addPrivateKey("", privateKeyBytes, certificateBytes)
+	}
+}
+
+// WithSigners configures SSH authentication using the signers,
+// e.g. keys from a hardware token or certificates from ssh.NewCertSigner.
+func WithSigners(signers ...ssh.Signer) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.addPublicKeys(func() ([]ssh.Signer, error) {
+			return signers, nil
+		})
+		return nil
+	}
+}
+
+// WithAgent configures SSH authentication using the keys of the ssh-agent
+// listening on SSH_AUTH_SOCK. The agent is connected on every authentication,
+// so a restarted agent is picked up on reconnection.
+//
+// Example:
+//
+//	runner, err := NewSshRunner("user", "example.com", WithAgent())
+func WithAgent() SSHClientOption {
+	return func(c *sshClientConfig) error {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return errors.New("sshx: SSH_AUTH_SOCK is not set, is ssh-agent running?")
+		}
+		source := &agentSource{socket: socket}
+		c.addPublicKeys(source.signers)
+		return nil
+	}
+}
+
+// WithAgentClient configures SSH authentication using the keys of an agent,
+// e.g. one from agent.NewClient, or an in-memory agent.NewKeyring.
+func WithAgentClient(client agent.Agent) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.addPublicKeys(client.Signers)
+		return nil
+	}
+}
+
+// WithPassword configures SSH authentication using a password.
+func WithPassword(password string) SSHClientOption {
+	return WithAuthMethods(ssh.Password(password))
+}
+
+// WithKeyboardInteractive configures SSH keyboard-interactive authentication,
+// used by servers with one-time passwords or other challenges.
+//
+// Example:
+//
+//	opts := WithKeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+//	    answers := make([]string, len(questions))
+//	    for i, question := range questions {
+//	        answers[i] = prompt(question, echos[i])
+//	    }
+//	    return answers, nil
+//	})
+func WithKeyboardInteractive(challenge ssh.KeyboardInteractiveChallenge) SSHClientOption {
+	return WithAuthMethods(ssh.KeyboardInteractive(challenge))
+}
+
+// WithAuthMethods adds SSH authentication methods.
+//
+// Authentication methods of all the options are tried in the order they are given,
+// each method kind once, as the server allows. All the public keys, from
+// WithPrivateKeyBytes, WithPrivateKeyFile, WithAgent and so on, are offered
+// by one publickey method in order, at the position of the first of them.
+//
+// Example:
+//
+//	// try the agent, then the key file, then the password
+//	runner, err := NewSshRunner("user", "example.com",
+//	    WithAgent(),
+//	    WithPrivateKeyFile("~/.ssh/deploy_key"),
+//	    WithPassword(password),
+//	)
+func WithAuthMethods(methods ...ssh.AuthMethod) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.auth = append(c.auth, methods...)
+		return nil
+	}
+}
+
+// addPublicKeys adds the source to the publickey method, adding the method
+// to auth on the first source.
+func (c *sshClientConfig) addPublicKeys(source signerSource) {
+	if len(c.publicKeys) == 0 {
+		c.auth = append(c.auth, ssh.PublicKeysCallback(c.signers))
+	}
+	c.publicKeys = append(c.publicKeys, source)
+}
+
+// signers collects the signers of all the sources. A failed source is skipped,
+// so that the other keys and methods are still tried.
+func (c *sshClientConfig) signers() ([]ssh.Signer, error) {
+	var signers []ssh.Signer
+	for _, source := range c.publicKeys {
+		s, err := source()
+		if err != nil {
+			log.Warnf(context.Background(), "ssh public key skipped: %v", err)
+			continue
+		}
+		signers = append(signers, s...)
+	}
+	return signers, nil
+}
+
+// addPrivateKey adds the private key, with its user certificate if certificateBytes is not empty.
+// An encrypted key is decrypted on first use.
+func (c *sshClientConfig) addPrivateKey(file string, privateKeyBytes, certificateBytes []byte) error {
+	signer, err := ssh.ParsePrivateKey(privateKeyBytes)
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case errors.As(err, &missing):
+		key := &encryptedKey{cfg: c, file: file, privateKeyBytes: privateKeyBytes, certificateBytes: certificateBytes}
+		c.addPublicKeys(key.signers)
+		return nil
+	case err != nil:
+		return err
+	}
+	signer, err = withCertificate(signer, certificateBytes)
+	if err != nil {
+		return err
+	}
+	c.addPublicKeys(func() ([]ssh.Signer, error) {
+		return []ssh.Signer{signer}, nil
+	})
+	return nil
+}
+
+// withCertificate returns a signer presenting the user certificate if certificateBytes is not empty.
+func withCertificate(signer ssh.Signer, certificateBytes []byte) (ssh.Signer, error) {
+	if len(certificateBytes) == 0 {
+		return signer, nil
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(certificateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("sshx: parse user certificate: %w", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("sshx: %s key is not a certificate", pub.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, errors.New("sshx: not a user certificate")
+	}
+	return ssh.NewCertSigner(cert, signer)
+}
+
+// encryptedKey decrypts the private key on first use, and keeps the signer afterwards.
+type encryptedKey struct {
+	cfg              *sshClientConfig
+	file             string
+	privateKeyBytes  []byte
+	certificateBytes []byte
+
+	mu     sync.Mutex
+	signer ssh.Signer
+}
+
+func (k *encryptedKey) signers() ([]ssh.Signer, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.signer != nil {
+		return []ssh.Signer{k.signer}, nil
+	}
+	if k.cfg.passphrase == nil {
+		return nil, fmt.Errorf("sshx: private key %s is encrypted, use WithPassphrase to decrypt it", k.file)
+	}
+	passphrase, err := k.cfg.passphrase(k.file)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(k.privateKeyBytes, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("sshx: decrypt private key %s: %w", k.file, err)
+	}
+	signer, err = withCertificate(signer, k.certificateBytes)
+	if err != nil {
+		return nil, err
+	}
+	k.signer = signer
+	return []ssh.Signer{signer}, nil
+}
+
+// agentSource connects to the agent on every authentication.
+// The connection is kept until the next one, as the signers sign through it.
+type agentSource struct {
+	socket string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (a *agentSource) signers() ([]ssh.Signer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn != nil {
+		a.conn.Close()
+		a.conn = nil
+	}
+	conn, err := net.Dial("unix", a.socket)
+	if err != nil {
+		return nil, fmt.Errorf("sshx: connect ssh-agent: %w", err)
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sshx: list ssh-agent keys: %w", err)
+	}
+	a.conn = conn
+	return signers, nil
+}
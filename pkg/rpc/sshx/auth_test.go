@@ -0,0 +1,194 @@
+package sshx_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func runEcho(t *testing.T, user, host string, opts ...sshx.SSHClientOption) error {
+	runner, err := sshx.NewSshRunner(user, host, append(opts, sshx.WithInsecureIgnoreHostKey())...)
+	if err != nil {
+		return err
+	}
+	defer runner.Close()
+	output, err := runner.Run(context.Background(), "ok")
+	require.NoError(t, err)
+	require.Equal(t, "ok", output)
+	return nil
+}
+
+func TestPasswordAndKeyboardInteractive(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithAuthorizedKeys(), sshxtest.WithServerConfig(func(config *ssh.ServerConfig) {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		}
+		config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Code: "}, []bool{true})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) == 1 && answers[0] == "123456" {
+				return nil, nil
+			}
+			return nil, errors.New("wrong code")
+		}
+	}))
+	port := sshx.WithPort(server.Port())
+
+	require.NoError(t, runEcho(t, "user", "127.0.0.1", port, sshx.WithPassword("secret")))
+	require.Error(t, runEcho(t, "user", "127.0.0.1", port, sshx.WithPassword("wrong")))
+
+	// the rejected key and the wrong password are tried before keyboard-interactive
+	var questions []string
+	require.NoError(t, runEcho(t, "user", "127.0.0.1", port,
+		sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM),
+		sshx.WithPassword("wrong"),
+		sshx.WithKeyboardInteractive(func(name, instruction string, q []string, echos []bool) ([]string, error) {
+			questions = append(questions, q...)
+			return []string{"123456"}, nil
+		}),
+	))
+	require.Equal(t, []string{"Code: "}, questions)
+}
+
+func TestPublicKeysInOrder(t *testing.T) {
+	otherPEM, other := sshxtest.NewKeyPEM(t, "")
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithAuthorizedKeys(other.PublicKey()))
+
+	// the keys are offered by one publickey method, so the second key is tried as well
+	require.NoError(t, runEcho(t, "user", "127.0.0.1", sshx.WithPort(server.Port()),
+		sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM), sshx.WithPrivateKeyBytes(otherPEM)))
+}
+
+func TestEncryptedPrivateKey(t *testing.T) {
+	keyPEM, signer := sshxtest.NewKeyPEM(t, "passphrase")
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(file, keyPEM, 0o600))
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithAuthorizedKeys(signer.PublicKey()))
+	port := sshx.WithPort(server.Port())
+
+	require.Error(t, runEcho(t, "user", "127.0.0.1", port, sshx.WithPrivateKeyFile(file)))
+
+	var asked []string
+	passphrase := sshx.WithPassphrase(func(f string) ([]byte, error) {
+		asked = append(asked, f)
+		return []byte("passphrase"), nil
+	})
+	conn, err := sshx.DialConn("user", "127.0.0.1", port, sshx.WithInsecureIgnoreHostKey(), sshx.WithPrivateKeyFile(file), passphrase, fastReconnect())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the passphrase is asked once, not on reconnection
+	server.CloseConnections()
+	_, err = sshx.NewSshRunnerWithConn(conn).Run(context.Background(), "ok")
+	require.NoError(t, err)
+	require.Equal(t, []string{file}, asked)
+}
+
+func TestUserCertificate(t *testing.T) {
+	ca := sshxtest.NewSigner(t)
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithCertAuthority(ca.PublicKey()), sshxtest.WithAuthorizedKeys())
+	port := sshx.WithPort(server.Port())
+
+	cert := sshxtest.SignUserCert(t, ca, sshxtest.ClientKey.PublicKey(), "user")
+	certBytes := ssh.MarshalAuthorizedKey(cert)
+
+	require.Error(t, runEcho(t, "user", "127.0.0.1", port, sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM)))
+	require.NoError(t, runEcho(t, "user", "127.0.0.1", port, sshx.WithUserCertificate(sshxtest.ClientKeyPEM, certBytes)))
+	require.Error(t, runEcho(t, "other", "127.0.0.1", port, sshx.WithUserCertificate(sshxtest.ClientKeyPEM, certBytes)))
+
+	// the certificate next to the key file is used
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(file, sshxtest.ClientKeyPEM, 0o600))
+	require.NoError(t, os.WriteFile(file+"-cert.pub", certBytes, 0o600))
+	require.NoError(t, runEcho(t, "user", "127.0.0.1", port, sshx.WithPrivateKeyFile(file)))
+}
+
+func TestAgent(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: key}))
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithAuthorizedKeys(signer.PublicKey()))
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+	require.Error(t, runEcho(t, "user", "127.0.0.1", sshx.WithPort(server.Port()), sshx.WithAgent()))
+
+	t.Setenv("SSH_AUTH_SOCK", socket)
+	require.NoError(t, runEcho(t, "user", "127.0.0.1", sshx.WithPort(server.Port()), sshx.WithAgent()))
+	require.NoError(t, runEcho(t, "user", "127.0.0.1", sshx.WithPort(server.Port()), sshx.WithAgentClient(keyring)))
+}
+
+func TestSSHConfig(t *testing.T) {
+	var users []string
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithServerConfig(func(config *ssh.ServerConfig) {
+		accept := config.PublicKeyCallback
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			users = append(users, conn.User())
+			return accept(conn, key)
+		}
+	}))
+
+	dir := t.TempDir()
+	identity := filepath.Join(dir, "deploy_key")
+	require.NoError(t, os.WriteFile(identity, sshxtest.ClientKeyPEM, 0o600))
+	config := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(config, []byte(fmt.Sprintf(`
+Host web
+  HostName 127.0.0.1
+  User deploy
+  IdentityFile %s/missing_key
+  IdentityFile %s
+
+Host *
+  Port %d
+  User nobody
+`, dir, identity, server.Port())), 0o600))
+
+	require.NoError(t, runEcho(t, "", "web", sshx.WithSSHConfig(config)))
+	require.Equal(t, []string{"deploy"}, users)
+
+	// the user given and WithPort win over the config
+	users = nil
+	require.NoError(t, runEcho(t, "admin", "web", sshx.WithSSHConfig(config)))
+	require.Equal(t, []string{"admin"}, users)
+
+	other := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	require.NoError(t, runEcho(t, "", "127.0.0.1", sshx.WithSSHConfig(config), sshx.WithPort(other.Port()), sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM)))
+}
@@ -0,0 +1,248 @@
+package sshx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrSudoNotCached is returned when a command is run by Sudo with a password, but sudo
+// does not cache the credentials validated by `sudo -v`, e.g. with timestamp_timeout=0,
+// so the command cannot be run by `sudo -n`. The error also wraps the *ExitError.
+var ErrSudoNotCached = errors.New("sshx: sudo credentials not cached")
+
+// sudoNotCachedStatus and sudoNotCachedMessage are the exit status and the last line of
+// stderr of the command line when the credentials are not cached, see commandLine.
+const (
+	sudoNotCachedStatus  = 125
+	sudoNotCachedMessage = "sshx: sudo credentials not cached"
+)
+
+// Command is a remote command built from a program and its arguments, each quoted
+// for POSIX shells, so that values from users cannot inject shell syntax.
+//
+// Example:
+//
+//	cmd := NewCommand("tar", "-xzf", archive, "-C", dest).
+//	    Dir("/srv/app").
+//	    Env("LANG", "C").
+//	    Sudo(password)
+//	output, err := runner.RunCommand(ctx, cmd)
+type Command struct {
+	args  []string
+	env   []envVar
+	dir   string
+	stdin io.Reader
+
+	sudo         bool
+	sudoUser     string
+	sudoPassword string
+}
+
+type envVar struct {
+	key, value string
+}
+
+// NewCommand creates a command running the program with the arguments.
+func NewCommand(program string, args ...string) *Command {
+	return &Command{args: append([]string{program}, args...)}
+}
+
+// Arg appends the arguments.
+func (c *Command) Arg(args ...string) *Command {
+	c.args = append(c.args, args...)
+	return c
+}
+
+// Env sets an environment variable of the command. It is sent by the SSH "env"
+// request, or set by the `env` program if the server does not accept it,
+// as OpenSSH does unless the variable is in AcceptEnv.
+func (c *Command) Env(key, value string) *Command {
+	c.env = append(c.env, envVar{key: key, value: value})
+	return c
+}
+
+// Dir sets the working directory of the command.
+func (c *Command) Dir(dir string) *Command {
+	c.dir = dir
+	return c
+}
+
+// Stdin sets the standard input of the command.
+func (c *Command) Stdin(r io.Reader) *Command {
+	c.stdin = r
+	return c
+}
+
+// Sudo runs the command as root by sudo. The password is written over stdin, never in
+// the command line, and read by the shell before the command: it is validated by
+// `sudo -v` first, then the command is run by `sudo -n` with the credentials cached,
+// so the password never reaches the stdin of the command, even if sudo does not ask
+// for it (NOPASSWD). If password is empty, sudo must not require one, otherwise the
+// command fails instead of waiting for a password.
+//
+// A password requires sudo to cache the credentials, which it does by default.
+// If it does not, e.g. with timestamp_timeout=0 in sudoers, the command is not run
+// and RunCommand returns ErrSudoNotCached.
+func (c *Command) Sudo(password string) *Command {
+	return c.SudoAs("", password)
+}
+
+// SudoAs runs the command as the user by sudo, see Sudo. An empty user is root.
+func (c *Command) SudoAs(user, password string) *Command {
+	c.sudo = true
+	c.sudoUser = user
+	c.sudoPassword = password
+	return c
+}
+
+// String returns the shell command line, with the environment variables set by `env`.
+// It does not contain the sudo password.
+func (c *Command) String() string {
+	return c.commandLine(true)
+}
+
+// commandLine returns the shell command line, setting the environment variables
+// by `env` if withEnv. Under sudo the variables are always set by `env`,
+// as sudo resets the environment.
+func (c *Command) commandLine(withEnv bool) string {
+	var words []string
+	var sudoUser []string
+	if c.sudo && c.sudoUser != "" {
+		sudoUser = []string{"-u", ShellQuote(c.sudoUser)}
+	}
+	if c.sudo && c.sudoPassword != "" {
+		// the shell reads the password line, so that it is consumed even if sudo -v
+		// does not read it, and printf is a builtin keeping it out of the process list
+		words = append(words, "IFS=", "read", "-r", "sudo_password", "&&",
+			"printf", `'%s\n'`, `"$sudo_password"`, "|", "sudo", "-S", "-p", "''")
+		words = append(words, sudoUser...)
+		words = append(words, "-v", "&&")
+		// check that the credentials are cached, so that sudo -n below does not fail
+		// as if the command failed
+		check := append(append([]string{"sudo", "-n"}, sudoUser...), "-v")
+		words = append(words, "{", strings.Join(check, " "), "2>/dev/null", "||",
+			"{", "echo", ShellQuote(sudoNotCachedMessage), ">&2;", "exit", strconv.Itoa(sudoNotCachedStatus)+";", "};", "}", "&&")
+	}
+	if c.dir != "" {
+		words = append(words, "cd", "--", ShellQuote(c.dir), "&&")
+	}
+	if c.sudo {
+		words = append(words, "sudo", "-n")
+		words = append(words, sudoUser...)
+		words = append(words, "--")
+		withEnv = true
+	}
+	if withEnv && len(c.env) > 0 {
+		words = append(words, "env")
+		for _, v := range c.env {
+			words = append(words, ShellQuote(v.key+"="+v.value))
+		}
+	}
+	for _, arg := range c.args {
+		words = append(words, ShellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// start sets the environment variables and the stdin of the session,
+// and returns the command line to run.
+func (c *Command) start(session *ssh.Session) string {
+	stdin := c.stdin
+	if c.sudo && c.sudoPassword != "" {
+		if stdin == nil {
+			stdin = strings.NewReader("")
+		}
+		stdin = io.MultiReader(strings.NewReader(c.sudoPassword+"\n"), stdin)
+	}
+	if stdin != nil {
+		session.Stdin = stdin
+	}
+
+	if c.sudo || len(c.env) == 0 {
+		return c.commandLine(false)
+	}
+	for _, v := range c.env {
+		if err := session.Setenv(v.key, v.value); err != nil {
+			// sent variables are kept, and overridden by env
+			return c.commandLine(true)
+		}
+	}
+	return c.commandLine(false)
+}
+
+// RunCommand executes a built command over SSH and returns its output as a string,
+// like Run. stderr is logged as a warning.
+func (s *SshRunner) RunCommand(ctx context.Context, cmd *Command) (string, error) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	err := s.RunCommandLog(ctx, cmd, &stdout, &stderr)
+	if stderr.Len() > 0 {
+		log.Warnf(ctx, "run with stderr: %s", stderr.String())
+	}
+	return stdout.String(), err
+}
+
+// RunCommandLog executes a built command over SSH and writes its output to the provided writers,
+// like RunLog.
+func (s *SshRunner) RunCommandLog(ctx context.Context, cmd *Command, stdOut, stdErr io.Writer) error {
+	return s.conn.Session(ctx, func(session *ssh.Session) error {
+		session.Stdout = stdOut
+		session.Stderr = stdErr
+		if !cmd.sudo || cmd.sudoPassword == "" {
+			return s.runCommand(ctx, session, cmd.start(session))
+		}
+
+		tail := &stderrTail{w: stdErr}
+		session.Stderr = tail
+		err := s.runCommand(ctx, session, cmd.start(session))
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode == sudoNotCachedStatus &&
+			bytes.HasSuffix(tail.tail, []byte(sudoNotCachedMessage+"\n")) {
+			return fmt.Errorf("%w: %w", ErrSudoNotCached, err)
+		}
+		return err
+	})
+}
+
+// stderrTail writes to w, and keeps the end of the output to tell the failure of
+// the sudo credentials check from the exit status of the command.
+type stderrTail struct {
+	w    io.Writer
+	tail []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.tail = append(t.tail, p...)
+	if n := len(sudoNotCachedMessage) + 1; len(t.tail) > n {
+		t.tail = append(t.tail[:0], t.tail[len(t.tail)-n:]...)
+	}
+	if t.w == nil {
+		return len(p), nil
+	}
+	return t.w.Write(p)
+}
+
+// safeWord matches the words not needing quotes.
+var safeWord = regexp.MustCompile(`^[A-Za-z0-9_@%+:,./-]+$`)
+
+// ShellQuote quotes s as a single word for POSIX shells.
+// Words of only safe characters are kept as is.
+//
+// Example:
+//
+//	ShellQuote("it's")       // 'it'\''s'
+//	ShellQuote("/tmp/a.txt") // /tmp/a.txt
+func ShellQuote(s string) string {
+	if safeWord.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,153 @@
+package sshx_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"":               "''",
+		"/tmp/a-b_c.txt": "/tmp/a-b_c.txt",
+		"a b":            "'a b'",
+		"it's":           `'it'\''s'`,
+		"$(rm -rf /)":    "'$(rm -rf /)'",
+		"A=b":            "'A=b'",
+		"~/file":         "'~/file'",
+		"*":              "'*'",
+	}
+	for in, want := range tests {
+		require.Equal(t, want, sshx.ShellQuote(in), in)
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	cmd := sshx.NewCommand("tar", "-xzf", "my archive.tgz").Arg("-C", "/srv/app").
+		Dir("/tmp/work dir").Env("LANG", "C.UTF-8").Env("NAME", "a b")
+	require.Equal(t, `cd -- '/tmp/work dir' && env 'LANG=C.UTF-8' 'NAME=a b' tar -xzf 'my archive.tgz' -C /srv/app`, cmd.String())
+
+	cmd = sshx.NewCommand("systemctl", "restart", "app").SudoAs("deploy", "secret")
+	require.Equal(t, `IFS= read -r sudo_password && printf '%s\n' "$sudo_password" | sudo -S -p '' -u deploy -v && `+
+		`{ sudo -n -u deploy -v 2>/dev/null || { echo 'sshx: sudo credentials not cached' >&2; exit 125; }; } && `+
+		`sudo -n -u deploy -- systemctl restart app`, cmd.String())
+	require.NotContains(t, cmd.String(), "secret")
+
+	cmd = sshx.NewCommand("id").Sudo("")
+	require.Equal(t, `sudo -n -- id`, cmd.String())
+}
+
+func TestRunCommand(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "it's a dir")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+
+	for _, acceptEnv := range []bool{true, false} {
+		var opts []sshxtest.Option
+		if !acceptEnv {
+			opts = append(opts, sshxtest.WithRejectEnv())
+		}
+		server := sshxtest.New(t, opts...)
+		runner, err := sshx.NewSshRunner("user", "127.0.0.1", server.Options()...)
+		require.NoError(t, err)
+		defer runner.Close()
+
+		// the arguments are not interpreted by the shell
+		output, err := runner.RunCommand(ctx, sshx.NewCommand("printf", "%s|", "a b", "$HOME", "; echo pwned").
+			Dir(dir).Env("GREETING", "hi 'there'"))
+		require.NoError(t, err)
+		require.Equal(t, "a b|$HOME|; echo pwned|", output)
+
+		output, err = runner.RunCommand(ctx, sshx.NewCommand("sh", "-c", `pwd; echo "$GREETING"; cat`).
+			Dir(dir).Env("GREETING", "hi 'there'").Stdin(strings.NewReader("input")))
+		require.NoError(t, err)
+		require.Equal(t, dir+"\nhi 'there'\ninput", output)
+
+		_, err = runner.RunCommand(ctx, sshx.NewCommand("sh", "-c", "exit 4"))
+		var exitErr *sshx.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		require.Equal(t, 4, exitErr.ExitCode)
+	}
+}
+
+// sudoStub writes a fake sudo to a directory put first in PATH. sudo -v reads the password
+// line from stdin if password is not empty, or reads nothing like NOPASSWD,
+// and sudo -n runs the command, or fails if the password is not cached.
+func sudoStub(t *testing.T, password string, cached bool) {
+	validate := "exit 0"
+	required := ""
+	if password != "" {
+		validate = `IFS= read -r line; [ "$line" = ` + sshx.ShellQuote(password) + ` ] || { echo "Sorry, try again." >&2; exit 1; }; exit 0`
+		if !cached {
+			required = "1"
+		}
+	}
+	check := `[ -z "` + required + `" ] || { echo "sudo: a password is required" >&2; exit 1; }`
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sudo"), []byte(`#!/bin/sh
+noninteractive=
+while [ $# -gt 0 ]; do
+  case "$1" in
+  -n) noninteractive=1 ;;
+  -v) [ -n "$noninteractive" ] && { `+check+`; exit 0; }; `+validate+` ;;
+  -p|-u) shift ;;
+  --) shift; [ -n "$noninteractive" ] && `+check+`; exec "$@" ;;
+  esac
+  shift
+done
+exit 1
+`), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRunCommandSudo(t *testing.T) {
+	ctx := context.Background()
+	runner := sshxtest.New(t).Runner()
+
+	t.Run("password", func(t *testing.T) {
+		sudoStub(t, "s3cret", true)
+		output, err := runner.RunCommand(ctx,
+			sshx.NewCommand("cat").Sudo("s3cret").Env("A", "1").Stdin(strings.NewReader("config")))
+		require.NoError(t, err)
+		require.Equal(t, "config", output)
+
+		_, err = runner.RunCommand(ctx, sshx.NewCommand("echo", "run").Sudo("wrong"))
+		var exitErr *sshx.ExitError
+		require.ErrorAs(t, err, &exitErr)
+	})
+
+	t.Run("nopasswd", func(t *testing.T) {
+		// the password is never read by sudo, nor by the command
+		sudoStub(t, "", false)
+		output, err := runner.RunCommand(ctx,
+			sshx.NewCommand("cat").Sudo("s3cret").Stdin(strings.NewReader("config")))
+		require.NoError(t, err)
+		require.Equal(t, "config", output)
+		require.NotContains(t, output, "s3cret")
+
+		output, err = runner.RunCommand(ctx, sshx.NewCommand("cat").Sudo("s3cret"))
+		require.NoError(t, err)
+		require.Empty(t, output)
+	})
+
+	t.Run("not cached", func(t *testing.T) {
+		sudoStub(t, "s3cret", false)
+		_, err := runner.RunCommand(ctx, sshx.NewCommand("echo", "run").Sudo("s3cret"))
+		require.ErrorIs(t, err, sshx.ErrSudoNotCached)
+		var exitErr *sshx.ExitError
+		require.ErrorAs(t, err, &exitErr)
+
+		// the command exiting with the same status is not mistaken for it
+		sudoStub(t, "s3cret", true)
+		_, err = runner.RunCommand(ctx, sshx.NewCommand("sh", "-c", "exit 125").Sudo("s3cret"))
+		require.ErrorAs(t, err, &exitErr)
+		require.Equal(t, 125, exitErr.ExitCode)
+		require.NotErrorIs(t, err, sshx.ErrSudoNotCached)
+	})
+}
@@ -0,0 +1,378 @@
+package sshx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/utils/timerx"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultKeepaliveInterval    = 30 * time.Second
+	defaultMaxSessions          = 10 // the default MaxSessions of OpenSSH sshd
+	defaultMaxReconnectAttempts = 5
+)
+
+var (
+	// ErrConnClosed is returned when using a Conn after Close.
+	ErrConnClosed = errors.New("sshx: connection closed")
+
+	// ErrConnLost is returned when the connection is lost and cannot be
+	// reconnected, e.g. a Conn created from an existing *ssh.Client.
+	ErrConnLost = errors.New("sshx: connection lost")
+)
+
+// WithKeepalive sets the interval of keepalive requests of managed connections.
+// A connection is closed and reconnected on next use if a keepalive request
+// is not replied within the interval. The default is 30 seconds, 0 disables it.
+//
+// Example:
+//
+//	runner, err := NewSshRunner("user", "example.com", WithKeepalive(10*time.Second))
+func WithKeepalive(interval time.Duration) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.keepaliveInterval = interval
+		return nil
+	}
+}
+
+// WithMaxSessions caps the concurrent sessions of a managed connection.
+// Further sessions wait for a free slot. It should not exceed the MaxSessions
+// of the server, which is 10 by default for OpenSSH, the same as the default here.
+func WithMaxSessions(n int) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		if n <= 0 {
+			return fmt.Errorf("sshx: max sessions must be positive, got %d", n)
+		}
+		c.maxSessions = n
+		return nil
+	}
+}
+
+// WithReconnect sets how a managed connection reconnects after it is lost:
+// up to maxAttempts dials, waiting backoff.Next() between them.
+// The default is 5 attempts with exponential backoff from 1 second to 30 seconds.
+//
+// Example:
+//
+//	WithReconnect(timerx.NewExponentialBackoff(10, 500*time.Millisecond, time.Minute), 10)
+func WithReconnect(backoff timerx.Timer, maxAttempts int) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.reconnectBackoff = backoff
+		c.maxReconnectAttempts = maxAttempts
+		return nil
+	}
+}
+
+// Conn is a managed SSH connection. It detects dead connections by keepalive
+// requests, reconnects transparently on next use with backoff, and caps the
+// concurrent sessions. It is safe for concurrent use.
+//
+// Example:
+//
+//	conn, err := DialConn("user", "example.com", WithDefaultAuth())
+//	if err != nil {
+//	    return err
+//	}
+//	defer conn.Close()
+//	err = conn.Session(ctx, func(session *ssh.Session) error {
+//	    return session.Run("uptime")
+//	})
+type Conn struct {
+	dial  func(ctx context.Context) (*ssh.Client, error) // nil if the connection cannot be reconnected
+	cfg   *sshClientConfig
+	slots chan struct{}
+
+	// ctx is the context of the reconnections, canceled by Close, so that a
+	// reconnection does not depend on the context of the user starting it
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex // guards the fields below
+	client  *ssh.Client
+	dialing *dialCall
+	closed  bool
+}
+
+// dialCall is an in-flight reconnection, which concurrent users wait for.
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
+// DialConn connects to the host and returns a managed connection.
+// The options are the same as MakeSSHClient, plus WithKeepalive,
+// WithMaxSessions and WithReconnect.
+func DialConn(user, host string, opts ...SSHClientOption) (*Conn, error) {
+	return dialConn(context.Background(), user, host, opts...)
+}
+
+// dialConn is DialConn, aborting the first dial once ctx is done.
+func dialConn(ctx context.Context, user, host string, opts ...SSHClientOption) (*Conn, error) {
+	cfg, err := newSSHClientConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ensureAuth(host); err != nil {
+		return nil, err
+	}
+	c := newConn(cfg, func(ctx context.Context) (*ssh.Client, error) {
+		return makeSSHClientWithCustom(ctx, user, host, cfg)
+	})
+	client, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.setClient(client)
+	return c, nil
+}
+
+// NewConnWithClient manages an existing SSH client. As the client cannot be
+// redialed, the Conn returns ErrConnLost once the connection drops.
+func NewConnWithClient(client *ssh.Client, opts ...SSHClientOption) (*Conn, error) {
+	cfg, err := newSSHClientConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(cfg, nil)
+	c.setClient(client)
+	return c, nil
+}
+
+func newConn(cfg *sshClientConfig, dial func(ctx context.Context) (*ssh.Client, error)) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Conn{
+		dial:   dial,
+		cfg:    cfg,
+		slots:  make(chan struct{}, cfg.maxSessions),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Session runs f with a new session, waiting for a free session slot and
+// reconnecting first if the connection is lost. The session is closed after f returns.
+func (c *Conn) Session(ctx context.Context, f func(session *ssh.Session) error) error {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-c.slots }()
+
+	session, err := c.newSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	return f(session)
+}
+
+// Client returns the current SSH client, reconnecting first if the connection is lost.
+// The client must not be closed by the caller, and may be replaced after it drops.
+func (c *Conn) Client(ctx context.Context) (*ssh.Client, error) {
+	return c.currentClient(ctx)
+}
+
+func (c *Conn) newSession(ctx context.Context) (*ssh.Session, error) {
+	client, err := c.currentClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+	var openErr *ssh.OpenChannelError
+	if errors.As(err, &openErr) {
+		// the server refused the session, but the connection is alive
+		return nil, err
+	}
+
+	// the connection died before keepalive noticed, reconnect once
+	log.Warnf(ctx, "ssh new session failed, reconnecting: %v", err)
+	c.dropClient(client)
+	client, err = c.currentClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
+
+func (c *Conn) currentClient(ctx context.Context) (*ssh.Client, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrConnClosed
+	}
+	if c.client != nil {
+		client := c.client
+		c.mu.Unlock()
+		return client, nil
+	}
+	if c.dial == nil {
+		c.mu.Unlock()
+		return nil, ErrConnLost
+	}
+	call := c.dialing
+	if call == nil {
+		call = &dialCall{done: make(chan struct{})}
+		c.dialing = call
+		go c.reconnect(call)
+	}
+	c.mu.Unlock()
+
+	// the reconnection goes on for the other users if ctx is done
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if call.err != nil {
+		return nil, call.err
+	}
+	return c.currentClient(ctx)
+}
+
+// reconnect redials under the context of the Conn, and completes the call.
+func (c *Conn) reconnect(call *dialCall) {
+	client, err := c.redial(c.ctx)
+
+	c.mu.Lock()
+	c.dialing = nil
+	switch {
+	case c.closed:
+		if err == nil {
+			client.Close()
+		}
+		call.err = ErrConnClosed
+	case err != nil:
+		call.err = err
+	default:
+		c.setClientLocked(client)
+	}
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// redial dials up to maxReconnectAttempts times with backoff between the attempts.
+func (c *Conn) redial(ctx context.Context) (*ssh.Client, error) {
+	backoff := c.cfg.reconnectBackoff.Clone()
+	attempts := c.cfg.maxReconnectAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var client *ssh.Client
+		client, err = c.dial(ctx)
+		if err == nil {
+			log.Infof(ctx, "ssh reconnected after %d attempts", attempt)
+			return client, nil
+		}
+		log.Warnf(ctx, "ssh reconnect attempt %d failed: %v", attempt, err)
+		if attempt >= attempts {
+			break
+		}
+
+		timer := time.NewTimer(backoff.Next())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("%w: reconnect failed after %d attempts: %v", ErrConnLost, attempts, err)
+}
+
+func (c *Conn) setClient(client *ssh.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setClientLocked(client)
+}
+
+// setClientLocked must be called with mu held.
+func (c *Conn) setClientLocked(client *ssh.Client) {
+	c.client = client
+	stop := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(stop)
+		c.dropClient(client)
+	}()
+	if c.cfg.keepaliveInterval > 0 {
+		go c.keepalive(client, stop)
+	}
+}
+
+// dropClient closes the client, and forgets it if it is still the current one.
+func (c *Conn) dropClient(client *ssh.Client) {
+	client.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == client {
+		c.client = nil
+	}
+}
+
+// keepalive sends keepalive requests until the connection is closed,
+// and closes it once a request is not replied in time.
+func (c *Conn) keepalive(client *ssh.Client, stop <-chan struct{}) {
+	interval := c.cfg.keepaliveInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			// any reply, even a failure, means the connection is alive
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+
+		timer := time.NewTimer(interval)
+		select {
+		case err := <-replied:
+			timer.Stop()
+			if err == nil {
+				continue
+			}
+			log.Warnf(context.Background(), "ssh keepalive failed, closing connection: %v", err)
+		case <-timer.C:
+			log.Warnf(context.Background(), "ssh keepalive timed out after %s, closing connection", interval)
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		c.dropClient(client)
+		return
+	}
+}
+
+// Close closes the connection. Sessions in use are closed as well.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.cancel()
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Close()
+	c.client = nil
+	return err
+}
@@ -0,0 +1,187 @@
+package sshx_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/RyoJerryYu/go-utilx/pkg/utils/timerx"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func fastReconnect() sshx.SSHClientOption {
+	return sshx.WithReconnect(timerx.NewExponentialBackoff(3, 10*time.Millisecond, 50*time.Millisecond), 3)
+}
+
+func TestSshRunnerReconnect(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	runner, err := sshx.NewSshRunner("user", "127.0.0.1", server.Options(fastReconnect())...)
+	require.NoError(t, err)
+	defer runner.Close()
+	ctx := context.Background()
+
+	output, err := runner.Run(ctx, "hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello", output)
+
+	server.CloseConnections()
+	time.Sleep(50 * time.Millisecond)
+
+	output, err = runner.Run(ctx, "again")
+	require.NoError(t, err)
+	require.Equal(t, "again", output)
+	require.EqualValues(t, 2, server.Dials())
+}
+
+func TestConnKeepaliveDetectsDeadPeer(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	conn, err := sshx.DialConn("user", "127.0.0.1", server.Options(sshx.WithKeepalive(20*time.Millisecond), fastReconnect())...)
+	require.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+
+	first, err := conn.Client(ctx)
+	require.NoError(t, err)
+
+	server.IgnoreKeepalive(true)
+	require.Eventually(t, func() bool {
+		second, err := conn.Client(ctx)
+		return err == nil && second != first
+	}, time.Second, 10*time.Millisecond, "keepalive should drop the dead connection")
+
+	server.IgnoreKeepalive(false)
+	_, err = sshx.NewSshRunnerWithConn(conn).Run(ctx, "alive")
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, server.Dials(), 2)
+}
+
+func TestConnReconnectFails(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	conn, err := sshx.DialConn("user", "127.0.0.1", server.Options(fastReconnect())...)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	server.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	err = conn.Session(context.Background(), func(*ssh.Session) error { return nil })
+	require.ErrorIs(t, err, sshx.ErrConnLost)
+
+	require.NoError(t, conn.Close())
+	_, err = conn.Client(context.Background())
+	require.ErrorIs(t, err, sshx.ErrConnClosed)
+}
+
+func TestConnReconnectContext(t *testing.T) {
+	// the reconnection blocks in the authentication until the gate opens
+	gate := make(chan struct{})
+	var server *sshxtest.Server
+	server = sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithServerConfig(func(config *ssh.ServerConfig) {
+		authenticate := config.PublicKeyCallback
+		config.PublicKeyCallback = func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if server.Dials() > 1 {
+				<-gate
+			}
+			return authenticate(conn, key)
+		}
+	}))
+	conn, err := sshx.DialConn("user", "127.0.0.1", server.Options(fastReconnect())...)
+	require.NoError(t, err)
+	defer conn.Close()
+	first, err := conn.Client(context.Background())
+	require.NoError(t, err)
+
+	server.CloseConnections()
+	time.Sleep(50 * time.Millisecond)
+
+	// the user starting the reconnection gives up, the reconnection goes on
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = conn.Session(ctx, func(*ssh.Session) error { return nil })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(gate)
+	second, err := conn.Client(context.Background())
+	require.NoError(t, err)
+	require.NotSame(t, first, second)
+	require.Equal(t, 2, server.Dials())
+}
+
+func TestConnMaxSessions(t *testing.T) {
+	release := make(chan struct{})
+	server := sshxtest.New(t, sshxtest.WithHandler(func(ctx context.Context, req *sshxtest.Request) int {
+		<-release
+		return 0
+	}))
+	conn, err := sshx.DialConn("user", "127.0.0.1", server.Options(sshx.WithMaxSessions(2))...)
+	require.NoError(t, err)
+	defer conn.Close()
+	runner := sshx.NewSshRunnerWithConn(conn)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := runner.Run(context.Background(), "block")
+			require.NoError(t, err)
+		}()
+	}
+	require.Eventually(t, func() bool { return server.Sessions() == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.EqualValues(t, 2, server.Sessions())
+
+	close(release)
+	wg.Wait()
+	require.EqualValues(t, 2, server.MaxSessions())
+
+	// waiting for a slot honors the context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go conn.Session(context.Background(), func(*ssh.Session) error { <-block; return nil })
+	}
+	time.Sleep(20 * time.Millisecond)
+	_, err = runner.Run(ctx, "late")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	close(block)
+}
+
+func TestPool(t *testing.T) {
+	server1 := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	server2 := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	pool := sshx.NewPool(sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM))
+	defer pool.Close()
+
+	conn1, err := pool.Get(context.Background(), "user", "127.0.0.1", sshx.WithPort(server1.Port()))
+	require.NoError(t, err)
+	again, err := pool.Get(context.Background(), "user", "127.0.0.1", sshx.WithPort(server1.Port()))
+	require.NoError(t, err)
+	require.Same(t, conn1, again)
+	other, err := pool.Get(context.Background(), "other", "127.0.0.1", sshx.WithPort(server1.Port()))
+	require.NoError(t, err)
+	require.NotSame(t, conn1, other)
+
+	runner, err := pool.Runner(context.Background(), "user", "127.0.0.1", sshx.WithPort(server2.Port()))
+	require.NoError(t, err)
+	output, err := runner.Run(context.Background(), "hi")
+	require.NoError(t, err)
+	require.Equal(t, "hi", output)
+	require.EqualValues(t, 2, server1.Dials())
+	require.EqualValues(t, 1, server2.Dials())
+
+	require.NoError(t, pool.Remove("user", "127.0.0.1", server1.Port()))
+	_, err = conn1.Client(context.Background())
+	require.ErrorIs(t, err, sshx.ErrConnClosed)
+
+	require.NoError(t, pool.Close())
+	_, err = runner.Run(context.Background(), "closed")
+	require.ErrorIs(t, err, sshx.ErrConnClosed)
+	_, err = pool.Get(context.Background(), "user", "127.0.0.1", sshx.WithPort(server2.Port()))
+	require.ErrorIs(t, err, sshx.ErrConnClosed)
+}
@@ -0,0 +1,219 @@
+package sshx
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/proxy"
+)
+
+// Dialer dials the connections to the SSH hosts. *net.Dialer and *ssh.Client are Dialers.
+type Dialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// WithDialer dials the first hop, the first jump host or the host itself, by the dialer.
+func WithDialer(dialer Dialer) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.dialer = dialer
+		return nil
+	}
+}
+
+// WithProxy dials the first hop, the first jump host or the host itself, through a proxy,
+// like ProxyCommand of OpenSSH with `nc -X`. The proxy URL is one of:
+// - socks5://[user:password@]host:port, the host names are resolved by the proxy
+// - http://[user:password@]host:port, by the HTTP CONNECT method
+//
+// Example:
+//
+//	runner, err := NewSshRunner("user", "example.com", WithProxy("socks5://127.0.0.1:1080"))
+func WithProxy(proxyURL string) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return err
+		}
+		forward := &net.Dialer{}
+		switch u.Scheme {
+		case "socks5", "socks5h":
+			var auth *proxy.Auth
+			if u.User != nil {
+				password, _ := u.User.Password()
+				auth = &proxy.Auth{User: u.User.Username(), Password: password}
+			}
+			dialer, err := proxy.SOCKS5("tcp", u.Host, auth, forward)
+			if err != nil {
+				return err
+			}
+			c.dialer = dialer.(Dialer)
+		case "http":
+			d := &httpConnectDialer{proxyAddr: u.Host, forward: forward}
+			if u.User != nil {
+				password, _ := u.User.Password()
+				d.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+			}
+			c.dialer = d
+		default:
+			return fmt.Errorf("sshx: unsupported proxy scheme %q", u.Scheme)
+		}
+		return nil
+	}
+}
+
+// jumpHost is a hop of WithJumpHost.
+type jumpHost struct {
+	user string
+	host string
+	cfg  *sshClientConfig
+}
+
+// WithJumpHost connects to the host through an intermediate SSH host, like
+// ProxyJump of OpenSSH. Given multiple times, the hops are chained in order,
+// the first one connected first.
+//
+// opts configure the hop, e.g. its port. The authentication, host key verification
+// and ssh config not given in opts are the same as the host's.
+// The hops are closed when the client of the host is closed, and are redialed
+// on reconnection of managed connections.
+//
+// Example:
+//
+//	// ssh -J admin@bastion.example.com:2222 deploy@10.0.0.5
+//	runner, err := NewSshRunner("deploy", "10.0.0.5",
+//	    WithKnownHosts(),
+//	    WithJumpHost("admin", "bastion.example.com", WithPort(2222)),
+//	)
+func WithJumpHost(user, host string, opts ...SSHClientOption) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		cfg, err := newSSHClientConfig(opts...)
+		if err != nil {
+			return err
+		}
+		c.jumpHosts = append(c.jumpHosts, &jumpHost{user: user, host: host, cfg: cfg})
+		return nil
+	}
+}
+
+// dial connects to the host through the dialer and the jump hosts.
+func (c *sshClientConfig) dial(ctx context.Context, user, host string) (*ssh.Client, error) {
+	var dialer Dialer = &net.Dialer{}
+	if c.dialer != nil {
+		dialer = c.dialer
+	}
+
+	var hops []*ssh.Client
+	closeHops := func() {
+		for i := len(hops) - 1; i >= 0; i-- {
+			hops[i].Close()
+		}
+	}
+	for _, hop := range c.jumpHosts {
+		client, err := dialSSH(ctx, dialer, hop.user, hop.host, hop.inherit(c))
+		if err != nil {
+			closeHops()
+			return nil, fmt.Errorf("sshx: jump host %s: %w", hop.host, err)
+		}
+		hops = append(hops, client)
+		dialer = client
+	}
+
+	client, err := dialSSH(ctx, dialer, user, host, c)
+	if err != nil {
+		closeHops()
+		return nil, err
+	}
+	if len(hops) > 0 {
+		go func() {
+			client.Wait()
+			closeHops()
+		}()
+	}
+	return client, nil
+}
+
+// inherit returns the config of the hop, with the authentication, host key verification
+// and ssh config of the host if not given.
+func (h *jumpHost) inherit(host *sshClientConfig) *sshClientConfig {
+	cfg := *h.cfg
+	if len(cfg.auth) == 0 {
+		cfg.auth = host.auth
+	}
+	if cfg.hostKeyCallback == nil {
+		cfg.hostKeyCallback = host.hostKeyCallback
+		cfg.hostKeyAlgorithms = host.hostKeyAlgorithms
+	}
+	if len(cfg.sshConfigs) == 0 {
+		cfg.sshConfigs = host.sshConfigs
+	}
+	return &cfg
+}
+
+// httpConnectDialer dials through an HTTP proxy by the CONNECT method.
+type httpConnectDialer struct {
+	proxyAddr     string
+	authorization string // Proxy-Authorization header, if any
+	forward       Dialer
+}
+
+func (d *httpConnectDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	br, err := d.connect(conn, addr)
+	if !stop() {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if br.Buffered() > 0 {
+		// the server may speak first, e.g. the SSH banner
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+func (d *httpConnectDialer) connect(conn net.Conn, addr string) (*bufio.Reader, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if d.authorization != "" {
+		req.Header.Set("Proxy-Authorization", d.authorization)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sshx: proxy %s CONNECT %s: %s", d.proxyAddr, addr, resp.Status)
+	}
+	return br, nil
+}
+
+// bufferedConn reads the data buffered before the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
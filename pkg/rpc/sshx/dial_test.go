@@ -0,0 +1,231 @@
+package sshx_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJumpHost(t *testing.T) {
+	target := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	jump1 := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	jump2 := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+
+	// the hops inherit the authentication of the target
+	runner, err := sshx.NewSshRunner("user", "127.0.0.1", target.Options(
+		sshx.WithInsecureIgnoreHostKey(),
+		sshx.WithJumpHost("admin", "127.0.0.1", sshx.WithPort(jump1.Port())),
+		sshx.WithJumpHost("admin", "127.0.0.1", sshx.WithPort(jump2.Port())),
+		fastReconnect(),
+	)...)
+	require.NoError(t, err)
+	defer runner.Close()
+
+	output, err := runner.Run(context.Background(), "hello")
+	require.NoError(t, err)
+	require.Equal(t, "hello", output)
+	require.EqualValues(t, 1, jump1.Forwards(), "jump1 forwards to jump2")
+	require.EqualValues(t, 1, jump2.Forwards(), "jump2 forwards to target")
+
+	// losing a hop reconnects the whole path
+	jump1.CloseConnections()
+	time.Sleep(50 * time.Millisecond)
+	output, err = runner.Run(context.Background(), "again")
+	require.NoError(t, err)
+	require.Equal(t, "again", output)
+	require.EqualValues(t, 2, jump1.Dials())
+	require.EqualValues(t, 2, target.Dials())
+}
+
+func TestJumpHostFails(t *testing.T) {
+	target := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	jump := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithAuthorizedKeys())
+
+	_, err := sshx.MakeSSHClient("user", "127.0.0.1", target.Options(
+		sshx.WithInsecureIgnoreHostKey(),
+		sshx.WithJumpHost("admin", "127.0.0.1", sshx.WithPort(jump.Port())),
+	)...)
+	require.ErrorContains(t, err, "jump host 127.0.0.1")
+	require.EqualValues(t, 0, target.Dials())
+}
+
+func TestProxy(t *testing.T) {
+	target := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+
+	t.Run("socks5", func(t *testing.T) {
+		proxy, used := newTestSOCKS5Proxy(t, "alice", "secret")
+		runner, err := sshx.NewSshRunner("user", "127.0.0.1", target.Options(
+			sshx.WithInsecureIgnoreHostKey(),
+			sshx.WithProxy("socks5://alice:secret@"+proxy),
+		)...)
+		require.NoError(t, err)
+		defer runner.Close()
+		output, err := runner.Run(context.Background(), "hello")
+		require.NoError(t, err)
+		require.Equal(t, "hello", output)
+		require.EqualValues(t, 1, used.Load())
+
+		_, err = sshx.MakeSSHClient("user", "127.0.0.1", target.Options(
+			sshx.WithInsecureIgnoreHostKey(),
+			sshx.WithProxy("socks5://alice:wrong@"+proxy),
+		)...)
+		require.Error(t, err)
+	})
+
+	t.Run("http", func(t *testing.T) {
+		proxy, used := newTestHTTPProxy(t, "Basic YWxpY2U6c2VjcmV0") // alice:secret
+		runner, err := sshx.NewSshRunner("user", "127.0.0.1", target.Options(
+			sshx.WithInsecureIgnoreHostKey(),
+			sshx.WithProxy("http://alice:secret@"+proxy),
+		)...)
+		require.NoError(t, err)
+		defer runner.Close()
+		output, err := runner.Run(context.Background(), "hello")
+		require.NoError(t, err)
+		require.Equal(t, "hello", output)
+		require.EqualValues(t, 1, used.Load())
+
+		_, err = sshx.MakeSSHClient("user", "127.0.0.1", target.Options(
+			sshx.WithInsecureIgnoreHostKey(),
+			sshx.WithProxy("http://"+proxy),
+		)...)
+		require.ErrorContains(t, err, "407")
+	})
+
+	t.Run("with jump host", func(t *testing.T) {
+		jump := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+		proxy, used := newTestSOCKS5Proxy(t, "", "")
+		client, err := sshx.MakeSSHClient("user", "127.0.0.1", target.Options(
+			sshx.WithInsecureIgnoreHostKey(),
+			sshx.WithProxy("socks5://"+proxy),
+			sshx.WithJumpHost("admin", "127.0.0.1", sshx.WithPort(jump.Port())),
+		)...)
+		require.NoError(t, err)
+		defer client.Close()
+		require.EqualValues(t, 1, used.Load(), "the proxy dials the jump host")
+		require.EqualValues(t, 1, jump.Forwards())
+	})
+
+	_, err := sshx.MakeSSHClient("user", "127.0.0.1", sshx.WithProxy("ftp://127.0.0.1:21"))
+	require.ErrorContains(t, err, "unsupported proxy scheme")
+}
+
+// newTestSOCKS5Proxy serves a SOCKS5 proxy for CONNECT, requiring the user and password if not empty.
+func newTestSOCKS5Proxy(t *testing.T, user, password string) (string, *atomic.Int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	used := &atomic.Int32{}
+
+	readString := func(r io.Reader) string {
+		n := make([]byte, 1)
+		io.ReadFull(r, n)
+		b := make([]byte, n[0])
+		io.ReadFull(r, b)
+		return string(b)
+	}
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		io.ReadFull(conn, make([]byte, header[1])) // methods
+		if user == "" {
+			conn.Write([]byte{5, 0})
+		} else {
+			conn.Write([]byte{5, 2})
+			io.ReadFull(conn, make([]byte, 1)) // version
+			if readString(conn) != user || readString(conn) != password {
+				conn.Write([]byte{1, 1})
+				return
+			}
+			conn.Write([]byte{1, 0})
+		}
+
+		request := make([]byte, 4)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		var host string
+		switch request[3] {
+		case 1:
+			ip := make([]byte, 4)
+			io.ReadFull(conn, ip)
+			host = net.IP(ip).String()
+		case 3:
+			host = readString(conn)
+		default:
+			return
+		}
+		port := make([]byte, 2)
+		io.ReadFull(conn, port)
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+		if err != nil {
+			conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		used.Add(1)
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		sshx.PipeConns(conn, target)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return listener.Addr().String(), used
+}
+
+// newTestHTTPProxy serves an HTTP CONNECT proxy requiring the Proxy-Authorization.
+func newTestHTTPProxy(t *testing.T, authorization string) (string, *atomic.Int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	used := &atomic.Int32{}
+
+	handle := func(conn net.Conn) {
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != authorization {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return
+		}
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			return
+		}
+		used.Add(1)
+		io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n")
+		sshx.PipeConns(conn, target)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return listener.Addr().String(), used
+}
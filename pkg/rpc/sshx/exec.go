@@ -0,0 +1,130 @@
+package sshx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultKillGracePeriod = 5 * time.Second
+
+var (
+	// ErrCommandTimeout is returned when the context of a command expires before it exits.
+	// The error also wraps context.DeadlineExceeded.
+	ErrCommandTimeout = errors.New("sshx: command timed out")
+
+	// ErrCommandCanceled is returned when the context of a command is canceled before it exits.
+	// The error also wraps context.Canceled.
+	ErrCommandCanceled = errors.New("sshx: command canceled")
+)
+
+// ExitError is returned when a remote command exits with a non-zero status, or by a signal.
+// It wraps the *ssh.ExitError.
+//
+// Example:
+//
+//	_, err := runner.Run(ctx, "grep -q pattern file")
+//	var exitErr *ExitError
+//	if errors.As(err, &exitErr) && exitErr.ExitCode == 1 {
+//	    // not found
+//	}
+type ExitError struct {
+	Cmd string
+	// ExitCode is the exit status, or 128 + the signal number if exited by a signal.
+	ExitCode int
+	// Signal is the name of the signal without "SIG", e.g. "KILL", if exited by a signal.
+	Signal string
+	Err    *ssh.ExitError
+}
+
+func (e *ExitError) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("sshx: command %q exited by signal %s", e.Cmd, e.Signal)
+	}
+	return fmt.Sprintf("sshx: command %q exited with status %d", e.Cmd, e.ExitCode)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// WithKillGracePeriod sets how long a command is given to exit after SIGTERM,
+// once its context is done, before SIGKILL. The default is 5 seconds.
+func WithKillGracePeriod(d time.Duration) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.killGracePeriod = d
+		return nil
+	}
+}
+
+// runCommand runs cmd in the session until it exits or ctx is done.
+// Once ctx is done, the remote process is sent SIGTERM, then SIGKILL after the
+// grace period, and the session is closed, as servers may not support signals.
+func runCommand(ctx context.Context, session *ssh.Session, cmd string, gracePeriod time.Duration) error {
+	if ctx.Err() != nil {
+		return commandContextError(ctx, cmd)
+	}
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	return waitCommand(ctx, session, cmd, gracePeriod)
+}
+
+// waitCommand waits for the started cmd to exit, terminating it once ctx is done, see runCommand.
+func waitCommand(ctx context.Context, session *ssh.Session, cmd string, gracePeriod time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return wrapExitError(cmd, err)
+	case <-ctx.Done():
+	}
+
+	log.Warnf(ctx, "ssh command %q interrupted, sending SIGTERM: %v", cmd, ctx.Err())
+	if err := session.Signal(ssh.SIGTERM); err != nil {
+		log.Warnf(ctx, "ssh command %q SIGTERM failed: %v", cmd, err)
+	}
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Warnf(ctx, "ssh command %q not exited in %s, sending SIGKILL", cmd, gracePeriod)
+		if err := session.Signal(ssh.SIGKILL); err != nil {
+			log.Warnf(ctx, "ssh command %q SIGKILL failed: %v", cmd, err)
+		}
+		session.Close()
+		select {
+		case <-done:
+		case <-time.After(gracePeriod):
+			log.Warnf(ctx, "ssh command %q session not closed in %s, abandoned", cmd, gracePeriod)
+		}
+	}
+	return commandContextError(ctx, cmd)
+}
+
+func commandContextError(ctx context.Context, cmd string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %q: %w", ErrCommandTimeout, cmd, ctx.Err())
+	}
+	return fmt.Errorf("%w: %q: %w", ErrCommandCanceled, cmd, ctx.Err())
+}
+
+func wrapExitError(cmd string, err error) error {
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	return &ExitError{
+		Cmd:      cmd,
+		ExitCode: exitErr.ExitStatus(),
+		Signal:   exitErr.Signal(),
+		Err:      exitErr,
+	}
+}
@@ -0,0 +1,125 @@
+package sshx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// blockingHandler blocks the commands until they are signaled or the test ends,
+// except "exit 3" exiting with 3.
+func blockingHandler(t *testing.T) (sshxtest.Handler, <-chan struct{}) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	started := make(chan struct{}, 16)
+	return func(ctx context.Context, req *sshxtest.Request) int {
+		switch req.Command {
+		case "exit 3":
+			io.WriteString(req.Stdout, "out")
+			io.WriteString(req.Stderr, "err")
+			return 3
+		}
+		io.WriteString(req.Stdout, "partial")
+		started <- struct{}{}
+		select {
+		case <-ctx.Done():
+		case <-release:
+		}
+		return 0
+	}, started
+}
+
+func TestRunExitError(t *testing.T) {
+	handler, _ := blockingHandler(t)
+	server := sshxtest.New(t, sshxtest.WithHandler(handler))
+	runner, err := sshx.NewSshRunner("user", "127.0.0.1", server.Options()...)
+	require.NoError(t, err)
+	defer runner.Close()
+
+	output, err := runner.Run(context.Background(), "exit 3")
+	require.Equal(t, "out", output)
+	var exitErr *sshx.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, "exit 3", exitErr.Cmd)
+	require.Equal(t, 3, exitErr.ExitCode)
+	require.Empty(t, exitErr.Signal)
+	var sshErr *ssh.ExitError
+	require.ErrorAs(t, err, &sshErr, "the ssh error is wrapped")
+
+	var stdout, stderr bytes.Buffer
+	err = runner.RunLog(context.Background(), "exit 3", &stdout, &stderr)
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, "out", stdout.String())
+	require.Equal(t, "err", stderr.String())
+}
+
+func TestRunContext(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		handler, _ := blockingHandler(t)
+		server := sshxtest.New(t, sshxtest.WithHandler(handler))
+		runner, err := sshx.NewSshRunner("user", "127.0.0.1", server.Options()...)
+		require.NoError(t, err)
+		defer runner.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		output, err := runner.Run(ctx, "sleep")
+		require.ErrorIs(t, err, sshx.ErrCommandTimeout)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.NotErrorIs(t, err, sshx.ErrCommandCanceled)
+		require.Equal(t, "partial", output)
+		require.Equal(t, []string{"TERM"}, server.Signals())
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		handler, started := blockingHandler(t)
+		server := sshxtest.New(t, sshxtest.WithHandler(handler))
+		runner, err := sshx.NewSshRunner("user", "127.0.0.1", server.Options()...)
+		require.NoError(t, err)
+		defer runner.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-started
+			cancel()
+		}()
+		err = runner.RunLog(ctx, "sleep", io.Discard, io.Discard)
+		require.ErrorIs(t, err, sshx.ErrCommandCanceled)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, []string{"TERM"}, server.Signals())
+
+		// canceled before start, the command is not run
+		_, err = runner.Run(ctx, "sleep")
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, []string{"TERM"}, server.Signals())
+	})
+
+	t.Run("kill after grace period", func(t *testing.T) {
+		handler, _ := blockingHandler(t)
+		server := sshxtest.New(t, sshxtest.WithHandler(handler), sshxtest.WithIgnoredSignals("TERM", "KILL"))
+		runner, err := sshx.NewSshRunner("user", "127.0.0.1", server.Options(sshx.WithKillGracePeriod(50*time.Millisecond))...)
+		require.NoError(t, err)
+		defer runner.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err = runner.Run(ctx, "sleep")
+		require.ErrorIs(t, err, sshx.ErrCommandTimeout)
+		require.Less(t, time.Since(start), time.Second)
+		require.Equal(t, []string{"TERM", "KILL"}, server.Signals())
+
+		// the connection is still usable
+		_, err = runner.Run(context.Background(), "exit 3")
+		var exitErr *sshx.ExitError
+		require.True(t, errors.As(err, &exitErr))
+	})
+}
@@ -0,0 +1,4 @@
+package sshx
+
+// PipeConns exposes pipeConns to the external tests, for their proxies.
+var PipeConns = pipeConns
@@ -0,0 +1,364 @@
+package sshx
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// socksHandshakeTimeout bounds the SOCKS5 handshake of a dynamic forwarding connection.
+const socksHandshakeTimeout = 10 * time.Second
+
+// Forward is a running port forwarding, created by SshRunner.ForwardLocal,
+// ForwardRemote or ForwardDynamic. It runs until its context is done or Close is called,
+// then stops accepting and closes the forwarded connections.
+//
+// Example:
+//
+//	fwd, err := runner.ForwardLocal(ctx, "127.0.0.1:0", "db.internal:5432")
+//	if err != nil {
+//	    return err
+//	}
+//	defer fwd.Close()
+//	db, err := sql.Open("postgres", "postgres://app@"+fwd.Addr().String()+"/app")
+type Forward struct {
+	listener net.Listener
+	// dial connects an accepted connection to the other side
+	dial func(ctx context.Context, conn net.Conn) (net.Conn, error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+	err    error
+
+	active atomic.Int64
+	total  atomic.Int64
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newForward(ctx context.Context, listener net.Listener, dial func(ctx context.Context, conn net.Conn) (net.Conn, error)) *Forward {
+	f := &Forward{
+		listener: listener,
+		dial:     dial,
+		done:     make(chan struct{}),
+		conns:    map[net.Conn]struct{}{},
+	}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	go f.serve()
+	return f
+}
+
+// Addr returns the address listened on: local for local and dynamic forwarding,
+// remote for remote forwarding. The port is the one chosen if listening on port 0.
+func (f *Forward) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// ActiveConns returns the number of connections being forwarded.
+func (f *Forward) ActiveConns() int64 {
+	return f.active.Load()
+}
+
+// TotalConns returns the number of connections forwarded since the start,
+// not counting the connections failed to dial.
+func (f *Forward) TotalConns() int64 {
+	return f.total.Load()
+}
+
+// Done is closed once the forwarding stopped and all its connections are closed.
+func (f *Forward) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the error stopping the forwarding once Done is closed, e.g. the SSH
+// connection of a remote forwarding dropped. It is nil if stopped by Close or the context.
+func (f *Forward) Err() error {
+	<-f.done
+	return f.err
+}
+
+// Close stops the forwarding, closes its connections and waits for them to end.
+func (f *Forward) Close() error {
+	f.cancel()
+	<-f.done
+	return nil
+}
+
+func (f *Forward) serve() {
+	defer close(f.done)
+	stop := context.AfterFunc(f.ctx, func() {
+		f.listener.Close()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for conn := range f.conns {
+			conn.Close()
+		}
+	})
+	defer stop()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			if f.ctx.Err() == nil {
+				f.err = err
+				log.Warnf(f.ctx, "ssh forward on %s stopped: %v", f.listener.Addr(), err)
+			}
+			f.cancel()
+			break
+		}
+		if !f.track(conn) {
+			conn.Close()
+			continue
+		}
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			f.handle(conn)
+		}()
+	}
+	f.wg.Wait()
+}
+
+func (f *Forward) handle(conn net.Conn) {
+	defer f.untrack(conn)
+	target, err := f.dial(f.ctx, conn)
+	if err != nil {
+		log.Warnf(f.ctx, "ssh forward from %s failed: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	if !f.track(target) {
+		conn.Close()
+		target.Close()
+		return
+	}
+	defer f.untrack(target)
+
+	f.total.Add(1)
+	f.active.Add(1)
+	defer f.active.Add(-1)
+	pipeConns(conn, target)
+}
+
+// track records the connection to close on stop. It returns false if already stopped.
+func (f *Forward) track(conn net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ctx.Err() != nil {
+		return false
+	}
+	f.conns[conn] = struct{}{}
+	return true
+}
+
+func (f *Forward) untrack(conn net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.conns, conn)
+}
+
+// pipeConns copies between a and b until both directions end, half-closing the writes
+// where supported, then closes both.
+func pipeConns(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyTo := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyTo(a, b)
+	go copyTo(b, a)
+	wg.Wait()
+	a.Close()
+	b.Close()
+}
+
+// ForwardLocal listens on the local address, and forwards each connection to the
+// remote address dialed by the SSH server, like `ssh -L`. The connection is
+// re-established if it dropped when a new connection is accepted.
+//
+// Example:
+//
+//	fwd, err := runner.ForwardLocal(ctx, "127.0.0.1:15432", "db.internal:5432")
+func (s *SshRunner) ForwardLocal(ctx context.Context, localAddr, remoteAddr string) (*Forward, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	return newForward(ctx, listener, func(ctx context.Context, conn net.Conn) (net.Conn, error) {
+		return s.dialRemote(ctx, remoteAddr)
+	}), nil
+}
+
+// ForwardRemote listens on the remote address of the SSH server, and forwards each
+// connection to the local address, like `ssh -R`. The remote port may be 0 to let
+// the server choose, see Forward.Addr. Whether other hosts may connect depends on
+// GatewayPorts of the server.
+//
+// The forwarding stops with an error, see Forward.Err, when the SSH connection drops.
+//
+// Example:
+//
+//	fwd, err := runner.ForwardRemote(ctx, "127.0.0.1:8080", "127.0.0.1:3000")
+func (s *SshRunner) ForwardRemote(ctx context.Context, remoteAddr, localAddr string) (*Forward, error) {
+	client, err := s.conn.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return nil, fmt.Errorf("sshx: remote listen on %s: %w", remoteAddr, err)
+	}
+	dialer := &net.Dialer{}
+	return newForward(ctx, listener, func(ctx context.Context, conn net.Conn) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", localAddr)
+	}), nil
+}
+
+// ForwardDynamic listens on the local address as a SOCKS5 proxy, and connects each
+// CONNECT request through the SSH server, like `ssh -D`. Authentication is not
+// supported, so listen on a loopback address.
+//
+// Example:
+//
+//	fwd, err := runner.ForwardDynamic(ctx, "127.0.0.1:1080")
+//	// curl --socks5-hostname 127.0.0.1:1080 http://intranet/
+func (s *SshRunner) ForwardDynamic(ctx context.Context, localAddr string) (*Forward, error) {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	return newForward(ctx, listener, func(ctx context.Context, conn net.Conn) (net.Conn, error) {
+		return s.socksConnect(ctx, conn)
+	}), nil
+}
+
+// dialRemote dials the address from the SSH server, reconnecting first if the connection dropped.
+func (s *SshRunner) dialRemote(ctx context.Context, addr string) (net.Conn, error) {
+	client, err := s.conn.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, "tcp", addr)
+}
+
+// SOCKS5 constants of RFC 1928.
+const (
+	socksVersion          = 5
+	socksNoAuth           = 0
+	socksNoAcceptable     = 0xff
+	socksConnect          = 1
+	socksAddrIPv4         = 1
+	socksAddrDomain       = 3
+	socksAddrIPv6         = 4
+	socksSucceeded        = 0
+	socksHostUnreachable  = 4
+	socksCmdNotSupported  = 7
+	socksAddrNotSupported = 8
+)
+
+var errSOCKSHandshake = errors.New("sshx: bad socks5 handshake")
+
+// socksConnect serves the SOCKS5 handshake of the connection, and dials the requested
+// address through the SSH server.
+func (s *SshRunner) socksConnect(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	// greeting: version, methods
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socksVersion {
+		return nil, fmt.Errorf("%w: version %d", errSOCKSHandshake, header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(methods, socksNoAuth) {
+		conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return nil, fmt.Errorf("%w: no acceptable auth method", errSOCKSHandshake)
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return nil, err
+	}
+
+	// request: version, command, reserved, address type, address, port
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, err
+	}
+	if request[0] != socksVersion {
+		return nil, fmt.Errorf("%w: version %d", errSOCKSHandshake, request[0])
+	}
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		ip := make([]byte, net.IPv4len)
+		if request[3] == socksAddrIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case socksAddrDomain:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return nil, err
+		}
+		domain := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return nil, err
+		}
+		host = string(domain)
+	default:
+		socksReply(conn, socksAddrNotSupported)
+		return nil, fmt.Errorf("%w: address type %d", errSOCKSHandshake, request[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+	if request[1] != socksConnect {
+		socksReply(conn, socksCmdNotSupported)
+		return nil, fmt.Errorf("%w: command %d not supported", errSOCKSHandshake, request[1])
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	target, err := s.dialRemote(ctx, addr)
+	if err != nil {
+		socksReply(conn, socksHostUnreachable)
+		return nil, fmt.Errorf("sshx: dial %s: %w", addr, err)
+	}
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+// socksReply replies the request with the bound address unspecified, as the
+// SSH server does not tell it.
+func socksReply(conn net.Conn, status byte) error {
+	_, err := conn.Write([]byte{socksVersion, status, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
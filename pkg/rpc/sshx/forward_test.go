@@ -0,0 +1,154 @@
+package sshx_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/proxy"
+)
+
+// newEchoServer serves a TCP echo server, returning its address.
+func newEchoServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// requireEcho sends a line over conn and requires it echoed back.
+func requireEcho(t *testing.T, conn net.Conn, line string) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.WriteString(conn, line+"\n")
+	require.NoError(t, err)
+	got, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, line+"\n", got)
+}
+
+func TestForwardLocal(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	runner := server.Runner()
+	echo := newEchoServer(t)
+
+	fwd, err := runner.ForwardLocal(context.Background(), "127.0.0.1:0", echo)
+	require.NoError(t, err)
+
+	conn1, err := net.Dial("tcp", fwd.Addr().String())
+	require.NoError(t, err)
+	requireEcho(t, conn1, "hello")
+	conn2, err := net.Dial("tcp", fwd.Addr().String())
+	require.NoError(t, err)
+	requireEcho(t, conn2, "world")
+	require.EqualValues(t, 2, fwd.ActiveConns())
+	require.EqualValues(t, 2, server.Forwards())
+
+	conn2.Close()
+	require.Eventually(t, func() bool { return fwd.ActiveConns() == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 2, fwd.TotalConns())
+
+	// Close ends the active connections
+	require.NoError(t, fwd.Close())
+	require.NoError(t, fwd.Err())
+	require.EqualValues(t, 0, fwd.ActiveConns())
+	conn1.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn1.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+	_, err = net.Dial("tcp", fwd.Addr().String())
+	require.Error(t, err)
+}
+
+func TestForwardLocalContext(t *testing.T) {
+	runner := sshxtest.New(t, sshxtest.WithHandler(echoHandler)).Runner()
+	ctx, cancel := context.WithCancel(context.Background())
+	fwd, err := runner.ForwardLocal(ctx, "127.0.0.1:0", newEchoServer(t))
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", fwd.Addr().String())
+	require.NoError(t, err)
+	requireEcho(t, conn, "hello")
+
+	cancel()
+	select {
+	case <-fwd.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("forward not stopped by the context")
+	}
+	require.NoError(t, fwd.Err())
+}
+
+func TestForwardRemote(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	runner := server.Runner()
+	echo := newEchoServer(t)
+
+	fwd, err := runner.ForwardRemote(context.Background(), "127.0.0.1:0", echo)
+	require.NoError(t, err)
+	defer fwd.Close()
+	require.NotZero(t, fwd.Addr().(*net.TCPAddr).Port)
+
+	conn, err := net.Dial("tcp", fwd.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	requireEcho(t, conn, "hello")
+	require.EqualValues(t, 1, fwd.ActiveConns())
+	require.EqualValues(t, 1, fwd.TotalConns())
+
+	// the forwarding stops with an error once the connection drops
+	server.CloseConnections()
+	select {
+	case <-fwd.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("forward not stopped by the dropped connection")
+	}
+	require.Error(t, fwd.Err())
+}
+
+func TestForwardDynamic(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	runner := server.Runner()
+	echo := newEchoServer(t)
+	_, echoPort, err := net.SplitHostPort(echo)
+	require.NoError(t, err)
+
+	fwd, err := runner.ForwardDynamic(context.Background(), "127.0.0.1:0")
+	require.NoError(t, err)
+	defer fwd.Close()
+
+	socks, err := proxy.SOCKS5("tcp", fwd.Addr().String(), nil, proxy.Direct)
+	require.NoError(t, err)
+	for _, addr := range []string{echo, net.JoinHostPort("localhost", echoPort)} {
+		conn, err := socks.Dial("tcp", addr)
+		require.NoError(t, err, addr)
+		requireEcho(t, conn, "hello "+addr)
+		conn.Close()
+	}
+	require.EqualValues(t, 2, fwd.TotalConns())
+	require.EqualValues(t, 2, server.Forwards())
+
+	// a port not listened on is reported as unreachable
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed.Close()
+	_, err = socks.Dial("tcp", closed.Addr().String())
+	require.Error(t, err)
+	require.EqualValues(t, 2, fwd.TotalConns())
+}
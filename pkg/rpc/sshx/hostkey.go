@@ -0,0 +1,321 @@
+package sshx
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrUnknownHost is returned when the host is not in the known_hosts files.
+var ErrUnknownHost = errors.New("sshx: unknown host")
+
+// HostKeyMismatchError is returned when the host presents a key other than the
+// expected ones, which may be a man-in-the-middle attack or a reinstalled host.
+type HostKeyMismatchError struct {
+	Host string
+	// Presented is the SHA256 fingerprint of the key presented by the host.
+	Presented string
+	// Expected are the SHA256 fingerprints of the keys expected, with their
+	// known_hosts file and line if from known_hosts.
+	Expected []string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("sshx: host key mismatch for %s: presented %s, expected %s",
+		e.Host, e.Presented, strings.Join(e.Expected, " or "))
+}
+
+// WithHostKeyCallback sets a custom host key verification.
+func WithHostKeyCallback(callback ssh.HostKeyCallback) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		c.hostKeyCallback = callback
+		c.hostKeyAlgorithms = nil
+		return nil
+	}
+}
+
+// WithInsecureIgnoreHostKey accepts any host key, which is the default for
+// compatibility but allows man-in-the-middle attacks. Only use it for tests.
+func WithInsecureIgnoreHostKey() SSHClientOption {
+	return WithHostKeyCallback(ssh.InsecureIgnoreHostKey())
+}
+
+// WithKnownHosts verifies the host key by OpenSSH known_hosts files, including
+// hashed host names, @cert-authority and @revoked markers.
+// If no file is given, ~/.ssh/known_hosts is used.
+//
+// Unknown hosts fail with ErrUnknownHost, and mismatched keys with *HostKeyMismatchError.
+// Only the key types of the lines matching a known host are negotiated, so that a
+// host with several host keys presents a known one, like OpenSSH.
+//
+// Example:
+//
+//	runner, err := NewSshRunner("user", "example.com", WithKnownHosts())
+func WithKnownHosts(files ...string) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		if len(files) == 0 {
+			file, err := defaultKnownHostsFile()
+			if err != nil {
+				return err
+			}
+			files = []string{file}
+		}
+		callback, err := knownhosts.New(files...)
+		if err != nil {
+			return err
+		}
+		c.hostKeyCallback = wrapKnownHostsError(callback)
+		c.hostKeyAlgorithms = func(addr string) []string {
+			return knownHostAlgorithms(files, addr)
+		}
+		return nil
+	}
+}
+
+// WithHostKeyFingerprints pins the host key to the SHA256 fingerprints,
+// as printed by `ssh-keygen -lf`, e.g. "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8".
+// Keys of other fingerprints fail with *HostKeyMismatchError.
+func WithHostKeyFingerprints(fingerprints ...string) SSHClientOption {
+	return WithHostKeyCallback(func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		presented := ssh.FingerprintSHA256(key)
+		for _, fp := range fingerprints {
+			if fp == presented {
+				return nil
+			}
+		}
+		return &HostKeyMismatchError{
+			Host:      hostname,
+			Presented: presented,
+			Expected:  fingerprints,
+		}
+	})
+}
+
+// WithTrustOnFirstUse verifies the host key by the known_hosts file like WithKnownHosts,
+// but accepts the key of an unknown host and appends it to the file, like
+// StrictHostKeyChecking=accept-new of OpenSSH. The host name is hashed if hashHosts.
+// If file is empty, ~/.ssh/known_hosts is used. The file is created if missing.
+//
+// Example:
+//
+//	runner, err := NewSshRunner("user", "example.com", WithTrustOnFirstUse("", true))
+func WithTrustOnFirstUse(file string, hashHosts bool) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		if file == "" {
+			var err error
+			file, err = defaultKnownHostsFile()
+			if err != nil {
+				return err
+			}
+		}
+		c.hostKeyCallback = (&tofuCallback{file: file, hashHosts: hashHosts}).check
+		c.hostKeyAlgorithms = nil
+		return nil
+	}
+}
+
+func defaultKnownHostsFile() (string, error) {
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ".ssh", "known_hosts"), nil
+}
+
+// wrapKnownHostsError converts the errors of knownhosts to the errors of sshx.
+func wrapKnownHostsError(callback ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) == 0 {
+			return fmt.Errorf("%w: %s (%s %s)", ErrUnknownHost, hostname, key.Type(), ssh.FingerprintSHA256(key))
+		}
+		mismatch := &HostKeyMismatchError{
+			Host:      hostname,
+			Presented: ssh.FingerprintSHA256(key),
+		}
+		for _, want := range keyErr.Want {
+			mismatch.Expected = append(mismatch.Expected,
+				fmt.Sprintf("%s (%s:%d)", ssh.FingerprintSHA256(want.Key), want.Filename, want.Line))
+		}
+		return mismatch
+	}
+}
+
+// certAlgorithms are the host certificate algorithms, negotiated for a host matched
+// by a @cert-authority line, as the key type of its certificate is not known.
+var certAlgorithms = []string{
+	ssh.CertAlgoED25519v01, ssh.CertAlgoSKED25519v01,
+	ssh.CertAlgoECDSA256v01, ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoSKECDSA256v01,
+	ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01,
+}
+
+// knownHostAlgorithms returns the host key algorithms of the known_hosts lines matching
+// the address, the certificate ones first, or nil if none matches or a file is unreadable.
+func knownHostAlgorithms(files []string, addr string) []string {
+	var certs, keys []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil
+		}
+		for len(data) > 0 {
+			marker, hosts, key, _, rest, err := ssh.ParseKnownHosts(data)
+			if err != nil {
+				// io.EOF after the last line, or a bad line rejected by knownhosts.New
+				break
+			}
+			data = rest
+			if marker == "revoked" || !matchKnownHosts(hosts, addr) {
+				continue
+			}
+			if marker == "cert-authority" {
+				certs = certAlgorithms
+				continue
+			}
+			for _, algo := range keyAlgorithms(key.Type()) {
+				if !slices.Contains(keys, algo) {
+					keys = append(keys, algo)
+				}
+			}
+		}
+	}
+	if len(certs)+len(keys) == 0 {
+		return nil
+	}
+	return append(slices.Clone(certs), keys...)
+}
+
+// keyAlgorithms returns the signature algorithms of a key type.
+func keyAlgorithms(keyType string) []string {
+	if keyType == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{keyType}
+}
+
+// matchKnownHosts reports whether the host patterns of a known_hosts line match
+// the address "host:port", by the rules of knownhosts: a negated pattern "!pattern"
+// matching excludes the address, patterns without a port only match port 22,
+// and hashed patterns match the normalized address.
+func matchKnownHosts(patterns []string, addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	normalized := knownhosts.Normalize(addr)
+	matched := false
+	for _, pattern := range patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		var ok bool
+		if strings.HasPrefix(pattern, "|") {
+			ok = matchHashedHost(pattern, normalized)
+		} else {
+			patternHost, patternPort := pattern, "22"
+			if h, p, err := net.SplitHostPort(pattern); err == nil && strings.HasPrefix(pattern, "[") {
+				patternHost, patternPort = h, p
+			}
+			ok = patternPort == port && matchWildcard(patternHost, host)
+		}
+		switch {
+		case ok && negated:
+			return false
+		case ok:
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchHashedHost matches a hashed host "|1|salt|hash" of known_hosts.
+func matchHashedHost(pattern, host string) bool {
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+// matchWildcard matches s by the pattern of "*" and "?" wildcards.
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == '*' {
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(s) == 0 || (pattern[0] != '?' && pattern[0] != s[0]) {
+			return false
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
+
+// tofuCallback reads the known_hosts file on every check,
+// so that the hosts appended are known to the later connections.
+type tofuCallback struct {
+	file      string
+	hashHosts bool
+	mu        sync.Mutex
+}
+
+func (t *tofuCallback) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(t.file), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(t.file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	callback, err := knownhosts.New(t.file)
+	if err != nil {
+		return err
+	}
+	err = wrapKnownHostsError(callback)(hostname, remote, key)
+	if !errors.Is(err, ErrUnknownHost) {
+		return err
+	}
+
+	host := knownhosts.Normalize(hostname)
+	if t.hashHosts {
+		host = knownhosts.HashHostname(host)
+	}
+	log.Infof(context.Background(), "ssh trust on first use, adding %s %s to %s", hostname, ssh.FingerprintSHA256(key), t.file)
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{host}, key))
+	return err
+}
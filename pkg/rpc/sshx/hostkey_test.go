@@ -0,0 +1,178 @@
+package sshx_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func writeKnownHosts(t *testing.T, lines ...string) string {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+	return file
+}
+
+func TestKnownHosts(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	other := sshxtest.NewSigner(t)
+
+	tests := []struct {
+		name    string
+		line    string
+		wantErr error
+	}{
+		{"plain", knownhosts.Line([]string{server.Addr()}, sshxtest.HostKey.PublicKey()), nil},
+		{"hashed", knownhosts.HashHostname(knownhosts.Normalize(server.Addr())) + " " + string(ssh.MarshalAuthorizedKey(sshxtest.HostKey.PublicKey())), nil},
+		{"unknown", knownhosts.Line([]string{"example.com"}, sshxtest.HostKey.PublicKey()), sshx.ErrUnknownHost},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeKnownHosts(t, tt.line)
+			_, err := sshx.MakeSSHClient("user", "127.0.0.1", server.Options(sshx.WithKnownHosts(file))...)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("mismatch", func(t *testing.T) {
+		file := writeKnownHosts(t, knownhosts.Line([]string{server.Addr()}, other.PublicKey()))
+		_, err := sshx.MakeSSHClient("user", "127.0.0.1", server.Options(sshx.WithKnownHosts(file))...)
+		var mismatch *sshx.HostKeyMismatchError
+		require.ErrorAs(t, err, &mismatch)
+		require.Equal(t, ssh.FingerprintSHA256(sshxtest.HostKey.PublicKey()), mismatch.Presented)
+		require.Len(t, mismatch.Expected, 1)
+		require.Contains(t, mismatch.Expected[0], ssh.FingerprintSHA256(other.PublicKey()))
+		require.Contains(t, mismatch.Expected[0], file+":1")
+	})
+}
+
+func TestKnownHostsCertAuthority(t *testing.T) {
+	ca := sshxtest.NewSigner(t)
+	hostKey := sshxtest.NewSigner(t)
+	cert := &ssh.Certificate{
+		Key:             hostKey.PublicKey(),
+		CertType:        ssh.HostCert,
+		KeyId:           "host",
+		ValidPrincipals: []string{"127.0.0.1"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	certSigner, err := ssh.NewCertSigner(cert, hostKey)
+	require.NoError(t, err)
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithHostKey(certSigner))
+
+	// a wildcard pattern only matches port 22 unless the port is given
+	pattern := fmt.Sprintf("[*]:%d", server.Port())
+	file := writeKnownHosts(t, "@cert-authority "+pattern+" "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(ca.PublicKey()))))
+	client, err := sshx.MakeSSHClient("user", "127.0.0.1", server.Options(sshx.WithKnownHosts(file))...)
+	require.NoError(t, err)
+	client.Close()
+
+	file = writeKnownHosts(t, "@cert-authority "+pattern+" "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshxtest.NewSigner(t).PublicKey()))))
+	_, err = sshx.MakeSSHClient("user", "127.0.0.1", server.Options(sshx.WithKnownHosts(file))...)
+	require.Error(t, err)
+}
+
+func TestKnownHostsSeveralHostKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecdsaKey, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	ca := sshxtest.NewSigner(t)
+	cert := &ssh.Certificate{
+		Key:             sshxtest.HostKey.PublicKey(),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: []string{"127.0.0.1"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	certSigner, err := ssh.NewCertSigner(cert, sshxtest.HostKey)
+	require.NoError(t, err)
+
+	// the client prefers an ecdsa key to an ed25519 one, and a certificate to both
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithServerConfig(func(config *ssh.ServerConfig) {
+		config.AddHostKey(ecdsaKey)
+	}))
+	certServer := sshxtest.New(t, sshxtest.WithHandler(echoHandler), sshxtest.WithHostKey(ecdsaKey), sshxtest.WithServerConfig(func(config *ssh.ServerConfig) {
+		config.AddHostKey(certSigner)
+	}))
+	tests := []struct {
+		name   string
+		server *sshxtest.Server
+		line   string
+	}{
+		{"ed25519", server, knownhosts.Line([]string{server.Addr()}, sshxtest.HostKey.PublicKey())},
+		{"ecdsa", server, knownhosts.Line([]string{server.Addr()}, ecdsaKey.PublicKey())},
+		{"hashed", server, knownhosts.HashHostname(knownhosts.Normalize(server.Addr())) + " " + string(ssh.MarshalAuthorizedKey(sshxtest.HostKey.PublicKey()))},
+		{"plain key of a certified host", certServer, knownhosts.Line([]string{certServer.Addr()}, ecdsaKey.PublicKey())},
+		{"cert authority", certServer, fmt.Sprintf("@cert-authority [127.0.0.1]:%d %s", certServer.Port(), ssh.MarshalAuthorizedKey(ca.PublicKey()))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the other lines do not match the host
+			file := writeKnownHosts(t,
+				knownhosts.Line([]string{"example.com"}, ecdsaKey.PublicKey()),
+				"!"+knownhosts.Line([]string{tt.server.Addr(), tt.server.Addr()}, sshxtest.NewSigner(t).PublicKey()),
+				strings.TrimSpace(tt.line))
+			client, err := sshx.MakeSSHClient("user", "127.0.0.1", tt.server.Options(sshx.WithKnownHosts(file))...)
+			require.NoError(t, err)
+			client.Close()
+		})
+	}
+}
+
+func TestHostKeyFingerprints(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+
+	client, err := sshx.MakeSSHClient("user", "127.0.0.1", server.Options(
+		sshx.WithHostKeyFingerprints("SHA256:other", ssh.FingerprintSHA256(sshxtest.HostKey.PublicKey())))...)
+	require.NoError(t, err)
+	client.Close()
+
+	_, err = sshx.MakeSSHClient("user", "127.0.0.1", server.Options(sshx.WithHostKeyFingerprints("SHA256:other"))...)
+	var mismatch *sshx.HostKeyMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	require.Equal(t, []string{"SHA256:other"}, mismatch.Expected)
+	require.Contains(t, err.Error(), ssh.FingerprintSHA256(sshxtest.HostKey.PublicKey()))
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	file := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+
+	for i := 0; i < 2; i++ {
+		runner, err := sshx.NewSshRunner("user", "127.0.0.1", server.Options(sshx.WithTrustOnFirstUse(file, true))...)
+		require.NoError(t, err)
+		_, err = runner.Run(context.Background(), "ok")
+		require.NoError(t, err)
+		runner.Close()
+	}
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(content), "\n"), "the host should be added once")
+	require.True(t, strings.HasPrefix(string(content), "|1|"), "the host should be hashed")
+
+	// a changed key of a known host is rejected, not trusted again
+	file = writeKnownHosts(t, knownhosts.Line([]string{server.Addr()}, sshxtest.NewSigner(t).PublicKey()))
+	_, err = sshx.MakeSSHClient("user", "127.0.0.1", server.Options(sshx.WithTrustOnFirstUse(file, false))...)
+	var mismatch *sshx.HostKeyMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	after, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, 1, strings.Count(string(after), "\n"))
+}
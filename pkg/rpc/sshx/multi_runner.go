@@ -0,0 +1,322 @@
+package sshx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/coroutine/syncx"
+)
+
+const defaultConcurrency = 10
+
+// ErrHostSkipped is the error of the hosts not run, as a host failed in fail-fast mode
+// or the context is done.
+var ErrHostSkipped = errors.New("sshx: host skipped")
+
+// HostResult is the result of a host of MultiRunner.
+type HostResult struct {
+	Host   string
+	Stdout string
+	Stderr string
+	// ExitCode is the exit status of the command, or -1 if it did not exit,
+	// e.g. the connection failed or the host is skipped.
+	ExitCode int
+	Duration time.Duration
+	Err      error
+}
+
+// HostResults are the results of all the hosts, in the order of the hosts.
+type HostResults []HostResult
+
+// Failed returns the results with an error.
+func (r HostResults) Failed() HostResults {
+	var failed HostResults
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err joins the errors of the hosts, prefixed by the host. It is nil if all hosts succeed.
+func (r HostResults) Err() error {
+	var errs []error
+	for _, result := range r {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", result.Host, result.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type multiRunnerConfig struct {
+	concurrency int
+	failFast    bool
+	stdout      io.Writer
+	stderr      io.Writer
+	sshOpts     []SSHClientOption
+}
+
+// MultiRunnerOption configures a MultiRunner.
+type MultiRunnerOption func(*multiRunnerConfig)
+
+// WithConcurrency limits the hosts run at the same time. The default is 10.
+func WithConcurrency(n int) MultiRunnerOption {
+	return func(c *multiRunnerConfig) {
+		c.concurrency = n
+	}
+}
+
+// WithFailFast stops at the first failed host: the hosts running are canceled,
+// and the hosts not started are skipped with ErrHostSkipped.
+// By default all the hosts are run whatever the others fail.
+func WithFailFast() MultiRunnerOption {
+	return func(c *multiRunnerConfig) {
+		c.failFast = true
+	}
+}
+
+// WithOutput streams the output of all the hosts to stdout and stderr as they run,
+// each line prefixed by "[host] ". Lines of different hosts are not mixed.
+func WithOutput(stdout, stderr io.Writer) MultiRunnerOption {
+	return func(c *multiRunnerConfig) {
+		c.stdout = stdout
+		c.stderr = stderr
+	}
+}
+
+// WithSSHOptions sets the options to connect to the hosts.
+func WithSSHOptions(opts ...SSHClientOption) MultiRunnerOption {
+	return func(c *multiRunnerConfig) {
+		c.sshOpts = append(c.sshOpts, opts...)
+	}
+}
+
+// MultiRunner runs the same work on many hosts in parallel.
+// Connections are kept in a Pool between runs, until Close.
+//
+// Example:
+//
+//	mr := NewMultiRunner("deploy", []string{"web1", "web2:2222", "web3"},
+//	    WithConcurrency(5),
+//	    WithOutput(os.Stdout, os.Stderr),
+//	    WithSSHOptions(WithKnownHosts(), WithAgent()),
+//	)
+//	defer mr.Close()
+//	results, err := mr.Run(ctx, "systemctl restart app")
+//	for _, r := range results.Failed() {
+//	    fmt.Printf("%s: exit %d: %v\n", r.Host, r.ExitCode, r.Err)
+//	}
+type MultiRunner struct {
+	user  string
+	hosts []string
+	cfg   *multiRunnerConfig
+	pool  *Pool
+}
+
+// NewMultiRunner creates a runner of the hosts, each "host" or "host:port", connected as user.
+func NewMultiRunner(user string, hosts []string, opts ...MultiRunnerOption) *MultiRunner {
+	cfg := &multiRunnerConfig{concurrency: defaultConcurrency}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.concurrency <= 0 {
+		cfg.concurrency = len(hosts)
+	}
+	return &MultiRunner{
+		user:  user,
+		hosts: hosts,
+		cfg:   cfg,
+		pool:  NewPool(cfg.sshOpts...),
+	}
+}
+
+// Close closes the connections to all the hosts.
+func (m *MultiRunner) Close() error {
+	return m.pool.Close()
+}
+
+// Run runs the command on all the hosts, see SshRunner.RunLog.
+// The error joins the errors of the hosts, see HostResults.Err.
+func (m *MultiRunner) Run(ctx context.Context, cmd string) (HostResults, error) {
+	return m.Do(ctx, func(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer) error {
+		return runner.RunLog(ctx, cmd, stdout, stderr)
+	})
+}
+
+// RunCommand runs the built command on all the hosts, see SshRunner.RunCommandLog.
+// The stdin of the command, if any, must not be shared by the hosts, so use Do instead.
+func (m *MultiRunner) RunCommand(ctx context.Context, cmd *Command) (HostResults, error) {
+	return m.Do(ctx, func(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer) error {
+		return runner.RunCommandLog(ctx, cmd, stdout, stderr)
+	})
+}
+
+// Upload uploads the data to the remote path of all the hosts, see SshRunner.Upload.
+func (m *MultiRunner) Upload(ctx context.Context, remotePath string, data []byte, opts ...TransferOption) (HostResults, error) {
+	return m.Do(ctx, func(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer) error {
+		return runner.Upload(ctx, remotePath, bytes.NewReader(data), opts...)
+	})
+}
+
+// UploadFrom uploads the local file to the remote path of all the hosts, see SshRunner.UploadFrom.
+func (m *MultiRunner) UploadFrom(ctx context.Context, localPath, remotePath string, opts ...TransferOption) (HostResults, error) {
+	return m.Do(ctx, func(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer) error {
+		return runner.UploadFrom(ctx, localPath, remotePath, opts...)
+	})
+}
+
+// Do runs f for all the hosts in parallel, with the runner of the host, and the
+// writers collected into the result and streamed by WithOutput.
+// The error joins the errors of the hosts, see HostResults.Err. A panic in f is
+// recovered as the *syncx.PanicError of the host.
+func (m *MultiRunner) Do(ctx context.Context, f func(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer) error) (HostResults, error) {
+	results := make(HostResults, len(m.hosts))
+	for i, host := range m.hosts {
+		results[i] = HostResult{Host: host, ExitCode: -1, Err: ErrHostSkipped}
+	}
+	var outMu sync.Mutex // keeps the lines of the hosts from mixing
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wg := syncx.WG(ctx)
+	slots := make(chan struct{}, m.cfg.concurrency)
+
+loop:
+	for i, host := range m.hosts {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		wg.Go(func(ctx context.Context) {
+			defer func() { <-slots }()
+			if ctx.Err() != nil {
+				return // skipped
+			}
+			result := m.runHost(ctx, host, &outMu, f)
+			results[i] = result
+			if result.Err != nil && m.cfg.failFast {
+				cancel()
+			}
+		})
+	}
+	wg.Wait()
+	return results, results.Err()
+}
+
+func (m *MultiRunner) runHost(ctx context.Context, host string, outMu *sync.Mutex, f func(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer) error) HostResult {
+	start := time.Now()
+	result := HostResult{Host: host, ExitCode: -1}
+	var stdout, stderr bytes.Buffer
+	var outW, errW io.Writer = &stdout, &stderr
+	var prefixed []*prefixWriter
+	if m.cfg.stdout != nil {
+		p := &prefixWriter{w: m.cfg.stdout, mu: outMu, prefix: "[" + host + "] "}
+		prefixed = append(prefixed, p)
+		outW = io.MultiWriter(outW, p)
+	}
+	if m.cfg.stderr != nil {
+		p := &prefixWriter{w: m.cfg.stderr, mu: outMu, prefix: "[" + host + "] "}
+		prefixed = append(prefixed, p)
+		errW = io.MultiWriter(errW, p)
+	}
+
+	runner, err := m.runner(ctx, host)
+	if err == nil {
+		err = callHost(ctx, host, runner, outW, errW, f)
+	}
+	for _, p := range prefixed {
+		p.Flush()
+	}
+
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Duration = time.Since(start)
+	result.Err = err
+	var exitErr *ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode
+	}
+	return result
+}
+
+// callHost calls f, recovering a panic as a *syncx.PanicError.
+func callHost(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer, f func(ctx context.Context, host string, runner *SshRunner, stdout, stderr io.Writer) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = syncx.NewPanicError(r)
+		}
+	}()
+	return f(ctx, host, runner, stdout, stderr)
+}
+
+// runner returns the pooled runner of "host" or "host:port".
+func (m *MultiRunner) runner(ctx context.Context, host string) (*SshRunner, error) {
+	var opts []SSHClientOption
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("sshx: invalid port of %s: %w", host, err)
+		}
+		host = h
+		opts = append(opts, WithPort(port))
+	}
+	return m.pool.Runner(ctx, m.user, host, opts...)
+}
+
+// prefixWriter writes the complete lines to w, each prefixed, under mu.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte // the incomplete line
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	end := bytes.LastIndexByte(p.buf, '\n')
+	if end < 0 {
+		return len(b), nil
+	}
+	if err := p.writeLines(p.buf[:end+1]); err != nil {
+		return 0, err
+	}
+	p.buf = append(p.buf[:0], p.buf[end+1:]...)
+	return len(b), nil
+}
+
+// Flush writes the incomplete line, ending it by a newline.
+func (p *prefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLines(append(p.buf, '\n'))
+	p.buf = p.buf[:0]
+	return err
+}
+
+func (p *prefixWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, '\n')
+		out.WriteString(p.prefix)
+		out.Write(lines[:i+1])
+		lines = lines[i+1:]
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,189 @@
+package sshx_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/coroutine/syncx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMultiRunner(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	handler := func(ctx context.Context, req *sshxtest.Request) int {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			max := maxRunning.Load()
+			if n <= max || maxRunning.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(req.Stdout, "line 1\nline ")
+		io.WriteString(req.Stdout, "2\npartial")
+		if req.Command == "fail" {
+			io.WriteString(req.Stderr, "oops\n")
+			return 2
+		}
+		return 0
+	}
+	var hosts []string
+	for i := 0; i < 5; i++ {
+		hosts = append(hosts, sshxtest.New(t, sshxtest.WithHandler(handler)).Addr())
+	}
+
+	var stdout, stderr syncBuffer
+	mr := sshx.NewMultiRunner("user", hosts,
+		sshx.WithConcurrency(2),
+		sshx.WithOutput(&stdout, &stderr),
+		sshx.WithSSHOptions(sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM)),
+	)
+	defer mr.Close()
+
+	results, err := mr.Run(context.Background(), "ok")
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+	require.EqualValues(t, 2, maxRunning.Load())
+	for i, result := range results {
+		require.Equal(t, hosts[i], result.Host)
+		require.Equal(t, "line 1\nline 2\npartial", result.Stdout)
+		require.Equal(t, 0, result.ExitCode)
+		require.NoError(t, result.Err)
+		require.Greater(t, result.Duration, time.Duration(0))
+		require.Contains(t, stdout.String(), fmt.Sprintf("[%s] line 1\n[%s] line 2\n", hosts[i], hosts[i]))
+		require.Contains(t, stdout.String(), fmt.Sprintf("[%s] partial\n", hosts[i]))
+	}
+
+	// continue on error by default
+	results, err = mr.Run(context.Background(), "fail")
+	require.Error(t, err)
+	require.Len(t, results.Failed(), 5)
+	for _, result := range results {
+		require.Equal(t, 2, result.ExitCode)
+		require.Equal(t, "oops\n", result.Stderr)
+		require.Contains(t, err.Error(), result.Host)
+	}
+	require.Contains(t, stderr.String(), "["+hosts[0]+"] oops\n")
+}
+
+func TestMultiRunnerFailFast(t *testing.T) {
+	var hosts []string
+	var runs atomic.Int32
+	for i := 0; i < 4; i++ {
+		status := 0
+		if i == 0 {
+			status = 1
+		}
+		hosts = append(hosts, sshxtest.New(t, sshxtest.WithHandler(func(ctx context.Context, req *sshxtest.Request) int {
+			runs.Add(1)
+			return status
+		})).Addr())
+	}
+	hosts = append(hosts, "127.0.0.1:1") // never run
+
+	mr := sshx.NewMultiRunner("user", hosts, sshx.WithConcurrency(1), sshx.WithFailFast(),
+		sshx.WithSSHOptions(sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM)))
+	defer mr.Close()
+	results, err := mr.Run(context.Background(), "true")
+	require.Error(t, err)
+	require.EqualValues(t, 1, runs.Load())
+	require.Equal(t, 1, results[0].ExitCode)
+	for _, result := range results[1:] {
+		require.ErrorIs(t, result.Err, sshx.ErrHostSkipped)
+		require.Equal(t, -1, result.ExitCode)
+	}
+	require.True(t, strings.HasPrefix(err.Error(), hosts[0]+": "))
+}
+
+func TestMultiRunnerUpload(t *testing.T) {
+	dir := t.TempDir()
+	hosts := []string{
+		sshxtest.New(t, sshxtest.WithSFTP()).Addr(),
+		sshxtest.New(t).Addr(),
+	}
+	mr := sshx.NewMultiRunner("user", hosts, sshx.WithSSHOptions(sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM)))
+	defer mr.Close()
+
+	results, err := mr.Do(context.Background(), func(ctx context.Context, host string, runner *sshx.SshRunner, stdout, stderr io.Writer) error {
+		file := dir + "/" + strings.ReplaceAll(host, ":", "_")
+		if err := runner.Upload(ctx, file, strings.NewReader(host)); err != nil {
+			return err
+		}
+		return runner.RunLog(ctx, "cat "+sshx.ShellQuote(file), stdout, stderr)
+	})
+	require.NoError(t, err)
+	for i, result := range results {
+		require.Equal(t, hosts[i], result.Stdout)
+	}
+
+	// the hosts share the file system, so upload atomically
+	_, err = mr.Upload(context.Background(), dir+"/same", []byte("data"), sshx.WithAtomicUpload(), sshx.WithChecksum())
+	require.NoError(t, err)
+}
+
+func TestMultiRunnerDoFailures(t *testing.T) {
+	// a host accepting connections without ever answering the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	server := sshxtest.New(t, sshxtest.WithHandler(echoHandler))
+	hosts := []string{server.Addr(), listener.Addr().String()}
+	mr := sshx.NewMultiRunner("user", hosts, sshx.WithSSHOptions(sshx.WithPrivateKeyBytes(sshxtest.ClientKeyPEM)))
+	defer mr.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results, err := mr.Do(ctx, func(ctx context.Context, host string, runner *sshx.SshRunner, stdout, stderr io.Writer) error {
+		panic("boom")
+	})
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 5*time.Second, "the dial honors the context")
+
+	var panicErr *syncx.PanicError
+	require.ErrorAs(t, results[0].Err, &panicErr)
+	require.Equal(t, "boom", panicErr.Value)
+	require.NotEmpty(t, panicErr.Stack)
+	require.ErrorIs(t, results[1].Err, context.DeadlineExceeded)
+}
@@ -0,0 +1,165 @@
+package sshx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Pool keeps one managed connection per user@host:port, shared by all the
+// runners of the same target, so that concurrent sessions to a host are capped
+// by one connection's WithMaxSessions. It is safe for concurrent use.
+//
+// Example:
+//
+//	pool := NewPool(WithDefaultAuth(), WithMaxSessions(5))
+//	defer pool.Close()
+//	for _, host := range hosts {
+//	    runner, err := pool.Runner(ctx, "deploy", host)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    output, err := runner.Run(ctx, "uptime")
+//	}
+type Pool struct {
+	opts []SSHClientOption
+
+	// ctx is the context of the dials, canceled by Close, so that a dial shared
+	// by several users does not depend on the context of the first one
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	conns  map[string]*poolEntry
+	closed bool
+}
+
+// poolEntry is ready once the connection is dialed, so that a target
+// is only dialed once, without blocking the other targets.
+type poolEntry struct {
+	ready chan struct{}
+	conn  *Conn
+	err   error
+}
+
+// NewPool creates a pool whose connections are dialed with opts,
+// before the options given to Get.
+func NewPool(opts ...SSHClientOption) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pool{
+		opts:   opts,
+		ctx:    ctx,
+		cancel: cancel,
+		conns:  map[string]*poolEntry{},
+	}
+}
+
+// Get returns the connection of user@host:port, dialing it if not in the pool yet.
+// opts only take effect when the connection is dialed. Get returns ctx.Err() once
+// ctx is done, while the dial goes on for the other users of the connection.
+func (p *Pool) Get(ctx context.Context, user, host string, opts ...SSHClientOption) (*Conn, error) {
+	opts = append(append([]SSHClientOption{}, p.opts...), opts...)
+	cfg, err := newSSHClientConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	_, _, port := cfg.target(user, host)
+	key := poolKey(user, host, port)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrConnClosed
+	}
+	entry, ok := p.conns[key]
+	if !ok {
+		entry = &poolEntry{ready: make(chan struct{})}
+		p.conns[key] = entry
+		go p.dial(key, entry, user, host, opts)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.conn, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dial dials the connection of the entry under the context of the pool.
+func (p *Pool) dial(key string, entry *poolEntry, user, host string, opts []SSHClientOption) {
+	entry.conn, entry.err = dialConn(p.ctx, user, host, opts...)
+
+	p.mu.Lock()
+	switch {
+	case p.closed:
+		if entry.err == nil {
+			entry.conn.Close()
+		}
+		entry.conn, entry.err = nil, ErrConnClosed
+	case entry.err != nil:
+		// do not cache the failure, the next Get dials again
+		if p.conns[key] == entry {
+			delete(p.conns, key)
+		}
+	}
+	p.mu.Unlock()
+	close(entry.ready)
+}
+
+// Runner returns an SshRunner over the pooled connection of user@host:port.
+// Closing the runner closes the pooled connection, so use Pool.Remove or
+// Pool.Close instead.
+func (p *Pool) Runner(ctx context.Context, user, host string, opts ...SSHClientOption) (*SshRunner, error) {
+	conn, err := p.Get(ctx, user, host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewSshRunnerWithConn(conn), nil
+}
+
+// Remove closes and removes the connection of user@host:port, if any.
+func (p *Pool) Remove(user, host string, port int) error {
+	key := poolKey(user, host, port)
+	p.mu.Lock()
+	entry, ok := p.conns[key]
+	delete(p.conns, key)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	<-entry.ready
+	if entry.conn == nil {
+		return nil
+	}
+	return entry.conn.Close()
+}
+
+// Close closes all the connections in the pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	entries := p.conns
+	p.conns = map[string]*poolEntry{}
+	p.closed = true
+	p.mu.Unlock()
+	p.cancel()
+
+	var errs []error
+	for _, entry := range entries {
+		select {
+		case <-entry.ready:
+			if entry.conn != nil {
+				errs = append(errs, entry.conn.Close())
+			}
+		default:
+			// still dialing, the dial is canceled and closed as the pool is closed
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func poolKey(user, host string, port int) string {
+	return fmt.Sprintf("%s@%s:%d", user, host, port)
+}
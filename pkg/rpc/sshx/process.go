@@ -0,0 +1,344 @@
+package sshx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrExpectEOF is returned by Process.Expect when the output ends before the pattern is seen.
+var ErrExpectEOF = errors.New("sshx: output ended before the expected pattern")
+
+// WindowSize is the size of a terminal, in characters.
+type WindowSize struct {
+	Cols int
+	Rows int
+}
+
+type processConfig struct {
+	pty           bool
+	term          string
+	size          WindowSize
+	modes         ssh.TerminalModes
+	windowChanges <-chan WindowSize
+	stderr        io.Writer
+}
+
+// ProcessOption configures a Process started by SshRunner.Start.
+type ProcessOption func(*processConfig)
+
+// WithPty allocates a pseudo terminal of the term type, e.g. "xterm", and the size.
+// With a terminal, stderr is merged into stdout by the remote side, and lines end with "\r\n".
+func WithPty(term string, cols, rows int) ProcessOption {
+	return func(c *processConfig) {
+		c.pty = true
+		c.term = term
+		c.size = WindowSize{Cols: cols, Rows: rows}
+	}
+}
+
+// WithTerminalModes sets the modes of the pseudo terminal, see WithPty.
+// The default enables echo, with the speed of 14400 baud.
+func WithTerminalModes(modes ssh.TerminalModes) ProcessOption {
+	return func(c *processConfig) {
+		c.modes = modes
+	}
+}
+
+// WithWindowChanges propagates the sizes received to the pseudo terminal, see WithPty,
+// until the channel is closed or the process exits.
+//
+// Example:
+//
+//	sizes := make(chan WindowSize, 1)
+//	// on SIGWINCH: cols, rows, _ := term.GetSize(fd); sizes <- WindowSize{cols, rows}
+//	p, err := runner.Start(ctx, "top", WithPty("xterm", 80, 24), WithWindowChanges(sizes))
+func WithWindowChanges(sizes <-chan WindowSize) ProcessOption {
+	return func(c *processConfig) {
+		c.windowChanges = sizes
+	}
+}
+
+// WithStderr writes the stderr of the process to w. By default stderr is logged as a
+// warning once the process exits, like Run.
+func WithStderr(w io.Writer) ProcessOption {
+	return func(c *processConfig) {
+		c.stderr = w
+	}
+}
+
+// Process is a remote command started by SshRunner.Start, with its stdin and stdout
+// streamed while it runs. It holds a session slot of the connection until it exits.
+//
+// Example:
+//
+//	p, err := runner.Start(ctx, "sudo -k passwd", WithPty("xterm", 80, 24))
+//	if err != nil {
+//	    return err
+//	}
+//	defer p.Close()
+//	for _, answer := range []string{oldPassword, newPassword, newPassword} {
+//	    if _, err := p.ExpectString(ctx, "password:"); err != nil {
+//	        return err
+//	    }
+//	    p.Send(answer + "\n")
+//	}
+//	return p.Wait()
+type Process struct {
+	cmd     string
+	session *ssh.Session
+	stdin   io.WriteCloser
+	cancel  context.CancelFunc
+
+	chunks  chan []byte // stdout read by the pump, closed at EOF
+	readMu  sync.Mutex  // guards pending, for Read and Expect
+	pending []byte      // stdout received but not consumed
+
+	done      chan struct{} // closed once the command exited and the session is closed
+	err       error
+	closed    chan struct{} // closed by Close, to discard the output not read
+	closeOnce sync.Once
+}
+
+// Start starts the command and returns the running process. Unlike Run, the stdin
+// and stdout of the command are streamed, see Process.Stdin and Process.Stdout.
+//
+// Once ctx is done, the command is terminated like Run, see WithKillGracePeriod.
+// The stdout must be read, by Process.Stdout or Process.Expect, or the command
+// blocks once the SSH window is full.
+//
+// Example:
+//
+//	p, err := runner.Start(ctx, "tail -f /var/log/syslog")
+//	if err != nil {
+//	    return err
+//	}
+//	defer p.Close()
+//	scanner := bufio.NewScanner(p.Stdout())
+//	for scanner.Scan() {
+//	    fmt.Println(scanner.Text())
+//	}
+func (s *SshRunner) Start(ctx context.Context, cmd string, opts ...ProcessOption) (*Process, error) {
+	cfg := &processConfig{
+		term: "xterm",
+		size: WindowSize{Cols: 80, Rows: 24},
+		modes: ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		},
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Process{
+		cmd:    cmd,
+		cancel: cancel,
+		chunks: make(chan []byte),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	started := make(chan error, 1)
+	go func() {
+		defer close(p.done)
+		defer cancel()
+		stderr := bytes.Buffer{}
+		p.err = s.conn.Session(ctx, func(session *ssh.Session) error {
+			err := p.start(ctx, session, cfg, &stderr)
+			started <- err
+			if err != nil {
+				return err
+			}
+			return waitCommand(ctx, session, cmd, s.conn.cfg.killGracePeriod)
+		})
+		select {
+		case started <- p.err: // failed before the session
+		default:
+		}
+		if stderr.Len() > 0 {
+			log.Warnf(ctx, "process with stderr: %s", stderr.String())
+		}
+	}()
+	if err := <-started; err != nil {
+		<-p.done
+		return nil, err
+	}
+	return p, nil
+}
+
+// start requests the pseudo terminal and starts the command in the session.
+func (p *Process) start(ctx context.Context, session *ssh.Session, cfg *processConfig, stderr *bytes.Buffer) error {
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if cfg.stderr != nil {
+		session.Stderr = cfg.stderr
+	} else {
+		session.Stderr = stderr
+	}
+	if cfg.pty {
+		if err := session.RequestPty(cfg.term, cfg.size.Rows, cfg.size.Cols, cfg.modes); err != nil {
+			return fmt.Errorf("sshx: request pty: %w", err)
+		}
+	}
+	if err := session.Start(p.cmd); err != nil {
+		return err
+	}
+	p.session = session
+	p.stdin = stdin
+
+	go p.pump(stdout)
+	if cfg.windowChanges != nil {
+		go func() {
+			for {
+				select {
+				case size, ok := <-cfg.windowChanges:
+					if !ok {
+						return
+					}
+					if err := p.Resize(size.Cols, size.Rows); err != nil {
+						log.Warnf(ctx, "ssh window change of %q failed: %v", p.cmd, err)
+					}
+				case <-p.done:
+					return
+				}
+			}
+		}()
+	}
+	return nil
+}
+
+// pump reads stdout into chunks, until EOF or the process is closed.
+// The output is kept after the command exits, until read or closed.
+func (p *Process) pump(stdout io.Reader) {
+	defer close(p.chunks)
+	for {
+		buf := make([]byte, 32*1024)
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			select {
+			case p.chunks <- buf[:n]:
+			case <-p.closed:
+				// drain the rest not to block the connection
+				io.Copy(io.Discard, stdout)
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Stdin returns the stdin of the command. Closing it sends EOF to the command.
+func (p *Process) Stdin() io.WriteCloser {
+	return p.stdin
+}
+
+// Send writes s to the stdin of the command.
+func (p *Process) Send(s string) error {
+	_, err := io.WriteString(p.stdin, s)
+	return err
+}
+
+// Stdout returns the stdout of the command, and with a pseudo terminal also the stderr.
+// It returns io.EOF after the command exits and all the output is read.
+func (p *Process) Stdout() io.Reader {
+	return processReader{p}
+}
+
+type processReader struct {
+	p *Process
+}
+
+func (r processReader) Read(b []byte) (int, error) {
+	p := r.p
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	if len(p.pending) == 0 {
+		chunk, ok := <-p.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		p.pending = chunk
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// Expect reads the stdout until the pattern matches, and returns the output read up to
+// the end of the match. The output after the match is kept for the next Read or Expect.
+// It returns ErrExpectEOF with the output if the output ends first, or the error of ctx
+// once it is done, keeping the output for the next Read or Expect.
+func (p *Process) Expect(ctx context.Context, pattern *regexp.Regexp) (string, error) {
+	p.readMu.Lock()
+	defer p.readMu.Unlock()
+	for {
+		if loc := pattern.FindIndex(p.pending); loc != nil {
+			output := string(p.pending[:loc[1]])
+			p.pending = p.pending[loc[1]:]
+			return output, nil
+		}
+		select {
+		case chunk, ok := <-p.chunks:
+			if !ok {
+				output := string(p.pending)
+				p.pending = nil
+				return output, fmt.Errorf("%w: %q", ErrExpectEOF, pattern)
+			}
+			p.pending = append(p.pending, chunk...)
+		case <-ctx.Done():
+			return "", fmt.Errorf("sshx: expect %q: %w", pattern, ctx.Err())
+		}
+	}
+}
+
+// ExpectString is Expect of the literal string s.
+func (p *Process) ExpectString(ctx context.Context, s string) (string, error) {
+	return p.Expect(ctx, regexp.MustCompile(regexp.QuoteMeta(s)))
+}
+
+// Resize changes the size of the pseudo terminal, see WithPty.
+func (p *Process) Resize(cols, rows int) error {
+	return p.session.WindowChange(rows, cols)
+}
+
+// Signal sends the signal to the command. Servers may not support signals.
+func (p *Process) Signal(sig ssh.Signal) error {
+	return p.session.Signal(sig)
+}
+
+// Done is closed once the command exited.
+func (p *Process) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait waits for the command to exit, and returns its error like Run:
+// *ExitError for a non-zero exit, or ErrCommandCanceled once closed.
+func (p *Process) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Close terminates the command if still running, like the cancellation of its context,
+// and waits for it to exit. The output not read is discarded.
+func (p *Process) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	p.cancel()
+	<-p.done
+	return nil
+}
@@ -0,0 +1,138 @@
+package sshx_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+)
+
+// promptHandler asks for a password, and exits 0 if it is "secret".
+func promptHandler(ctx context.Context, req *sshxtest.Request) int {
+	io.WriteString(req.Stdout, "Password: ")
+	line, _ := bufio.NewReader(req.Stdin).ReadString('\n')
+	if line != "secret\n" {
+		io.WriteString(req.Stdout, "denied\r\n")
+		return 1
+	}
+	io.WriteString(req.Stdout, "ok\r\n")
+	return 0
+}
+
+func TestProcessStreaming(t *testing.T) {
+	runner := sshxtest.New(t, sshxtest.WithHandler(func(ctx context.Context, req *sshxtest.Request) int {
+		scanner := bufio.NewScanner(req.Stdin)
+		for scanner.Scan() {
+			fmt.Fprintf(req.Stdout, "echo: %s\n", scanner.Text())
+		}
+		io.WriteString(req.Stderr, "done")
+		return 0
+	})).Runner()
+	ctx := context.Background()
+
+	var stderr syncBuffer
+	p, err := runner.Start(ctx, "cat", sshx.WithStderr(&stderr))
+	require.NoError(t, err)
+	defer p.Close()
+
+	out := bufio.NewReader(p.Stdout())
+	for _, line := range []string{"first", "second"} {
+		require.NoError(t, p.Send(line+"\n"))
+		got, err := out.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "echo: "+line+"\n", got)
+	}
+	require.NoError(t, p.Stdin().Close())
+	require.NoError(t, p.Wait())
+	rest, err := io.ReadAll(out)
+	require.NoError(t, err)
+	require.Empty(t, rest)
+	require.Equal(t, "done", stderr.String())
+}
+
+func TestProcessPty(t *testing.T) {
+	terms := make(chan string, 1)
+	server := sshxtest.New(t, sshxtest.WithHandler(func(ctx context.Context, req *sshxtest.Request) int {
+		if req.Pty != nil {
+			terms <- req.Pty.Term
+		}
+		return promptHandler(ctx, req)
+	}))
+	runner := server.Runner()
+	ctx := context.Background()
+
+	sizes := make(chan sshx.WindowSize)
+	p, err := runner.Start(ctx, "passwd", sshx.WithPty("vt100", 120, 40), sshx.WithWindowChanges(sizes))
+	require.NoError(t, err)
+	defer p.Close()
+
+	sizes <- sshx.WindowSize{Cols: 100, Rows: 30}
+	require.Eventually(t, func() bool { return len(server.WindowSizes()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, p.Resize(132, 50))
+
+	output, err := p.ExpectString(ctx, "Password: ")
+	require.NoError(t, err)
+	require.Equal(t, "Password: ", output)
+	require.NoError(t, p.Send("secret\n"))
+	output, err = p.Expect(ctx, regexp.MustCompile(`o.\r\n`))
+	require.NoError(t, err)
+	require.Equal(t, "ok\r\n", output)
+	require.NoError(t, p.Wait())
+
+	require.Equal(t, "vt100", <-terms)
+	require.Equal(t, []sshx.WindowSize{{120, 40}, {100, 30}, {132, 50}}, server.WindowSizes())
+}
+
+func TestProcessExpectFailures(t *testing.T) {
+	handler, started := blockingHandler(t)
+	runner := sshxtest.New(t, sshxtest.WithHandler(func(ctx context.Context, req *sshxtest.Request) int {
+		if req.Command == "passwd" {
+			return promptHandler(ctx, req)
+		}
+		return handler(ctx, req)
+	})).Runner()
+	ctx := context.Background()
+
+	t.Run("exit", func(t *testing.T) {
+		p, err := runner.Start(ctx, "passwd")
+		require.NoError(t, err)
+		defer p.Close()
+		_, err = p.ExpectString(ctx, "Password: ")
+		require.NoError(t, err)
+		require.NoError(t, p.Send("wrong\n"))
+
+		output, err := p.ExpectString(ctx, "welcome")
+		require.ErrorIs(t, err, sshx.ErrExpectEOF)
+		require.Equal(t, "denied\r\n", output)
+		var exitErr *sshx.ExitError
+		require.ErrorAs(t, p.Wait(), &exitErr)
+		require.Equal(t, 1, exitErr.ExitCode)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		p, err := runner.Start(ctx, "sleep")
+		require.NoError(t, err)
+		<-started
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = p.ExpectString(timeoutCtx, "never")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// the output is kept for the next read
+		output, err := p.ExpectString(ctx, "partial")
+		require.NoError(t, err)
+		require.Equal(t, "partial", output)
+
+		require.NoError(t, p.Close())
+		require.True(t, errors.Is(p.Wait(), sshx.ErrCommandCanceled))
+	})
+}
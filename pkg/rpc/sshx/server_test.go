@@ -0,0 +1,14 @@
+package sshx_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+)
+
+// echoHandler writes the command to stdout.
+func echoHandler(ctx context.Context, req *sshxtest.Request) int {
+	fmt.Fprint(req.Stdout, req.Command)
+	return 0
+}
@@ -0,0 +1,433 @@
+package sshx
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrChecksumMismatch is returned by transfers WithChecksum when the SHA-256
+	// of the remote file differs from the data transferred.
+	ErrChecksumMismatch = errors.New("sshx: checksum mismatch")
+
+	// errSFTPUnavailable is returned when the server has no SFTP subsystem.
+	errSFTPUnavailable = errors.New("sshx: sftp subsystem unavailable")
+)
+
+type transferConfig struct {
+	mode     os.FileMode // 0 keeps the mode of an existing file, or the server default
+	modTime  time.Time   // zero keeps the time of the transfer
+	atomic   bool
+	checksum bool
+}
+
+// TransferOption configures the file transfers of SshRunner.
+type TransferOption func(*transferConfig)
+
+// WithFileMode sets the permission bits of the uploaded file.
+func WithFileMode(mode os.FileMode) TransferOption {
+	return func(c *transferConfig) {
+		c.mode = mode.Perm()
+	}
+}
+
+// WithModTime sets the modification time of the uploaded file.
+func WithModTime(t time.Time) TransferOption {
+	return func(c *transferConfig) {
+		c.modTime = t
+	}
+}
+
+// WithAtomicUpload uploads to a temporary file in the same directory, renamed to the
+// destination once complete, so that readers never see a partial file.
+// The mode of an existing destination is kept unless WithFileMode is given.
+func WithAtomicUpload() TransferOption {
+	return func(c *transferConfig) {
+		c.atomic = true
+	}
+}
+
+// WithChecksum verifies the SHA-256 of the remote file against the data transferred,
+// returning ErrChecksumMismatch if they differ. It runs `sha256sum` on the server.
+func WithChecksum() TransferOption {
+	return func(c *transferConfig) {
+		c.checksum = true
+	}
+}
+
+func newTransferConfig(opts []TransferOption) *transferConfig {
+	cfg := &transferConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// SFTP runs f with an SFTP client over a session of the connection, closed after f returns.
+// The client is closed once ctx is done, failing the operations in progress.
+//
+// Example:
+//
+//	err := runner.SFTP(ctx, func(client *sftp.Client) error {
+//	    return client.MkdirAll("/srv/app/releases")
+//	})
+func (s *SshRunner) SFTP(ctx context.Context, f func(client *sftp.Client) error) error {
+	return s.conn.Session(ctx, func(session *ssh.Session) error {
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			return err
+		}
+		stdout, err := session.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := session.RequestSubsystem("sftp"); err != nil {
+			return fmt.Errorf("%w: %v", errSFTPUnavailable, err)
+		}
+		client, err := sftp.NewClientPipe(stdout, stdin)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		stop := context.AfterFunc(ctx, func() { client.Close() })
+		defer stop()
+		err = f(client)
+		if err != nil && ctx.Err() != nil {
+			return fmt.Errorf("sshx: sftp interrupted: %w", ctx.Err())
+		}
+		return err
+	})
+}
+
+// withTransport runs f with the SFTP transport, or the shell command transport
+// if the server has no SFTP subsystem, which is remembered for later transfers.
+func (s *SshRunner) withTransport(ctx context.Context, f func(t fileTransport) error) error {
+	if !s.noSFTP.Load() {
+		err := s.SFTP(ctx, func(client *sftp.Client) error {
+			return f(&sftpTransport{client: client})
+		})
+		if !errors.Is(err, errSFTPUnavailable) {
+			return err
+		}
+		log.Warnf(ctx, "ssh server has no sftp subsystem, falling back to shell commands: %v", err)
+		s.noSFTP.Store(true)
+	}
+	return f(&shellTransport{ctx: ctx, runner: s})
+}
+
+// Upload streams r to the remote file, creating or truncating it.
+// By default the file is written in place, with the server's default mode if created.
+//
+// Example:
+//
+//	f, _ := os.Open("app.tar.gz")
+//	defer f.Close()
+//	err := runner.Upload(ctx, "/srv/app/app.tar.gz", f, WithAtomicUpload(), WithChecksum())
+func (s *SshRunner) Upload(ctx context.Context, remotePath string, r io.Reader, opts ...TransferOption) error {
+	cfg := newTransferConfig(opts)
+	var sum hash.Hash
+	if cfg.checksum {
+		sum = sha256.New()
+		r = io.TeeReader(r, sum)
+	}
+	err := s.withTransport(ctx, func(t fileTransport) error {
+		return t.upload(remotePath, r, cfg)
+	})
+	if err != nil {
+		return err
+	}
+	if sum != nil {
+		return s.verifyChecksum(ctx, remotePath, sum)
+	}
+	return nil
+}
+
+// Download streams the remote file to w. WithChecksum is the only option taking effect.
+//
+// Example:
+//
+//	var buf bytes.Buffer
+//	err := runner.Download(ctx, "/etc/hosts", &buf)
+func (s *SshRunner) Download(ctx context.Context, remotePath string, w io.Writer, opts ...TransferOption) error {
+	cfg := newTransferConfig(opts)
+	var sum hash.Hash
+	if cfg.checksum {
+		sum = sha256.New()
+		w = io.MultiWriter(w, sum)
+	}
+	err := s.withTransport(ctx, func(t fileTransport) error {
+		return t.download(remotePath, w)
+	})
+	if err != nil {
+		return err
+	}
+	if sum != nil {
+		return s.verifyChecksum(ctx, remotePath, sum)
+	}
+	return nil
+}
+
+// UploadFrom uploads the local file, keeping its mode and modification time
+// unless given by WithFileMode and WithModTime.
+func (s *SshRunner) UploadFrom(ctx context.Context, localPath, remotePath string, opts ...TransferOption) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	opts = append([]TransferOption{WithFileMode(info.Mode()), WithModTime(info.ModTime())}, opts...)
+	return s.Upload(ctx, remotePath, f, opts...)
+}
+
+// DownloadTo downloads the remote file to the local file, keeping its mode and
+// modification time if the server supports SFTP. The local file is written
+// to a temporary file renamed once complete.
+func (s *SshRunner) DownloadTo(ctx context.Context, remotePath, localPath string, opts ...TransferOption) error {
+	cfg := newTransferConfig(opts)
+	tmp, err := os.CreateTemp(filepath.Dir(localPath), "."+filepath.Base(localPath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var sum hash.Hash
+	var w io.Writer = tmp
+	if cfg.checksum {
+		sum = sha256.New()
+		w = io.MultiWriter(tmp, sum)
+	}
+	var info os.FileInfo
+	err = s.withTransport(ctx, func(t fileTransport) error {
+		var err error
+		info, err = t.stat(remotePath)
+		if err != nil && !errors.Is(err, errStatUnsupported) {
+			return err
+		}
+		return t.download(remotePath, w)
+	})
+	if err != nil {
+		return err
+	}
+	if sum != nil {
+		if err := s.verifyChecksum(ctx, remotePath, sum); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if info != nil {
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), localPath)
+}
+
+// SyncDir uploads the local directory to the remote directory recursively,
+// creating the directories, and keeping the modes and modification times.
+// Files of the same size and modification time on the server are skipped if the
+// server supports SFTP. Remote files not in the local directory are kept.
+// Symbolic links are skipped.
+//
+// Example:
+//
+//	err := runner.SyncDir(ctx, "./dist", "/srv/app/static", WithAtomicUpload())
+func (s *SshRunner) SyncDir(ctx context.Context, localDir, remoteDir string, opts ...TransferOption) error {
+	cfg := newTransferConfig(opts)
+	sums := map[string]hash.Hash{}
+	err := s.withTransport(ctx, func(t fileTransport) error {
+		return filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(localDir, p)
+			if err != nil {
+				return err
+			}
+			remote := path.Join(remoteDir, filepath.ToSlash(rel))
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			switch {
+			case d.IsDir():
+				return t.mkdirAll(remote, info.Mode().Perm())
+			case !d.Type().IsRegular():
+				log.Warnf(ctx, "ssh sync skips %s, not a regular file", p)
+				return nil
+			}
+
+			if remoteInfo, err := t.stat(remote); err == nil && !remoteInfo.IsDir() &&
+				remoteInfo.Size() == info.Size() && remoteInfo.ModTime().Unix() == info.ModTime().Unix() {
+				return nil
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			fileCfg := *cfg
+			fileCfg.mode = info.Mode().Perm()
+			fileCfg.modTime = info.ModTime()
+			var r io.Reader = f
+			if cfg.checksum {
+				sum := sha256.New()
+				sums[remote] = sum
+				r = io.TeeReader(f, sum)
+			}
+			return t.upload(remote, r, &fileCfg)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for remote, sum := range sums {
+		if err := s.verifyChecksum(ctx, remote, sum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyChecksum compares the SHA-256 of the remote file with sum.
+func (s *SshRunner) verifyChecksum(ctx context.Context, remotePath string, sum hash.Hash) error {
+	output, err := s.RunCommand(ctx, NewCommand("sha256sum", "--", remotePath))
+	if err != nil {
+		return fmt.Errorf("sshx: checksum %s: %w", remotePath, err)
+	}
+	remote, _, _ := strings.Cut(output, " ")
+	local := hex.EncodeToString(sum.Sum(nil))
+	if remote != local {
+		return fmt.Errorf("%w: %s: remote %s, local %s", ErrChecksumMismatch, remotePath, remote, local)
+	}
+	return nil
+}
+
+// errStatUnsupported is returned by fileTransport.stat if the transport cannot stat files.
+var errStatUnsupported = errors.New("sshx: stat unsupported")
+
+// fileTransport moves files by SFTP, or by shell commands if the server has no SFTP subsystem.
+type fileTransport interface {
+	// upload writes r to the remote file, setting the mode and modification time if given.
+	upload(remotePath string, r io.Reader, cfg *transferConfig) error
+	download(remotePath string, w io.Writer) error
+	stat(remotePath string) (os.FileInfo, error)
+	mkdirAll(dir string, mode os.FileMode) error
+}
+
+type sftpTransport struct {
+	client *sftp.Client
+}
+
+func (t *sftpTransport) upload(remotePath string, r io.Reader, cfg *transferConfig) error {
+	target := remotePath
+	mode := cfg.mode
+	if cfg.atomic {
+		if mode == 0 {
+			if info, err := t.client.Stat(remotePath); err == nil {
+				mode = info.Mode().Perm()
+			}
+		}
+		target = tempPath(remotePath)
+	}
+
+	err := t.write(target, r, mode, cfg.modTime)
+	if err == nil && cfg.atomic {
+		err = t.rename(target, remotePath)
+	}
+	if err != nil && cfg.atomic {
+		t.client.Remove(target)
+	}
+	return err
+}
+
+func (t *sftpTransport) write(remotePath string, r io.Reader, mode os.FileMode, modTime time.Time) error {
+	f, err := t.client.Create(remotePath)
+	if err != nil {
+		return fmt.Errorf("sshx: create %s: %w", remotePath, err)
+	}
+	if _, err := f.ReadFrom(r); err != nil {
+		f.Close()
+		return fmt.Errorf("sshx: write %s: %w", remotePath, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if mode != 0 {
+		if err := t.client.Chmod(remotePath, mode); err != nil {
+			return err
+		}
+	}
+	if !modTime.IsZero() {
+		if err := t.client.Chtimes(remotePath, modTime, modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rename replaces newname by oldname atomically if the server supports the
+// posix-rename extension, or removes newname first otherwise.
+func (t *sftpTransport) rename(oldname, newname string) error {
+	if err := t.client.PosixRename(oldname, newname); err == nil {
+		return nil
+	}
+	if err := t.client.Remove(newname); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return t.client.Rename(oldname, newname)
+}
+
+func (t *sftpTransport) download(remotePath string, w io.Writer) error {
+	f, err := t.client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("sshx: open %s: %w", remotePath, err)
+	}
+	defer f.Close()
+	_, err = f.WriteTo(w)
+	return err
+}
+
+func (t *sftpTransport) stat(remotePath string) (os.FileInfo, error) {
+	return t.client.Stat(remotePath)
+}
+
+func (t *sftpTransport) mkdirAll(dir string, mode os.FileMode) error {
+	if err := t.client.MkdirAll(dir); err != nil {
+		return err
+	}
+	return t.client.Chmod(dir, mode)
+}
+
+// tempPath returns a hidden temporary path next to p.
+func tempPath(p string) string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	dir, file := path.Split(p)
+	return dir + "." + file + ".tmp-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,97 @@
+package sshx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// shellTransport moves files by POSIX shell commands, for servers without the SFTP subsystem.
+// It cannot stat files.
+type shellTransport struct {
+	ctx    context.Context
+	runner *SshRunner
+}
+
+func (t *shellTransport) upload(remotePath string, r io.Reader, cfg *transferConfig) error {
+	target := remotePath
+	if cfg.atomic {
+		target = tempPath(remotePath)
+	}
+	q := ShellQuote(target)
+	cmd := "cat > " + q
+	if cfg.atomic && cfg.mode == 0 {
+		// keep the mode of the existing file, as POSIX has no chmod --reference
+		cmd = fmt.Sprintf("{ [ ! -e %s ] || cp -p -- %s %s; } && %s", ShellQuote(remotePath), ShellQuote(remotePath), q, cmd)
+	}
+	if cfg.mode != 0 {
+		cmd += fmt.Sprintf(" && chmod %o -- %s", cfg.mode, q)
+	}
+	if !cfg.modTime.IsZero() {
+		cmd += fmt.Sprintf(" && TZ=UTC0 touch -m -t %s -- %s", cfg.modTime.UTC().Format("200601021504.05"), q)
+	}
+	if cfg.atomic {
+		cmd += " && mv -f -- " + q + " " + ShellQuote(remotePath)
+	}
+	cmd += " && echo " + success
+	if cfg.atomic {
+		cmd = fmt.Sprintf("{ %s; } || { rm -f -- %s; false; }", cmd, q)
+	}
+
+	output, err := t.run(cmd, r)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(output, success) {
+		log.Infof(t.ctx, "ssh upload file not success, output: %s", output)
+		return ErrUpdateScriptFailed
+	}
+	return nil
+}
+
+func (t *shellTransport) download(remotePath string, w io.Writer) error {
+	return t.runner.conn.Session(t.ctx, func(session *ssh.Session) error {
+		stderr := bytes.Buffer{}
+		session.Stdout = w
+		session.Stderr = &stderr
+		err := t.runner.runCommand(t.ctx, session, "cat -- "+ShellQuote(remotePath))
+		if stderr.Len() > 0 {
+			log.Warnf(t.ctx, "download file with stderr: %s", stderr.String())
+		}
+		return err
+	})
+}
+
+func (t *shellTransport) stat(remotePath string) (os.FileInfo, error) {
+	return nil, errStatUnsupported
+}
+
+func (t *shellTransport) mkdirAll(dir string, mode os.FileMode) error {
+	q := ShellQuote(dir)
+	_, err := t.run(fmt.Sprintf("mkdir -p -- %s && chmod %o -- %s", q, mode, q), nil)
+	return err
+}
+
+// run runs cmd with stdin, returning stdout. stderr is logged as a warning.
+func (t *shellTransport) run(cmd string, stdin io.Reader) (string, error) {
+	var output string
+	err := t.runner.conn.Session(t.ctx, func(session *ssh.Session) error {
+		stdout := bytes.Buffer{}
+		stderr := bytes.Buffer{}
+		session.Stdin = stdin
+		session.Stdout = &stdout
+		session.Stderr = &stderr
+		err := t.runner.runCommand(t.ctx, session, cmd)
+		output = stdout.String()
+		if stderr.Len() > 0 {
+			log.Warnf(t.ctx, "ssh file transfer with stderr: %s", stderr.String())
+		}
+		return err
+	})
+	return output, err
+}
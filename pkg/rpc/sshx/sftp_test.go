@@ -0,0 +1,164 @@
+package sshx_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx/sshxtest"
+	"github.com/stretchr/testify/require"
+)
+
+// transferOptions serves the SFTP subsystem, or only the shell if !sftp.
+func transferOptions(sftp bool) []sshxtest.Option {
+	if sftp {
+		return []sshxtest.Option{sshxtest.WithSFTP()}
+	}
+	return nil
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestFileTransfer(t *testing.T) {
+	for _, transport := range []struct {
+		name string
+		sftp bool
+	}{{"sftp", true}, {"shell", false}} {
+		t.Run(transport.name, func(t *testing.T) {
+			runner := sshxtest.New(t, transferOptions(transport.sftp)...).Runner()
+			ctx := context.Background()
+			dir := t.TempDir()
+			mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+			// paths with spaces and quotes are neither broken nor injectable
+			remote := filepath.Join(dir, "it's a file; touch pwned")
+			err := runner.Upload(ctx, remote, strings.NewReader("hello"),
+				sshx.WithFileMode(0o640), sshx.WithModTime(mtime), sshx.WithAtomicUpload(), sshx.WithChecksum())
+			require.NoError(t, err)
+			require.Equal(t, []string{"it's a file; touch pwned"}, listDir(t, dir), "no temporary or injected files")
+			info, err := os.Stat(remote)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+			require.True(t, mtime.Equal(info.ModTime()), "mtime %s", info.ModTime())
+
+			var buf bytes.Buffer
+			require.NoError(t, runner.Download(ctx, remote, &buf, sshx.WithChecksum()))
+			require.Equal(t, "hello", buf.String())
+
+			// the atomic upload keeps the mode of the existing file
+			require.NoError(t, runner.Upload(ctx, remote, strings.NewReader("again"), sshx.WithAtomicUpload()))
+			info, err = os.Stat(remote)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+			// the legacy byte slice API
+			require.NoError(t, runner.UploadFile(ctx, filepath.Join(dir, "plain"), []byte("data")))
+			data, err := runner.DownloadFile(ctx, filepath.Join(dir, "plain"))
+			require.NoError(t, err)
+			require.Equal(t, "data", string(data))
+			require.NoError(t, runner.UpdateScript(ctx, filepath.Join(dir, "run.sh"), []byte("#!/bin/sh\necho ok\n")))
+			output, err := runner.Run(ctx, filepath.Join(dir, "run.sh"))
+			require.NoError(t, err)
+			require.Equal(t, "ok\n", output)
+
+			_, err = runner.DownloadFile(ctx, filepath.Join(dir, "missing"))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestUploadFromDownloadTo(t *testing.T) {
+	for _, sftp := range []bool{true, false} {
+		runner := sshxtest.New(t, transferOptions(sftp)...).Runner()
+		ctx := context.Background()
+		local := filepath.Join(t.TempDir(), "local")
+		remote := filepath.Join(t.TempDir(), "remote")
+		back := filepath.Join(t.TempDir(), "back")
+		mtime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+		require.NoError(t, os.WriteFile(local, []byte("content"), 0o600))
+		require.NoError(t, os.Chtimes(local, mtime, mtime))
+
+		require.NoError(t, runner.UploadFrom(ctx, local, remote))
+		info, err := os.Stat(remote)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+		require.True(t, mtime.Equal(info.ModTime()))
+
+		require.NoError(t, runner.DownloadTo(ctx, remote, back, sshx.WithChecksum()))
+		data, err := os.ReadFile(back)
+		require.NoError(t, err)
+		require.Equal(t, "content", string(data))
+		if sftp {
+			info, err = os.Stat(back)
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+			require.True(t, mtime.Equal(info.ModTime()))
+		}
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	for _, sftp := range []bool{true, false} {
+		runner := sshxtest.New(t, transferOptions(sftp)...).Runner()
+		ctx := context.Background()
+		local := t.TempDir()
+		remote := filepath.Join(t.TempDir(), "remote dir")
+		require.NoError(t, os.MkdirAll(filepath.Join(local, "a", "b"), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(local, "top.txt"), []byte("top"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(local, "a", "b", "deep.sh"), []byte("deep"), 0o755))
+
+		require.NoError(t, runner.SyncDir(ctx, local, remote, sshx.WithChecksum()))
+		data, err := os.ReadFile(filepath.Join(remote, "a", "b", "deep.sh"))
+		require.NoError(t, err)
+		require.Equal(t, "deep", string(data))
+		info, err := os.Stat(filepath.Join(remote, "a", "b", "deep.sh"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+		info, err = os.Stat(filepath.Join(remote, "a"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o750), info.Mode().Perm())
+
+		// unchanged files are skipped with SFTP, detected by a remote change of the same size and time
+		top := filepath.Join(remote, "top.txt")
+		info, err = os.Stat(top)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(top, []byte("TOP"), 0o644))
+		require.NoError(t, os.Chtimes(top, info.ModTime(), info.ModTime()))
+		require.NoError(t, runner.SyncDir(ctx, local, remote))
+		data, err = os.ReadFile(top)
+		require.NoError(t, err)
+		if sftp {
+			require.Equal(t, "TOP", string(data))
+		} else {
+			require.Equal(t, "top", string(data))
+		}
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	shell := sshxtest.ShellHandler(t.TempDir())
+	runner := sshxtest.New(t, sshxtest.WithSFTP(), sshxtest.WithHandler(func(ctx context.Context, req *sshxtest.Request) int {
+		if strings.HasPrefix(req.Command, "sha256sum ") {
+			io.WriteString(req.Stdout, "0000  file\n")
+			return 0
+		}
+		return shell(ctx, req)
+	})).Runner()
+	remote := filepath.Join(t.TempDir(), "file")
+	err := runner.Upload(context.Background(), remote, strings.NewReader("hello"), sshx.WithChecksum())
+	require.ErrorIs(t, err, sshx.ErrChecksumMismatch)
+}
@@ -1,11 +1,17 @@
 package sshx
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/RyoJerryYu/go-utilx/pkg/utils/loggerx"
+	"github.com/RyoJerryYu/go-utilx/pkg/utils/timerx"
+	"github.com/kevinburke/ssh_config"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -20,8 +26,26 @@ func RegisterLogger(l loggerx.Loggerf) {
 // sshClientConfig holds the configuration for SSH client connection.
 // All fields are required to establish a connection.
 type sshClientConfig struct {
-	port int
-	auth []ssh.AuthMethod
+	port            int // 0 if not set, see target
+	auth            []ssh.AuthMethod
+	publicKeys      []signerSource // offered by one publickey method in auth, see addPublicKeys
+	passphrase      PassphraseFunc
+	sshConfigs      []*ssh_config.Config
+	hostKeyCallback ssh.HostKeyCallback // nil ignores host keys, see WithKnownHosts
+	dialer          Dialer              // nil dials TCP directly, see WithProxy
+	jumpHosts       []*jumpHost
+
+	// hostKeyAlgorithms returns the host key algorithms to negotiate with the address
+	// "host:port", nil for the defaults, see WithKnownHosts
+	hostKeyAlgorithms func(addr string) []string
+
+	// used by managed connections only, see Conn
+	keepaliveInterval    time.Duration
+	maxSessions          int
+	reconnectBackoff     timerx.Timer
+	maxReconnectAttempts int
+
+	killGracePeriod time.Duration // see WithKillGracePeriod
 }
 
 // SSHClientOption is a function type that modifies sshClientConfig.
@@ -41,8 +65,13 @@ func WithPort(port int) SSHClientOption {
 	}
 }
 
-// WithPrivateKeyBytes configures SSH authentication using a private key.
+// WithPrivateKeyBytes adds a private key for SSH authentication.
 // The private key bytes should be in PEM format.
+// An encrypted key is decrypted on first use by the passphrase from WithPassphrase.
+//
+// The key is added to the keys of the other options, e.g. WithDefaultAuth or an earlier
+// WithPrivateKeyBytes, rather than replacing them, and all the keys are offered in order.
+// Give only this option to authenticate by this key alone.
 //
 // Example:
 //
@@ -50,22 +79,19 @@ func WithPort(port int) SSHClientOption {
 //	opts := WithPrivateKeyBytes(keyBytes)
 func WithPrivateKeyBytes(privateKeyBytes []byte) SSHClientOption {
 	return func(c *sshClientConfig) error {
-		signer, err := ssh.ParsePrivateKey(privateKeyBytes)
-		if err != nil {
-			return err
-		}
-		c.auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
-		return nil
+		return c.addPrivateKey("", privateKeyBytes, nil)
 	}
 }
 
-// WithDefaultAuth configures SSH authentication using the default private key
-// from the user's home directory. It first tries to use ~/.ssh/id_rsa,
-// and falls back to ~/.ssh/id_ed25519 if id_rsa doesn't exist.
+// WithDefaultAuth configures SSH authentication like OpenSSH does by default:
+// the keys of ssh-agent if SSH_AUTH_SOCK is set, then the private keys
+// ~/.ssh/id_rsa, ~/.ssh/id_ecdsa and ~/.ssh/id_ed25519 that exist, each with
+// its certificate (e.g. ~/.ssh/id_ed25519-cert.pub) if any.
+// Encrypted keys are decrypted by the passphrase from WithPassphrase.
 //
 // Returns an error if:
 // - Unable to get user's home directory
-// - Neither id_rsa nor id_ed25519 exists
+// - Neither ssh-agent nor any of the private keys exists
 // - Private key file cannot be read
 // - Private key format is invalid
 func WithDefaultAuth() SSHClientOption {
@@ -74,52 +100,89 @@ func WithDefaultAuth() SSHClientOption {
 		if err != nil {
 			return err
 		}
-		privateKeyFilePath := fmt.Sprintf("%s/.ssh/id_rsa", dir)
-		if _, err := os.Stat(privateKeyFilePath); os.IsNotExist(err) {
-			privateKeyFilePath = fmt.Sprintf("%s/.ssh/id_ed25519", dir)
+		found := false
+		if os.Getenv("SSH_AUTH_SOCK") != "" {
+			if err := WithAgent()(c); err != nil {
+				return err
+			}
+			found = true
 		}
-		privateKeyBytes, err := os.ReadFile(privateKeyFilePath)
-		if err != nil {
-			return err
+		for _, name := range []string{"id_rsa", "id_ecdsa", "id_ed25519"} {
+			file := filepath.Join(dir, ".ssh", name)
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				continue
+			}
+			if err := WithPrivateKeyFile(file)(c); err != nil {
+				return err
+			}
+			found = true
 		}
-		return WithPrivateKeyBytes(privateKeyBytes)(c)
+		if !found {
+			return fmt.Errorf("sshx: no ssh-agent or default private key in %s", filepath.Join(dir, ".ssh"))
+		}
+		return nil
 	}
 }
 
 // MakeSSHClient creates a new SSH client with the specified user, host and options.
-// If no options are provided, it uses default port 22 and no authentication method.
+// If no options are provided, it uses default port 22 and WithDefaultAuth.
+// Authentication methods are tried in the order of the options, see WithAuthMethods.
 //
 // Example:
 //
 //	client, err := MakeSSHClient("user", "example.com", WithDefaultAuth(), WithPort(2222))
-//
-// Note: At least one authentication method must be provided through options,
-// otherwise the connection will fail.
 func MakeSSHClient(user, host string, opts ...SSHClientOption) (*ssh.Client, error) {
+	cfg, err := newSSHClientConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ensureAuth(host); err != nil {
+		return nil, err
+	}
+	return makeSSHClientWithCustom(context.Background(), user, host, cfg)
+}
+
+// newSSHClientConfig applies the options over the defaults.
+func newSSHClientConfig(opts ...SSHClientOption) (*sshClientConfig, error) {
 	cfg := &sshClientConfig{
-		port: 22,
-		auth: []ssh.AuthMethod{},
+		auth:                 []ssh.AuthMethod{},
+		keepaliveInterval:    defaultKeepaliveInterval,
+		maxSessions:          defaultMaxSessions,
+		reconnectBackoff:     timerx.NewExponentialBackoff(defaultMaxReconnectAttempts, time.Second, 30*time.Second),
+		maxReconnectAttempts: defaultMaxReconnectAttempts,
+		killGracePeriod:      defaultKillGracePeriod,
 	}
 	for _, opt := range opts {
 		if err := opt(cfg); err != nil {
 			return nil, err
 		}
 	}
-	if len(cfg.auth) == 0 {
-		err := WithDefaultAuth()(cfg)
-		if err != nil {
-			return nil, err
-		}
+	return cfg, nil
+}
+
+// ensureAuth falls back to the IdentityFile of the ssh config (see WithSSHConfig) of the host,
+// or WithDefaultAuth, if no authentication method is provided.
+func (c *sshClientConfig) ensureAuth(host string) error {
+	if len(c.auth) > 0 {
+		return nil
+	}
+	if err := c.addIdentityFiles(host); err != nil {
+		return err
 	}
-	return makeSSHClientWithCustom(user, host, cfg)
+	if len(c.auth) > 0 {
+		return nil
+	}
+	return WithDefaultAuth()(c)
 }
 
 // makeSSHClientWithCustom creates an SSH client with the given configuration.
 // This is an internal function used by MakeSSHClient.
 //
 // The connection will:
-// - Use InsecureIgnoreHostKey for host verification (not safe for production)
-// - Timeout after 1 minute if connection cannot be established
+// - Resolve the user, host and port by the ssh config if configured (see WithSSHConfig)
+// - Go through the proxy and the jump hosts if configured (see WithProxy and WithJumpHost)
+// - Verify the host key, or ignore it with a warning if not configured (see WithKnownHosts)
+// - Timeout after 1 minute if connection cannot be established, or once ctx is done
 // - Use TCP protocol for connection
 //
 // Example internal usage:
@@ -128,17 +191,47 @@ func MakeSSHClient(user, host string, opts ...SSHClientOption) (*ssh.Client, err
 //	    port: 22,
 //	    auth: []ssh.AuthMethod{ssh.Password("password")},
 //	}
-//	client, err := makeSSHClientWithCustom("user", "host.example.com", cfg)
-func makeSSHClientWithCustom(user, host string, cfg *sshClientConfig) (*ssh.Client, error) {
+//	client, err := makeSSHClientWithCustom(ctx, "user", "host.example.com", cfg)
+func makeSSHClientWithCustom(ctx context.Context, user, host string, cfg *sshClientConfig) (*ssh.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	return cfg.dial(ctx, user, host)
+}
+
+// dialSSH connects to the host through the dialer, and completes the SSH handshake.
+func dialSSH(ctx context.Context, dialer Dialer, user, host string, cfg *sshClientConfig) (*ssh.Client, error) {
+	user, host, port := cfg.target(user, host)
+	hostKeyCallback := cfg.hostKeyCallback
+	if hostKeyCallback == nil {
+		log.Warnf(ctx, "ssh host key of %s is not verified, use WithKnownHosts to verify it", host)
+		hostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
 	sshConfig := &ssh.ClientConfig{
 		User:            user,
 		Auth:            cfg.auth,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Minute,
+		HostKeyCallback: hostKeyCallback,
+	}
+	if cfg.hostKeyAlgorithms != nil {
+		sshConfig.HostKeyAlgorithms = cfg.hostKeyAlgorithms(addr)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handshake does not take a context, so abort it by closing the connection
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if !stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, ctx.Err()
 	}
-	sshcon, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host, cfg.port), sshConfig)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
-	return sshcon, nil
+	return ssh.NewClient(c, chans, reqs), nil
 }
@@ -0,0 +1,143 @@
+package sshx
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// WithSSHConfig honours the OpenSSH client config files for the host given to
+// MakeSSHClient, NewSshRunner and so on, which may be a Host alias. If no file is
+// given, ~/.ssh/config is used if it exists. For each keyword the first value
+// found wins, as in OpenSSH.
+//
+// The keywords supported are:
+// - HostName: the real host name to connect to, "%h" is replaced by the host given
+// - Port: used if WithPort is not given
+// - User: used if the user given is empty
+// - IdentityFile: used if no authentication method is given, see WithPrivateKeyFile
+//
+// Example:
+//
+//	// with "Host web\n  HostName 10.0.0.5\n  User deploy\n  IdentityFile ~/.ssh/deploy" in ~/.ssh/config
+//	runner, err := NewSshRunner("", "web", WithSSHConfig())
+func WithSSHConfig(files ...string) SSHClientOption {
+	return func(c *sshClientConfig) error {
+		if len(files) == 0 {
+			file, err := expandHome("~/.ssh/config")
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(file); os.IsNotExist(err) {
+				return nil
+			}
+			files = []string{file}
+		}
+		for _, file := range files {
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			config, err := ssh_config.Decode(f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			c.sshConfigs = append(c.sshConfigs, config)
+		}
+		return nil
+	}
+}
+
+// target resolves the user, host name and port to connect to by the options
+// and the ssh config of host.
+func (c *sshClientConfig) target(user, host string) (string, string, int) {
+	hostname := host
+	if v := c.sshConfigValue(host, "HostName"); v != "" {
+		hostname = strings.NewReplacer("%h", host, "%%", "%").Replace(v)
+	}
+
+	port := c.port
+	if port == 0 {
+		if v := c.sshConfigValue(host, "Port"); v != "" {
+			p, err := strconv.Atoi(v)
+			if err != nil {
+				log.Warnf(context.Background(), "ssh config of %s has an invalid port %q, ignored", host, v)
+			}
+			port = p
+		}
+	}
+	if port == 0 {
+		port = 22
+	}
+
+	if user == "" {
+		user = c.sshConfigValue(host, "User")
+	}
+	if user == "" {
+		user = localUsername()
+	}
+	return user, hostname, port
+}
+
+// addIdentityFiles adds the IdentityFile keys of the ssh config of host.
+// Missing files are skipped, as OpenSSH does.
+func (c *sshClientConfig) addIdentityFiles(host string) error {
+	for _, config := range c.sshConfigs {
+		files, err := config.GetAll(host, "IdentityFile")
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			file = strings.NewReplacer("%h", host, "%%", "%").Replace(file)
+			expanded, err := expandHome(file)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(expanded); os.IsNotExist(err) {
+				log.Warnf(context.Background(), "ssh config identity file %s of %s does not exist, skipped", file, host)
+				continue
+			}
+			if err := WithPrivateKeyFile(expanded)(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sshConfigValue returns the first value of the keyword for host in the ssh configs.
+func (c *sshClientConfig) sshConfigValue(host, key string) string {
+	for _, config := range c.sshConfigs {
+		v, err := config.Get(host, key)
+		if err == nil && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// expandHome expands a leading "~/" of path to the user's home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	dir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path[1:]), nil
+}
+
+func localUsername() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
@@ -4,18 +4,20 @@ import (
 	"bytes"
 	"context"
 	"errors"
-	"fmt"
 	"io"
-	"strings"
+	"sync/atomic"
 
 	"golang.org/x/crypto/ssh"
 )
 
 // SshRunner provides methods to execute commands and transfer files over an SSH connection.
-// It requires an established SSH client connection to function.
-// The connection must remain valid throughout the lifetime of the SshRunner.
+// The connection is a managed Conn, which reconnects transparently after it drops
+// if the SshRunner is created by NewSshRunner.
+//
+// Files are transferred by SFTP, or by shell commands if the server has no SFTP subsystem.
 type SshRunner struct {
-	sshClient *ssh.Client
+	conn   *Conn
+	noSFTP atomic.Bool // the server has no SFTP subsystem
 }
 
 // NewSshRunner creates a new SshRuner instance with the provided SSH client.
@@ -27,12 +29,12 @@ type SshRunner struct {
 //
 // Returns an error if the SSH client creation fails.
 func NewSshRunner(user, host string, opts ...SSHClientOption) (*SshRunner, error) {
-	sshClient, err := MakeSSHClient(user, host, opts...)
+	conn, err := DialConn(user, host, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &SshRunner{
-		sshClient: sshClient,
+		conn: conn,
 	}, nil
 }
 
@@ -45,43 +47,65 @@ func NewSshRunner(user, host string, opts ...SSHClientOption) (*SshRunner, error
 // - Remain valid for the lifetime of the SshRunner
 // - Not be closed while the SshRunner is in use
 //
+// As the client cannot be redialed, the SshRunner returns ErrConnLost once it drops.
+// No keepalive requests are sent on the client, which is left to its owner.
+//
 // Example:
 //
 //	client, _ := ssh.Dial("tcp", "host:22", &ssh.ClientConfig{...})
 //	runner := NewSshRunnerWithClient(client)
 func NewSshRunnerWithClient(sshClient *ssh.Client) *SshRunner {
+	conn, _ := NewConnWithClient(sshClient, WithKeepalive(0)) // never fails by WithKeepalive
+	return &SshRunner{
+		conn: conn,
+	}
+}
+
+// NewSshRunnerWithConn creates a new SshRunner using a managed connection,
+// e.g. one from a Pool. Runners sharing a Conn share its session slots.
+func NewSshRunnerWithConn(conn *Conn) *SshRunner {
 	return &SshRunner{
-		sshClient: sshClient,
+		conn: conn,
 	}
 }
 
-// Run executes a command over SSH and returns its combined output (stdout + stderr) as a string.
+// Close closes the connection of the runner.
+func (s *SshRunner) Close() error {
+	return s.conn.Close()
+}
+
+// Run executes a command over SSH and returns its output as a string. stderr is logged as a warning.
 // The session is automatically closed after the command completes.
 //
+// Once ctx is done, the command is terminated, see WithKillGracePeriod, and
+// ErrCommandTimeout or ErrCommandCanceled is returned. A non-zero exit returns *ExitError.
+//
 // Example:
 //
 //	output, err := runner.Run("ls -la")
 //	// output contains both stdout and stderr from the 'ls -la' command
 func (s *SshRunner) Run(ctx context.Context, cmd string) (string, error) {
-	session, err := s.sshClient.NewSession()
-	if err != nil {
-		return "", err
-	}
-	defer session.Close()
-
-	stderr := bytes.Buffer{}
-	session.Stderr = &stderr
-
-	output, err := session.Output(cmd)
-	if stderr.Len() > 0 {
-		log.Warnf(ctx, "run with stderr: %s", stderr.String())
-	}
+	var output []byte
+	err := s.conn.Session(ctx, func(session *ssh.Session) error {
+		stdout := bytes.Buffer{}
+		stderr := bytes.Buffer{}
+		session.Stdout = &stdout
+		session.Stderr = &stderr
+
+		err := s.runCommand(ctx, session, cmd)
+		output = stdout.Bytes()
+		if stderr.Len() > 0 {
+			log.Warnf(ctx, "run with stderr: %s", stderr.String())
+		}
+		return err
+	})
 	return string(output), err
 }
 
 // RunLog executes a command over SSH and writes its output to the provided writers.
 // stdout and stderr are written to their respective writers.
 // The session is automatically closed after the command completes.
+// ctx and the errors are handled as Run.
 //
 // Example:
 //
@@ -90,21 +114,22 @@ func (s *SshRunner) Run(ctx context.Context, cmd string) (string, error) {
 //	// stdout contains standard output
 //	// stderr contains error output
 func (s *SshRunner) RunLog(ctx context.Context, cmd string, stdOut, stdErr io.Writer) error {
-	session, err := s.sshClient.NewSession()
-	if err != nil {
-		return err
-	}
-	defer session.Close()
+	return s.conn.Session(ctx, func(session *ssh.Session) error {
+		session.Stdout = stdOut
+		session.Stderr = stdErr
 
-	session.Stdout = stdOut
-	session.Stderr = stdErr
+		return s.runCommand(ctx, session, cmd)
+	})
+}
 
-	return session.Run(cmd)
+// runCommand runs cmd until it exits or ctx is done, see Run.
+func (s *SshRunner) runCommand(ctx context.Context, session *ssh.Session, cmd string) error {
+	return runCommand(ctx, session, cmd, s.conn.cfg.killGracePeriod)
 }
 
 var (
-	// ErrUpdateScriptFailed is returned when a script upload operation
-	// completes but the verification step fails.
+	// ErrUpdateScriptFailed is returned when an upload by shell commands, for servers
+	// without the SFTP subsystem, completes but the verification step fails.
 	// This usually indicates that the remote server did not receive
 	// the complete file or had permission issues.
 	ErrUpdateScriptFailed = errors.New("update script failed")
@@ -118,118 +143,68 @@ const success = "success"
 // and verifies the upload was successful.
 //
 // Parameters:
-//   - ctx: Context for logging
+//   - ctx: Context for logging and cancellation
 //   - scriptPath: Remote path where the script should be saved
 //   - scriptData: Content of the script
 //
-// The function will return ErrUpdateScriptFailed if the upload verification fails.
-// The uploaded script will be made executable (chmod +x) automatically.
+// The script is replaced atomically, so that a running script is not changed.
+// The error of Upload is returned, which is ErrUpdateScriptFailed if the verification
+// of an upload by shell commands fails, for servers without the SFTP subsystem.
+// The uploaded script will be made executable (mode 0755) automatically.
 //
 // Example:
 //
 //	scriptData := []byte("#!/bin/bash\necho 'Hello World'")
 //	err := runner.UpdateScript(ctx, "/tmp/hello.sh", scriptData)
 func (s *SshRunner) UpdateScript(ctx context.Context, scriptPath string, scriptData []byte) error {
-	session, err := s.sshClient.NewSession()
-	if err != nil {
-		return err
-	}
-	defer session.Close()
-
-	stderr := bytes.Buffer{}
-	session.Stdin = bytes.NewBuffer(scriptData)
-	session.Stderr = &stderr
-
-	cmd := fmt.Sprintf("cat > %s && chmod +x %s && echo %s", scriptPath, scriptPath, success)
-	output, err := session.Output(cmd)
-	if stderr.Len() > 0 {
-		log.Warnf(ctx, "update script with stderr: %s", stderr.String())
-	}
+	err := s.Upload(ctx, scriptPath, bytes.NewReader(scriptData), WithFileMode(0o755), WithAtomicUpload())
 	if err != nil {
 		log.Errorf(ctx, "update script failed: %v", err)
-		return err
-	}
-
-	if !strings.HasPrefix(string(output), success) {
-		log.Infof(ctx, "ssh update script not success, output: %s", string(output))
-		return ErrUpdateScriptFailed
 	}
-
-	return nil
+	return err
 }
 
 // UploadFile uploads a file to the remote server and verifies the upload was successful.
 //
 // Parameters:
-//   - ctx: Context for logging
+//   - ctx: Context for logging and cancellation
 //   - filePath: Remote path where the file should be saved
 //   - fileData: Content of the file
 //
-// Returns ErrUpdateScriptFailed if the upload verification fails.
+// The error of Upload is returned, which is ErrUpdateScriptFailed if the verification
+// of an upload by shell commands fails, for servers without the SFTP subsystem.
+// Use Upload to stream large files.
 //
 // Example:
 //
 //	fileData := []byte("Hello World")
 //	err := runner.UploadFile(ctx, "/tmp/hello.txt", fileData)
 func (s *SshRunner) UploadFile(ctx context.Context, filePath string, fileData []byte) error {
-	session, err := s.sshClient.NewSession()
-	if err != nil {
-		return err
-	}
-	defer session.Close()
-
-	stderr := bytes.Buffer{}
-	session.Stdin = bytes.NewBuffer(fileData)
-	session.Stderr = &stderr
-
-	output, err := session.Output(fmt.Sprintf("cat > %s && echo %s", filePath, success))
-	if stderr.Len() > 0 {
-		log.Warnf(ctx, "update script with stderr: %s", stderr.String())
-	}
+	err := s.Upload(ctx, filePath, bytes.NewReader(fileData))
 	if err != nil {
 		log.Errorf(ctx, "upload file failed: %v", err)
-		return err
 	}
-
-	if !strings.HasPrefix(string(output), success) {
-		log.Infof(ctx, "ssh upload file not success, output: %s", string(output))
-		return ErrUpdateScriptFailed
-	}
-
-	return nil
+	return err
 }
 
 // DownloadFile retrieves a file from the remote server.
 //
 // Parameters:
-//   - ctx: Context for logging
+//   - ctx: Context for logging and cancellation
 //   - filePath: Remote path of the file to download
 //
 // Returns the file contents as bytes. If the file cannot be read or doesn't exist,
-// returns an empty byte array and an error.
+// returns an empty byte array and an error. Use Download to stream large files.
 //
 // Example:
 //
 //	data, err := runner.DownloadFile(ctx, "/etc/hosts")
 //	// data contains the contents of /etc/hosts if successful
 func (s *SshRunner) DownloadFile(ctx context.Context, filePath string) ([]byte, error) {
-	session, err := s.sshClient.NewSession()
-	if err != nil {
-		return []byte(""), err
-	}
-	defer session.Close()
-
-	stderr := bytes.Buffer{}
-	session.Stderr = &stderr
-
-	output, err := session.Output(fmt.Sprintf("cat %s", filePath))
-	if stderr.Len() > 0 {
-		log.Warnf(ctx, "download file with stderr: %s", stderr.String())
-	}
-	if err != nil {
+	output := bytes.Buffer{}
+	if err := s.Download(ctx, filePath, &output); err != nil {
 		log.Errorf(ctx, "download file failed: %v", err)
 		return []byte(""), err
 	}
-
-	return output, nil
+	return output.Bytes(), nil
 }
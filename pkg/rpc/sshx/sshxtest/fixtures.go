@@ -0,0 +1,97 @@
+package sshxtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// HostKey is the default host key of the servers. It is fixed, so that its
+	// fingerprint and known_hosts lines can be kept in test data.
+	HostKey = fixedSigner("sshxtest host key")
+
+	// ClientKey is the client key accepted by the servers by default.
+	ClientKey = fixedSigner("sshxtest client key")
+
+	// ClientKeyPEM is ClientKey in the OpenSSH private key format, for sshx.WithPrivateKeyBytes.
+	ClientKeyPEM = marshalKey(fixedKey("sshxtest client key"))
+)
+
+// NewSigner returns a new random ed25519 key, e.g. a host key differing from HostKey.
+func NewSigner(t testing.TB) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("sshxtest: generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("sshxtest: signer: %v", err)
+	}
+	return signer
+}
+
+// NewKeyPEM returns a new random ed25519 key in the OpenSSH private key format,
+// with its signer. The key is encrypted if passphrase is not empty.
+func NewKeyPEM(t testing.TB, passphrase string) ([]byte, ssh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("sshxtest: generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("sshxtest: signer: %v", err)
+	}
+	if passphrase == "" {
+		return marshalKey(key), signer
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	if err != nil {
+		t.Fatalf("sshxtest: marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(block), signer
+}
+
+// SignUserCert signs a user certificate of the key for the principals by the ca,
+// for WithCertAuthority and sshx.WithUserCertificate.
+func SignUserCert(t testing.TB, ca ssh.Signer, key ssh.PublicKey, principals ...string) *ssh.Certificate {
+	t.Helper()
+	cert := &ssh.Certificate{
+		Key:             key,
+		CertType:        ssh.UserCert,
+		ValidPrincipals: principals,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatalf("sshxtest: sign certificate: %v", err)
+	}
+	return cert
+}
+
+// fixedKey derives an ed25519 key from the name, the same in every run.
+func fixedKey(name string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte(name))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+func fixedSigner(name string) ssh.Signer {
+	signer, err := ssh.NewSignerFromKey(fixedKey(name))
+	if err != nil {
+		panic(err)
+	}
+	return signer
+}
+
+func marshalKey(key ed25519.PrivateKey) []byte {
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(block)
+}
@@ -0,0 +1,335 @@
+package sshxtest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Handler runs a command of a session and returns its exit status.
+// ctx is canceled once the session receives a signal or is closed; the exit is then
+// reported by the signal.
+type Handler func(ctx context.Context, req *Request) int
+
+// Request is a command to run by a Handler.
+type Request struct {
+	// Command is the command line of an exec request, or "" for a shell request.
+	Command string
+	// Env are the variables of the env requests, as "KEY=value".
+	Env []string
+	// Pty is the pseudo terminal requested, or nil.
+	Pty *PtyRequest
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// PtyRequest is a requested pseudo terminal. The server does not allocate a real one.
+type PtyRequest struct {
+	Term string
+	Cols int
+	Rows int
+}
+
+// ShellHandler runs the commands by the local /bin/sh in dir, with the environment
+// of the test process and of the request. A shell request runs /bin/sh reading stdin.
+func ShellHandler(dir string) Handler {
+	return func(ctx context.Context, req *Request) int {
+		args := []string{"-c", req.Command}
+		if req.Command == "" {
+			args = nil
+		}
+		cmd := exec.CommandContext(ctx, "/bin/sh", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), req.Env...)
+		cmd.Stdout = req.Stdout
+		cmd.Stderr = req.Stderr
+		// children of a killed shell may keep stdout open, do not wait for them
+		cmd.WaitDelay = 100 * time.Millisecond
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			fmt.Fprint(req.Stderr, err)
+			return 127
+		}
+		if err := cmd.Start(); err != nil {
+			fmt.Fprint(req.Stderr, err)
+			return 127
+		}
+		// not waited, as the client may never close stdin
+		go func() {
+			io.Copy(stdin, req.Stdin)
+			stdin.Close()
+		}()
+		err = cmd.Wait()
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			return exitErr.ExitCode()
+		case err != nil:
+			fmt.Fprint(req.Stderr, err)
+			return 127
+		}
+		return 0
+	}
+}
+
+func (s *Server) handleSession(ctx context.Context, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	ended := s.sessionOpened()
+	defer ended()
+	defer ch.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		exitOnce sync.Once
+		signalMu sync.Mutex
+		signal   string // the signal canceling the command
+	)
+	exit := func(status int) {
+		exitOnce.Do(func() {
+			signalMu.Lock()
+			sig := signal
+			signalMu.Unlock()
+			ch.CloseWrite()
+			if sig != "" {
+				ch.SendRequest("exit-signal", false, ssh.Marshal(struct {
+					Signal     string
+					CoreDumped bool
+					Error      string
+					Lang       string
+				}{Signal: sig}))
+			} else {
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+			}
+			ch.Close()
+			ended()
+		})
+	}
+
+	req := &Request{Stdin: ch, Stdout: ch, Stderr: ch.Stderr()}
+	started := false
+	for r := range reqs {
+		switch r.Type {
+		case "env":
+			var kv struct{ Key, Value string }
+			if err := ssh.Unmarshal(r.Payload, &kv); err != nil || started || s.rejectEnv {
+				r.Reply(false, nil)
+				continue
+			}
+			req.Env = append(req.Env, kv.Key+"="+kv.Value)
+			r.Reply(true, nil)
+		case "pty-req":
+			var msg struct {
+				Term                         string
+				Columns, Rows, Width, Height uint32
+				Modes                        string
+			}
+			if err := ssh.Unmarshal(r.Payload, &msg); err != nil || started {
+				r.Reply(false, nil)
+				continue
+			}
+			req.Pty = &PtyRequest{Term: msg.Term, Cols: int(msg.Columns), Rows: int(msg.Rows)}
+			s.recordWindowSize(msg.Columns, msg.Rows)
+			r.Reply(true, nil)
+		case "window-change":
+			// the pty is not real, the size is only recorded
+			var msg struct{ Columns, Rows, Width, Height uint32 }
+			if ssh.Unmarshal(r.Payload, &msg) == nil {
+				s.recordWindowSize(msg.Columns, msg.Rows)
+			}
+		case "exec", "shell":
+			cmd := ""
+			if r.Type == "exec" {
+				var msg struct{ Command string }
+				if err := ssh.Unmarshal(r.Payload, &msg); err != nil || started {
+					r.Reply(false, nil)
+					continue
+				}
+				cmd = msg.Command
+			} else if started {
+				r.Reply(false, nil)
+				continue
+			}
+			started = true
+			req.Command = cmd
+			s.recordCommand(cmd)
+			r.Reply(true, nil)
+			go func() {
+				exit(s.handler(ctx, req))
+			}()
+		case "subsystem":
+			var msg struct{ Name string }
+			if err := ssh.Unmarshal(r.Payload, &msg); err != nil || msg.Name != "sftp" || !s.sftp || started {
+				r.Reply(false, nil)
+				continue
+			}
+			started = true
+			r.Reply(true, nil)
+			go func() {
+				var opts []sftp.ServerOption
+				if s.dir != "" {
+					opts = append(opts, sftp.WithServerWorkingDirectory(s.dir))
+				}
+				server, err := sftp.NewServer(ch, opts...)
+				if err == nil {
+					server.Serve()
+				}
+				exit(0)
+			}()
+		case "signal":
+			var msg struct{ Signal string }
+			if err := ssh.Unmarshal(r.Payload, &msg); err != nil {
+				continue
+			}
+			if s.recordSignal(msg.Signal) {
+				continue
+			}
+			signalMu.Lock()
+			if signal == "" {
+				signal = msg.Signal
+			}
+			signalMu.Unlock()
+			cancel()
+		default:
+			if r.WantReply {
+				r.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// handleDirectTCPIP forwards the channel to the address requested, for local
+// and dynamic forwarding and jump hosts.
+func (s *Server) handleDirectTCPIP(newCh ssh.NewChannel) {
+	var msg struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newCh.ExtraData(), &msg); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	conn, err := net.Dial("tcp", joinHostPort(msg.Host, msg.Port))
+	if err != nil {
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.forwards.Add(1)
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn)
+}
+
+// handleGlobalRequests serves the tcpip-forward requests of remote forwarding,
+// until the connection is closed.
+func (s *Server) handleGlobalRequests(sconn *ssh.ServerConn, reqs <-chan *ssh.Request) {
+	listeners := map[string]net.Listener{} // by the requested address
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for r := range reqs {
+		switch r.Type {
+		case "keepalive@openssh.com":
+			if !s.ignoreKeepalive.Load() {
+				r.Reply(false, nil)
+			}
+		case "tcpip-forward":
+			var msg struct {
+				Addr string
+				Port uint32
+			}
+			if err := ssh.Unmarshal(r.Payload, &msg); err != nil {
+				r.Reply(false, nil)
+				continue
+			}
+			l, err := net.Listen("tcp", joinHostPort(msg.Addr, msg.Port))
+			if err != nil {
+				r.Reply(false, nil)
+				continue
+			}
+			listeners[joinHostPort(msg.Addr, msg.Port)] = l
+			port := uint32(l.Addr().(*net.TCPAddr).Port)
+			reply := make([]byte, 4)
+			binary.BigEndian.PutUint32(reply, port)
+			r.Reply(true, reply)
+			go serveForwarded(sconn, l, msg.Addr, port)
+		case "cancel-tcpip-forward":
+			var msg struct {
+				Addr string
+				Port uint32
+			}
+			key := ""
+			if ssh.Unmarshal(r.Payload, &msg) == nil {
+				key = joinHostPort(msg.Addr, msg.Port)
+			}
+			l, ok := listeners[key]
+			if ok {
+				l.Close()
+				delete(listeners, key)
+			}
+			r.Reply(ok, nil)
+		default:
+			if r.WantReply {
+				r.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// serveForwarded opens a forwarded-tcpip channel to the client for each connection
+// accepted by the remote forwarding listener.
+func serveForwarded(sconn *ssh.ServerConn, l net.Listener, addr string, port uint32) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		origin := conn.RemoteAddr().(*net.TCPAddr)
+		ch, reqs, err := sconn.OpenChannel("forwarded-tcpip", ssh.Marshal(struct {
+			Addr       string
+			Port       uint32
+			OriginAddr string
+			OriginPort uint32
+		}{addr, port, origin.IP.String(), uint32(origin.Port)}))
+		if err != nil {
+			conn.Close()
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		go pipe(ch, conn)
+	}
+}
+
+// pipe copies between a and b until either side is closed, then closes both.
+func pipe(a, b io.ReadWriteCloser) {
+	done := make(chan struct{}, 2)
+	copyTo := func(dst io.Writer, src io.Reader) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+	go copyTo(a, b)
+	go copyTo(b, a)
+	<-done
+	a.Close()
+	b.Close()
+}
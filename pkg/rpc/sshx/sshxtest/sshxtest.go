@@ -0,0 +1,428 @@
+// Package sshxtest provides an in-process SSH server, for testing code built on sshx
+// without a real host.
+//
+// By default the server accepts ClientKey, runs the commands by the local /bin/sh in a
+// temporary directory, and identifies itself by HostKey. Options replace the command
+// handler, the client authentication and the host key, and serve SFTP.
+//
+// Example:
+//
+//	func TestDeploy(t *testing.T) {
+//	    srv := sshxtest.New(t, sshxtest.WithSFTP())
+//	    runner := srv.Runner()
+//
+//	    err := runner.Upload(ctx, srv.Dir()+"/app.conf", strings.NewReader("debug = true"))
+//	    require.NoError(t, err)
+//	    output, err := runner.Run(ctx, "cat app.conf")
+//	    require.NoError(t, err)
+//	    require.Equal(t, "debug = true", output)
+//	}
+//
+// The server is closed on t.Cleanup.
+package sshxtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Option configures a Server.
+type Option func(s *Server)
+
+// WithHandler runs the commands by h instead of the local shell.
+func WithHandler(h Handler) Option {
+	return func(s *Server) {
+		s.handler = h
+	}
+}
+
+// WithShell runs the commands by the local /bin/sh in dir, which is also the working
+// directory of SFTP. This is the default, in a temporary directory.
+func WithShell(dir string) Option {
+	return func(s *Server) {
+		s.dir = dir
+		s.handler = ShellHandler(dir)
+	}
+}
+
+// WithSFTP serves the sftp subsystem on the local file system. Relative paths are
+// relative to Server.Dir.
+func WithSFTP() Option {
+	return func(s *Server) {
+		s.sftp = true
+	}
+}
+
+// WithHostKey replaces the host key HostKey, e.g. by NewSigner.
+func WithHostKey(signer ssh.Signer) Option {
+	return func(s *Server) {
+		s.hostKey = signer
+	}
+}
+
+// WithAuthorizedKeys accepts the client keys instead of ClientKey.
+// Without keys, no public key is accepted.
+func WithAuthorizedKeys(keys ...ssh.PublicKey) Option {
+	return func(s *Server) {
+		s.authorizedKeys = keys
+	}
+}
+
+// WithPassword accepts the password of the user, by the password and the
+// keyboard-interactive methods.
+func WithPassword(user, password string) Option {
+	return func(s *Server) {
+		s.passwords[user] = password
+	}
+}
+
+// WithCertAuthority accepts the user certificates signed by the ca, for the user
+// among their principals, see SignUserCert.
+func WithCertAuthority(ca ssh.PublicKey) Option {
+	return func(s *Server) {
+		s.certAuthorities = append(s.certAuthorities, ca)
+	}
+}
+
+// WithIgnoredSignals records the signals without canceling the commands, like a trap.
+// Other signals cancel the commands, and their exit is reported by the signal.
+func WithIgnoredSignals(signals ...string) Option {
+	return func(s *Server) {
+		s.ignoredSignals = signals
+	}
+}
+
+// WithRejectEnv rejects the env requests, like sshd without AcceptEnv.
+func WithRejectEnv() Option {
+	return func(s *Server) {
+		s.rejectEnv = true
+	}
+}
+
+// WithServerConfig modifies the server config before serving, e.g. to change the
+// algorithms or the banner.
+func WithServerConfig(f func(config *ssh.ServerConfig)) Option {
+	return func(s *Server) {
+		s.configure = append(s.configure, f)
+	}
+}
+
+// Server is an in-process SSH server listening on a random port of 127.0.0.1.
+// It serves exec and shell sessions, env, pty and signal requests, the sftp subsystem
+// if WithSFTP, and local and remote port forwarding.
+type Server struct {
+	t        testing.TB
+	listener net.Listener
+	config   *ssh.ServerConfig
+	handler  Handler
+	dir      string
+	sftp     bool
+	hostKey  ssh.Signer
+
+	authorizedKeys  []ssh.PublicKey
+	passwords       map[string]string
+	certAuthorities []ssh.PublicKey
+	configure       []func(config *ssh.ServerConfig)
+	ignoredSignals  []string
+	rejectEnv       bool
+
+	ignoreKeepalive atomic.Bool
+	dials           atomic.Int32
+	forwards        atomic.Int32
+	sessions        atomic.Int32
+	maxSessions     atomic.Int32
+
+	mu          sync.Mutex
+	conns       []net.Conn
+	commands    []string
+	signals     []string
+	windowSizes []sshx.WindowSize
+}
+
+// New starts a Server. It is closed on t.Cleanup.
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	s := &Server{
+		t:              t,
+		hostKey:        HostKey,
+		authorizedKeys: []ssh.PublicKey{ClientKey.PublicKey()},
+		passwords:      map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.handler == nil {
+		s.dir = t.TempDir()
+		s.handler = ShellHandler(s.dir)
+	}
+	s.config = s.serverConfig()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("sshxtest: listen: %v", err)
+	}
+	s.listener = listener
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *Server) serverConfig() *ssh.ServerConfig {
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return slices.ContainsFunc(s.certAuthorities, func(ca ssh.PublicKey) bool {
+				return bytes.Equal(ca.Marshal(), auth.Marshal())
+			})
+		},
+		UserKeyFallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, authorized := range s.authorizedKeys {
+				if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("sshxtest: unauthorized key %s", ssh.FingerprintSHA256(key))
+		},
+	}
+	checkPassword := func(user, password string) error {
+		if want, ok := s.passwords[user]; ok && want == password {
+			return nil
+		}
+		return fmt.Errorf("sshxtest: wrong password of %s", user)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: checker.Authenticate,
+	}
+	if len(s.passwords) > 0 {
+		config.PasswordCallback = func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, checkPassword(conn.User(), string(password))
+		}
+		config.KeyboardInteractiveCallback = func(conn ssh.ConnMetadata, challenge ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := challenge(conn.User(), "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			return nil, checkPassword(conn.User(), answers[0])
+		}
+	}
+	config.AddHostKey(s.hostKey)
+	for _, f := range s.configure {
+		f(config)
+	}
+	return config
+}
+
+// Addr returns the address listened on, "127.0.0.1:port".
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Host returns the host to connect to, "127.0.0.1".
+func (s *Server) Host() string {
+	return "127.0.0.1"
+}
+
+// Port returns the port listened on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Dir returns the working directory of the shell and SFTP,
+// or "" if the commands are run by WithHandler.
+func (s *Server) Dir() string {
+	return s.dir
+}
+
+// HostKey returns the public host key of the server.
+func (s *Server) HostKey() ssh.PublicKey {
+	return s.hostKey.PublicKey()
+}
+
+// Fingerprint returns the SHA256 fingerprint of the host key, for sshx.WithHostKeyFingerprints.
+func (s *Server) Fingerprint() string {
+	return ssh.FingerprintSHA256(s.hostKey.PublicKey())
+}
+
+// KnownHostsFile writes a known_hosts file of the server, for sshx.WithKnownHosts.
+func (s *Server) KnownHostsFile() string {
+	s.t.Helper()
+	file := filepath.Join(s.t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.Addr())}, s.hostKey.PublicKey())
+	if err := os.WriteFile(file, []byte(line+"\n"), 0o600); err != nil {
+		s.t.Fatalf("sshxtest: write known_hosts: %v", err)
+	}
+	return file
+}
+
+// Options returns the options to connect to the server with Host: its port, ClientKey,
+// and its host key pinned, followed by opts.
+func (s *Server) Options(opts ...sshx.SSHClientOption) []sshx.SSHClientOption {
+	return append([]sshx.SSHClientOption{
+		sshx.WithPort(s.Port()),
+		sshx.WithPrivateKeyBytes(ClientKeyPEM),
+		sshx.WithHostKeyFingerprints(s.Fingerprint()),
+	}, opts...)
+}
+
+// Runner connects a runner to the server as "sshxtest", see Options.
+// The runner is closed on t.Cleanup.
+func (s *Server) Runner(opts ...sshx.SSHClientOption) *sshx.SshRunner {
+	s.t.Helper()
+	runner, err := sshx.NewSshRunner("sshxtest", s.Host(), s.Options(opts...)...)
+	if err != nil {
+		s.t.Fatalf("sshxtest: connect: %v", err)
+	}
+	s.t.Cleanup(func() { runner.Close() })
+	return runner
+}
+
+// Commands returns the commands executed, in order. A shell session is "".
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.commands)
+}
+
+// Signals returns the signals received by the sessions, e.g. "TERM".
+func (s *Server) Signals() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.signals)
+}
+
+// WindowSizes returns the sizes of the pty and window-change requests, in order.
+func (s *Server) WindowSizes() []sshx.WindowSize {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.windowSizes)
+}
+
+// Dials returns the number of connections accepted.
+func (s *Server) Dials() int {
+	return int(s.dials.Load())
+}
+
+// Forwards returns the number of direct-tcpip channels forwarded, by local and
+// dynamic forwarding and jump hosts.
+func (s *Server) Forwards() int {
+	return int(s.forwards.Load())
+}
+
+// Sessions returns the number of sessions open.
+func (s *Server) Sessions() int {
+	return int(s.sessions.Load())
+}
+
+// MaxSessions returns the maximum number of sessions open at the same time.
+func (s *Server) MaxSessions() int {
+	return int(s.maxSessions.Load())
+}
+
+// IgnoreKeepalive stops replying the keepalive requests if ignore, like a dead peer,
+// or replies them again.
+func (s *Server) IgnoreKeepalive(ignore bool) {
+	s.ignoreKeepalive.Store(ignore)
+}
+
+// CloseConnections closes all the client connections, like a network failure,
+// keeping the server listening, e.g. to test reconnection.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// Close stops listening and closes all the connections.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.CloseConnections()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.dials.Add(1)
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.handleGlobalRequests(sconn, reqs)
+	for newCh := range chans {
+		switch newCh.ChannelType() {
+		case "session":
+			ch, chReqs, err := newCh.Accept()
+			if err != nil {
+				continue
+			}
+			go s.handleSession(ctx, ch, chReqs)
+		case "direct-tcpip":
+			go s.handleDirectTCPIP(newCh)
+		default:
+			newCh.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+func (s *Server) recordCommand(cmd string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commands = append(s.commands, cmd)
+}
+
+// recordSignal records the signal, and reports whether it is ignored.
+func (s *Server) recordSignal(sig string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signals = append(s.signals, sig)
+	return slices.Contains(s.ignoredSignals, sig)
+}
+
+func (s *Server) recordWindowSize(cols, rows uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.windowSizes = append(s.windowSizes, sshx.WindowSize{Cols: int(cols), Rows: int(rows)})
+}
+
+// sessionOpened counts a session, and returns the func counting its end.
+func (s *Server) sessionOpened() func() {
+	n := s.sessions.Add(1)
+	for {
+		max := s.maxSessions.Load()
+		if n <= max || s.maxSessions.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	return sync.OnceFunc(func() { s.sessions.Add(-1) })
+}
+
+func joinHostPort(host string, port uint32) string {
+	return net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10))
+}
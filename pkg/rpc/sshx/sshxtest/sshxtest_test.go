@@ -0,0 +1,160 @@
+package sshxtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RyoJerryYu/go-utilx/pkg/rpc/sshx"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestShell(t *testing.T) {
+	ctx := context.Background()
+	srv := New(t, WithSFTP())
+	runner := srv.Runner()
+
+	require.NoError(t, runner.Upload(ctx, "app.conf", strings.NewReader("debug = true")))
+	content, err := os.ReadFile(filepath.Join(srv.Dir(), "app.conf"))
+	require.NoError(t, err)
+	require.Equal(t, "debug = true", string(content))
+
+	output, err := runner.Run(ctx, "cat app.conf")
+	require.NoError(t, err)
+	require.Equal(t, "debug = true", output)
+
+	output, err = runner.RunCommand(ctx, sshx.NewCommand("sh", "-c", `echo "$GREETING"`).Env("GREETING", "hello world"))
+	require.NoError(t, err)
+	require.Equal(t, "hello world\n", output)
+
+	_, err = runner.Run(ctx, "exit 3")
+	var exitErr *sshx.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, 3, exitErr.ExitCode)
+
+	require.Equal(t, []string{"cat app.conf", `sh -c 'echo "$GREETING"'`, "exit 3"}, srv.Commands())
+}
+
+func TestHandler(t *testing.T) {
+	ctx := context.Background()
+	srv := New(t, WithHandler(func(ctx context.Context, req *Request) int {
+		if req.Pty != nil {
+			fmt.Fprintf(req.Stdout, "%s %dx%d\r\n", req.Pty.Term, req.Pty.Cols, req.Pty.Rows)
+			return 0
+		}
+		io.WriteString(req.Stdout, strings.ToUpper(req.Command))
+		return 0
+	}))
+	require.Empty(t, srv.Dir())
+	runner := srv.Runner()
+
+	output, err := runner.Run(ctx, "hello")
+	require.NoError(t, err)
+	require.Equal(t, "HELLO", output)
+
+	p, err := runner.Start(ctx, "top", sshx.WithPty("vt100", 132, 50))
+	require.NoError(t, err)
+	defer p.Close()
+	output, err = p.ExpectString(ctx, "\r\n")
+	require.NoError(t, err)
+	require.Equal(t, "vt100 132x50\r\n", output)
+	require.NoError(t, p.Wait())
+}
+
+func TestSignal(t *testing.T) {
+	srv := New(t)
+	runner := srv.Runner(sshx.WithKillGracePeriod(time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := runner.Run(ctx, "sleep 10")
+	require.ErrorIs(t, err, sshx.ErrCommandTimeout)
+	require.Equal(t, []string{"TERM"}, srv.Signals())
+}
+
+func TestAuth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("password", func(t *testing.T) {
+		srv := New(t, WithAuthorizedKeys(), WithPassword("alice", "secret"))
+		runner, err := sshx.NewSshRunner("alice", srv.Host(), sshx.WithPort(srv.Port()),
+			sshx.WithPassword("secret"), sshx.WithHostKeyFingerprints(srv.Fingerprint()))
+		require.NoError(t, err)
+		defer runner.Close()
+		_, err = runner.Run(ctx, "true")
+		require.NoError(t, err)
+
+		_, err = sshx.NewSshRunner("alice", srv.Host(), sshx.WithPort(srv.Port()),
+			sshx.WithPassword("wrong"), sshx.WithHostKeyFingerprints(srv.Fingerprint()))
+		require.Error(t, err)
+		_, err = sshx.NewSshRunner("alice", srv.Host(), srv.Options()...)
+		require.Error(t, err, "ClientKey is not authorized")
+	})
+
+	t.Run("certificate", func(t *testing.T) {
+		ca := NewSigner(t)
+		srv := New(t, WithAuthorizedKeys(), WithCertAuthority(ca.PublicKey()))
+		keyPEM, signer := NewKeyPEM(t, "")
+		cert := SignUserCert(t, ca, signer.PublicKey(), "bob")
+
+		runner, err := sshx.NewSshRunner("bob", srv.Host(), sshx.WithPort(srv.Port()),
+			sshx.WithUserCertificate(keyPEM, ssh.MarshalAuthorizedKey(cert)),
+			sshx.WithHostKeyFingerprints(srv.Fingerprint()))
+		require.NoError(t, err)
+		defer runner.Close()
+		_, err = runner.Run(ctx, "true")
+		require.NoError(t, err)
+
+		_, err = sshx.NewSshRunner("carol", srv.Host(), sshx.WithPort(srv.Port()),
+			sshx.WithUserCertificate(keyPEM, ssh.MarshalAuthorizedKey(cert)),
+			sshx.WithHostKeyFingerprints(srv.Fingerprint()))
+		require.Error(t, err, "not a principal")
+	})
+
+	t.Run("encrypted key", func(t *testing.T) {
+		keyPEM, signer := NewKeyPEM(t, "pass")
+		srv := New(t, WithAuthorizedKeys(signer.PublicKey()))
+		runner, err := sshx.NewSshRunner("user", srv.Host(), sshx.WithPort(srv.Port()),
+			sshx.WithPassphrase(func(file string) ([]byte, error) { return []byte("pass"), nil }),
+			sshx.WithPrivateKeyBytes(keyPEM),
+			sshx.WithHostKeyFingerprints(srv.Fingerprint()))
+		require.NoError(t, err)
+		runner.Close()
+	})
+}
+
+func TestHostKey(t *testing.T) {
+	srv := New(t)
+	require.Equal(t, HostKey.PublicKey(), srv.HostKey())
+	runner, err := sshx.NewSshRunner("user", srv.Host(), sshx.WithPort(srv.Port()),
+		sshx.WithPrivateKeyBytes(ClientKeyPEM), sshx.WithKnownHosts(srv.KnownHostsFile()))
+	require.NoError(t, err)
+	runner.Close()
+
+	other := New(t, WithHostKey(NewSigner(t)))
+	_, err = sshx.NewSshRunner("user", other.Host(), sshx.WithPort(other.Port()),
+		sshx.WithPrivateKeyBytes(ClientKeyPEM), sshx.WithHostKeyFingerprints(srv.Fingerprint()))
+	var mismatch *sshx.HostKeyMismatchError
+	require.True(t, errors.As(err, &mismatch), "%v", err)
+}
+
+func TestCloseConnections(t *testing.T) {
+	ctx := context.Background()
+	srv := New(t)
+	runner := srv.Runner()
+	_, err := runner.Run(ctx, "true")
+	require.NoError(t, err)
+
+	srv.CloseConnections()
+	require.Eventually(t, func() bool {
+		_, err := runner.Run(ctx, "true")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "reconnects")
+}